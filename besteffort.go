@@ -0,0 +1,118 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+// OpStatus is the outcome of applying a single op with ApplyBestEffort.
+type OpStatus string
+
+const (
+	OpStatusApplied = OpStatus("applied")
+	OpStatusFailed  = OpStatus("failed")
+	OpStatusSkipped = OpStatus("skipped")
+)
+
+// OpResult is the result of applying a single op with ApplyBestEffort.
+type OpResult struct {
+	// Index is the index of the op in the patch.
+	Index int
+	Op    JSONPatchOp
+	// Status is whether the op was applied, failed, or skipped because a test op before it failed.
+	Status OpStatus
+	// Err is the error if the op failed, or the failed test op's error if it was skipped.
+	Err error
+	// Target is the value at the op path after the op was applied. It's nil if the op failed or was skipped, or after a remove op.
+	// For an add at the end of a slice with "-", it's the appended element.
+	Target interface{}
+}
+
+// ApplyBestEffort applies as many ops of the patch to realObj as possible, returning the result of each op.
+// Each op either applies or fails without modifying the object, and a failed op doesn't stop the ops after it.
+// Each op is applied to a deep copy of the object before the object itself, so an op which fails part way, for example after creating missing containers, leaves nothing behind. Custom ops are applied twice, so they must be deterministic.
+// The object is deep-copied once, and again after each failed op, to discard what it left in the copy, so the cost of copying grows with the number of failed ops, not the number of ops.
+//
+// A test op guards the ops after it, up to the next test op which follows a non-test op. If a test op fails, the ops it guards are skipped.
+// For example, in [test, test, add, replace, test, remove], if either of the first two tests fail, the add and replace are skipped, but the last test and remove are still applied.
+//
+// If realObj isn't a non-nil pointer, every op fails with that error.
+func ApplyBestEffort(patch JSONPatch, realObj interface{}) []OpResult {
+	return (&Patcher{}).ApplyBestEffort(patch, realObj)
+}
+
+// ApplyBestEffort applies as many ops of the patch to realObj as possible, returning the result of each op.
+// See the package ApplyBestEffort.
+func (p *Patcher) ApplyBestEffort(patch JSONPatch, realObj interface{}) []OpResult {
+	results := make([]OpResult, len(patch))
+	obj, err := getApplyObj(realObj)
+	if err != nil {
+		for i, patchOp := range patch {
+			results[i] = OpResult{Index: i, Op: patchOp, Status: OpStatusFailed, Err: err}
+		}
+		return results
+	}
+
+	// the copy is kept equal to the object, by applying each op to both, and copying the object again after a failure
+	cp := reflect.New(obj.Type()).Elem()
+	cp.Set(deepCopy(obj))
+
+	groupErr := error(nil) // the error of a failed test op guarding the current group
+	prevTest := false
+	for i, patchOp := range patch {
+		isTest := patchOp.Op == OpTypeTest
+		if isTest && !prevTest {
+			groupErr = nil // a new group
+		}
+		prevTest = isTest
+
+		results[i] = OpResult{Index: i, Op: patchOp}
+		if groupErr != nil {
+			results[i].Status = OpStatusSkipped
+			results[i].Err = groupErr
+			continue
+		}
+		err := p.applyOp(cp, patchOp)
+		if err == nil && !isTest {
+			err = p.applyOp(obj, patchOp)
+		}
+		if err != nil {
+			if !isTest {
+				cp.Set(deepCopy(obj))
+			}
+			results[i].Status = OpStatusFailed
+			results[i].Err = err
+			if isTest {
+				groupErr = errors.New("skipped because test op " + strconv.Itoa(i) + " failed: " + err.Error())
+			}
+			continue
+		}
+		results[i].Status = OpStatusApplied
+		if patchOp.Op != OpTypeRemove {
+			results[i].Target = getTarget(obj, patchOp.Path)
+		}
+	}
+	return results
+}
+
+// getTarget returns the value at path in obj, or nil if there is none or it can't be interfaced.
+// A last path token of "-" is the last element of a slice.
+func getTarget(obj reflect.Value, path string) interface{} {
+	pathParts, err := ParsePath(path)
+	if err != nil {
+		return nil
+	}
+	if len(pathParts) > 0 && pathParts[len(pathParts)-1] == "-" {
+		before, _, err := getValBefore(pathParts, obj, false)
+		if err != nil || before.Kind() != reflect.Slice || before.Len() == 0 {
+			return nil
+		}
+		pathParts = append(append([]string{}, pathParts[:len(pathParts)-1]...), strconv.Itoa(before.Len()-1))
+	}
+	val, _, err := getValAt(pathParts, obj, false)
+	if err != nil || !val.CanInterface() {
+		return nil
+	}
+	return val.Interface()
+}
@@ -0,0 +1,135 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyBestEffort(t *testing.T) {
+	type TestObj struct {
+		A int            `json:"a"`
+		B int            `json:"b"`
+		M map[string]int `json:"m"`
+		S []string       `json:"s"`
+	}
+
+	patch := JSONPatch{
+		{Op: OpTypeReplace, Path: "/a", Value: 2},
+		{Op: OpTypeReplace, Path: "/nonexistent", Value: 3},
+		{Op: OpTypeAdd, Path: "/m/x", Value: 4},
+		{Op: OpTypeTest, Path: "/b", Value: 100},
+		{Op: OpTypeReplace, Path: "/b", Value: 5},
+		{Op: OpTypeAdd, Path: "/s/-", Value: "skipped"},
+		{Op: OpTypeTest, Path: "/b", Value: 1},
+		{Op: OpTypeTest, Path: "/a", Value: 2},
+		{Op: OpTypeAdd, Path: "/s/-", Value: "c"},
+		{Op: OpTypeRemove, Path: "/m/y"},
+	}
+
+	obj := &TestObj{
+		A: 1,
+		B: 1,
+		M: map[string]int{"y": 6},
+		S: []string{"a", "b"},
+	}
+
+	results := ApplyBestEffort(patch, obj)
+
+	expectedStatuses := []OpStatus{
+		OpStatusApplied,
+		OpStatusFailed,
+		OpStatusApplied,
+		OpStatusFailed,
+		OpStatusSkipped,
+		OpStatusSkipped,
+		OpStatusApplied,
+		OpStatusApplied,
+		OpStatusApplied,
+		OpStatusApplied,
+	}
+	expectedTargets := []interface{}{2, nil, 4, nil, nil, nil, 1, 2, "c", nil}
+
+	if len(results) != len(patch) {
+		t.Fatalf("ApplyBestEffort expected %+v results, actual %+v", len(patch), len(results))
+	}
+	for i, result := range results {
+		if result.Index != i || !reflect.DeepEqual(result.Op, patch[i]) {
+			t.Errorf("ApplyBestEffort result %v expected index %v op %+v, actual %+v %+v", i, i, patch[i], result.Index, result.Op)
+		}
+		if result.Status != expectedStatuses[i] {
+			t.Errorf("ApplyBestEffort result %v expected status %v, actual %v (%+v)", i, expectedStatuses[i], result.Status, result.Err)
+		}
+		if (result.Err == nil) != (result.Status == OpStatusApplied) {
+			t.Errorf("ApplyBestEffort result %v status %v unexpected error %+v", i, result.Status, result.Err)
+		}
+		if !reflect.DeepEqual(result.Target, expectedTargets[i]) {
+			t.Errorf("ApplyBestEffort result %v expected target %+v, actual %+v", i, expectedTargets[i], result.Target)
+		}
+	}
+
+	expected := &TestObj{
+		A: 2,
+		B: 1,
+		M: map[string]int{"x": 4},
+		S: []string{"a", "b", "c"},
+	}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("ApplyBestEffort expected %+v actual %+v", expected, obj)
+	}
+}
+
+func TestApplyBestEffortNotPointer(t *testing.T) {
+	type TestObj struct {
+		A int `json:"a"`
+	}
+
+	patch := JSONPatch{
+		{Op: OpTypeReplace, Path: "/a", Value: 2},
+		{Op: OpTypeReplace, Path: "/a", Value: 3},
+	}
+	results := ApplyBestEffort(patch, TestObj{})
+	for i, result := range results {
+		if result.Status != OpStatusFailed || result.Err == nil {
+			t.Errorf("ApplyBestEffort non-pointer result %v expected failure, actual %+v", i, result)
+		}
+	}
+}
+
+func TestApplyBestEffortCreateMissing(t *testing.T) {
+	type Limits struct {
+		Max int `json:"max"`
+	}
+	type Config struct {
+		Limits *Limits `json:"limits"`
+	}
+	type TestObj struct {
+		Config *Config `json:"config"`
+	}
+
+	obj := &TestObj{}
+	patcher := &Patcher{Options: Options{CreateMissing: true}}
+	results := patcher.ApplyBestEffort(JSONPatch{{Op: OpTypeAdd, Path: "/config/limits/max", Value: "wrong type"}}, obj)
+	if results[0].Status != OpStatusFailed {
+		t.Errorf("ApplyBestEffort wrong type expected status %v, actual %v", OpStatusFailed, results[0].Status)
+	}
+	if obj.Config != nil {
+		t.Errorf("ApplyBestEffort failed op expected nil Config, actual %+v", obj.Config)
+	}
+
+	// test ops are only applied to the copy, so the containers the failed op created must be gone from it too
+	results = patcher.ApplyBestEffort(JSONPatch{
+		{Op: OpTypeAdd, Path: "/config/limits/max", Value: "wrong type"},
+		{Op: OpTypeTest, Path: "/config/limits/max", Value: 0},
+	}, obj)
+	if results[0].Status != OpStatusFailed || results[1].Status != OpStatusFailed {
+		t.Errorf("ApplyBestEffort test after failed op expected status %v %v, actual %v %v", OpStatusFailed, OpStatusFailed, results[0].Status, results[1].Status)
+	}
+
+	results = patcher.ApplyBestEffort(JSONPatch{{Op: OpTypeAdd, Path: "/config/limits/max", Value: 10}}, obj)
+	if results[0].Status != OpStatusApplied {
+		t.Errorf("ApplyBestEffort expected status %v, actual %v (%+v)", OpStatusApplied, results[0].Status, results[0].Err)
+	}
+	if obj.Config == nil || obj.Config.Limits == nil || obj.Config.Limits.Max != 10 {
+		t.Errorf("ApplyBestEffort expected Config.Limits.Max 10, actual %+v", obj.Config)
+	}
+}
@@ -0,0 +1,168 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// cloner deep-copies values.
+// It keeps the pointers and maps it has already copied, so references which are shared or cyclic in the original are shared or cyclic in the copy, and copying terminates.
+type cloner struct {
+	copied map[clonedRef]reflect.Value
+}
+
+// clonedRef identifies a pointer or map which has been copied. The type is needed, because a pointer to a struct and to its first field have the same address.
+type clonedRef struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// deepCopy returns a deep copy of val, which shares no slices, maps, or pointers with it.
+// PatchCloner values are copied by their Clone. Otherwise, unexported struct fields can't be set via reflection, so they're copied shallowly. Funcs, channels, and unsafe pointers are also copied shallowly.
+func deepCopy(val reflect.Value) reflect.Value {
+	c := cloner{copied: map[clonedRef]reflect.Value{}}
+	return c.clone(val)
+}
+
+func (c cloner) clone(val reflect.Value) reflect.Value {
+	if cp, ok := c.clonePatchable(val); ok {
+		return cp
+	}
+	switch val.Kind() {
+	case reflect.Ptr:
+		if val.IsNil() {
+			return reflect.Zero(val.Type())
+		}
+		ref := clonedRef{ptr: val.Pointer(), typ: val.Type()}
+		if cp, ok := c.copied[ref]; ok {
+			return cp
+		}
+		cp := reflect.New(val.Type().Elem())
+		c.copied[ref] = cp // before copying the element, so a cycle back to this pointer gets the copy
+		cp.Elem().Set(c.clone(val.Elem()))
+		return cp
+
+	case reflect.Map:
+		if val.IsNil() {
+			return reflect.Zero(val.Type())
+		}
+		ref := clonedRef{ptr: val.Pointer(), typ: val.Type()}
+		if cp, ok := c.copied[ref]; ok {
+			return cp
+		}
+		cp := reflect.MakeMapWithSize(val.Type(), val.Len())
+		c.copied[ref] = cp
+		iter := val.MapRange()
+		for iter.Next() {
+			cp.SetMapIndex(iter.Key(), c.clone(iter.Value()))
+		}
+		return cp
+
+	case reflect.Slice:
+		if val.IsNil() {
+			return reflect.Zero(val.Type())
+		}
+		cp := reflect.MakeSlice(val.Type(), val.Len(), val.Len())
+		for i := 0; i < val.Len(); i++ {
+			cp.Index(i).Set(c.clone(val.Index(i)))
+		}
+		return cp
+
+	case reflect.Array:
+		cp := reflect.New(val.Type()).Elem()
+		for i := 0; i < val.Len(); i++ {
+			cp.Index(i).Set(c.clone(val.Index(i)))
+		}
+		return cp
+
+	case reflect.Struct:
+		cp := reflect.New(val.Type()).Elem()
+		cp.Set(val) // copies unexported fields, which can't be set individually
+		for i := 0; i < cp.NumField(); i++ {
+			if cp.Field(i).CanSet() {
+				cp.Field(i).Set(c.clone(val.Field(i)))
+			}
+		}
+		return cp
+
+	case reflect.Interface:
+		if val.IsNil() {
+			return reflect.Zero(val.Type())
+		}
+		cp := reflect.New(val.Type()).Elem()
+		cp.Set(c.clone(val.Elem()))
+		return cp
+	}
+	return val
+}
+
+// clonePatchable returns the Clone of val, if it or a pointer to it is a PatchCloner, and Clone returns a value of its type or a pointer to one.
+// Interfaces aren't cloned themselves, so the value in them is.
+func (c cloner) clonePatchable(val reflect.Value) (reflect.Value, bool) {
+	if val.Kind() == reflect.Interface || !val.CanInterface() {
+		return reflect.Value{}, false
+	}
+	typ := val.Type()
+	if typ.Implements(patchClonerType) {
+		if val.Kind() != reflect.Ptr {
+			return clonedAs(val.Interface().(PatchCloner).Clone(), typ)
+		}
+		if val.IsNil() {
+			return reflect.Zero(typ), true
+		}
+		ref := clonedRef{ptr: val.Pointer(), typ: typ}
+		if cp, ok := c.copied[ref]; ok {
+			return cp, true
+		}
+		cp, ok := clonedAs(val.Interface().(PatchCloner).Clone(), typ)
+		if ok {
+			c.copied[ref] = cp
+		}
+		return cp, ok
+	}
+	if reflect.PtrTo(typ).Implements(patchClonerType) {
+		ptr := reflect.New(typ)
+		ptr.Elem().Set(val)
+		return clonedAs(ptr.Interface().(PatchCloner).Clone(), typ)
+	}
+	return reflect.Value{}, false
+}
+
+// clonedAs returns the result of a Clone as a value of typ.
+// A result of typ is returned as is, a pointer to typ is dereferenced, and the address of a value typ points to is taken. Returns false for any other result.
+func clonedAs(cp interface{}, typ reflect.Type) (reflect.Value, bool) {
+	val := reflect.ValueOf(cp)
+	switch {
+	case !val.IsValid():
+		return reflect.Value{}, false
+	case val.Type() == typ:
+		return val, true
+	case val.Kind() == reflect.Ptr && val.Type().Elem() == typ && !val.IsNil():
+		return val.Elem(), true
+	case typ.Kind() == reflect.Ptr && typ.Elem() == val.Type():
+		ptr := reflect.New(val.Type())
+		ptr.Elem().Set(val)
+		return ptr, true
+	}
+	return reflect.Value{}, false
+}
+
+// convertJSONValue returns a copy of val as typ. A value decoded from JSON, for example an imported CRDT op log or a merge patch, is converted by encoding it as JSON and decoding it as typ.
+func convertJSONValue(val interface{}, typ reflect.Type) (reflect.Value, error) {
+	if val == nil {
+		return reflect.Zero(typ), nil
+	}
+	if reflect.TypeOf(val) == typ {
+		return deepCopy(reflect.ValueOf(val)), nil
+	}
+	bts, err := json.Marshal(val)
+	if err != nil {
+		return reflect.Value{}, errors.New("converting value to " + typ.String() + ": " + err.Error())
+	}
+	converted := reflect.New(typ)
+	if err := json.Unmarshal(bts, converted.Interface()); err != nil {
+		return reflect.Value{}, errors.New("converting value to " + typ.String() + ": " + err.Error())
+	}
+	return converted.Elem(), nil
+}
@@ -0,0 +1,152 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeepCopy(t *testing.T) {
+	type B struct {
+		C int `json:"c"`
+	}
+	type A struct {
+		S   []B            `json:"s"`
+		M   map[string]*B  `json:"m"`
+		P   *B             `json:"p"`
+		I   interface{}    `json:"i"`
+		Arr [2][]int       `json:"arr"`
+		N   map[string]int `json:"n"`
+		u   []int
+	}
+
+	orig := A{
+		S:   []B{{C: 1}, {C: 2}},
+		M:   map[string]*B{"x": {C: 3}},
+		P:   &B{C: 4},
+		I:   []int{5},
+		Arr: [2][]int{{6}, {7}},
+		u:   []int{8},
+	}
+
+	cp := deepCopy(reflect.ValueOf(orig)).Interface().(A)
+	if !reflect.DeepEqual(orig, cp) {
+		t.Fatalf("deepCopy expected %+v actual %+v", orig, cp)
+	}
+
+	cp.S[0].C = 10
+	cp.M["x"].C = 30
+	cp.P.C = 40
+	cp.I.([]int)[0] = 50
+	cp.Arr[0][0] = 60
+
+	if orig.S[0].C != 1 {
+		t.Errorf("deepCopy slice shared with original, orig.S[0].C expected %+v actual %+v", 1, orig.S[0].C)
+	}
+	if orig.M["x"].C != 3 {
+		t.Errorf("deepCopy map shared with original, orig.M[x].C expected %+v actual %+v", 3, orig.M["x"].C)
+	}
+	if orig.P.C != 4 {
+		t.Errorf("deepCopy pointer shared with original, orig.P.C expected %+v actual %+v", 4, orig.P.C)
+	}
+	if orig.I.([]int)[0] != 5 {
+		t.Errorf("deepCopy interface shared with original, orig.I[0] expected %+v actual %+v", 5, orig.I)
+	}
+	if orig.Arr[0][0] != 6 {
+		t.Errorf("deepCopy array shared with original, orig.Arr[0][0] expected %+v actual %+v", 6, orig.Arr[0][0])
+	}
+	if cp.N != nil {
+		t.Errorf("deepCopy nil map expected nil, actual %+v", cp.N)
+	}
+}
+
+func TestDeepCopyCycle(t *testing.T) {
+	type Node struct {
+		Name string           `json:"name"`
+		Next *Node            `json:"next"`
+		Refs map[string]*Node `json:"refs"`
+	}
+
+	a := &Node{Name: "a"}
+	b := &Node{Name: "b", Next: a}
+	a.Next = b
+	a.Refs = map[string]*Node{"self": a, "b": b}
+
+	cp := deepCopy(reflect.ValueOf(a)).Interface().(*Node)
+
+	if cp == a || cp.Next == b {
+		t.Fatalf("deepCopy cycle expected new pointers, actual %p %p", cp, cp.Next)
+	}
+	if cp.Next.Next != cp {
+		t.Errorf("deepCopy cycle expected cp.Next.Next == cp, actual %p %p", cp.Next.Next, cp)
+	}
+	if cp.Refs["self"] != cp || cp.Refs["b"] != cp.Next {
+		t.Errorf("deepCopy shared pointers expected to be shared in the copy, actual %+v", cp.Refs)
+	}
+	if cp.Name != "a" || cp.Next.Name != "b" {
+		t.Errorf("deepCopy cycle expected names a b, actual %+v %+v", cp.Name, cp.Next.Name)
+	}
+}
+
+// testValueCloner is a PatchCloner with a value receiver, whose Clone returns its own type rather than a pointer.
+type testValueCloner struct {
+	vals []int
+}
+
+func (v testValueCloner) Clone() interface{} {
+	return testValueCloner{vals: append([]int(nil), v.vals...)}
+}
+
+// testWrongCloner is a PatchCloner whose Clone returns an unrelated type.
+type testWrongCloner struct {
+	Vals []int `json:"vals"`
+}
+
+func (w *testWrongCloner) Clone() interface{} {
+	return "wrong"
+}
+
+func TestDeepCopyPatchCloner(t *testing.T) {
+	type TestObj struct {
+		V  testValueCloner  `json:"v"`
+		PV *testValueCloner `json:"pv"`
+		NV *testValueCloner `json:"nv"`
+		M  testOrderedMap   `json:"m"`
+		PM *testOrderedMap  `json:"pm"`
+		W  testWrongCloner  `json:"w"`
+		PW *testWrongCloner `json:"pw"`
+	}
+
+	orig := TestObj{
+		V:  testValueCloner{vals: []int{1}},
+		PV: &testValueCloner{vals: []int{2}},
+		M:  testOrderedMap{keys: []string{"a"}, vals: map[string]int{"a": 1}},
+		PM: &testOrderedMap{keys: []string{"b"}, vals: map[string]int{"b": 2}},
+		W:  testWrongCloner{Vals: []int{3}},
+		PW: &testWrongCloner{Vals: []int{4}},
+	}
+
+	cp := deepCopy(reflect.ValueOf(orig)).Interface().(TestObj)
+	if !reflect.DeepEqual(orig, cp) {
+		t.Fatalf("deepCopy expected %+v actual %+v", orig, cp)
+	}
+	if cp.PV == orig.PV || cp.PM == orig.PM || cp.PW == orig.PW {
+		t.Fatalf("deepCopy expected new pointers, actual %p %p %p", cp.PV, cp.PM, cp.PW)
+	}
+
+	cp.V.vals[0] = 10
+	cp.PV.vals[0] = 20
+	cp.M.vals["a"] = 10
+	cp.PM.vals["b"] = 20
+	cp.W.Vals[0] = 30
+	cp.PW.Vals[0] = 40
+
+	if orig.V.vals[0] != 1 || orig.PV.vals[0] != 2 {
+		t.Errorf("deepCopy value receiver Clone shared with original, expected 1 2 actual %+v %+v", orig.V.vals[0], orig.PV.vals[0])
+	}
+	if orig.M.vals["a"] != 1 || orig.PM.vals["b"] != 2 {
+		t.Errorf("deepCopy pointer receiver Clone shared with original, expected 1 2 actual %+v %+v", orig.M.vals["a"], orig.PM.vals["b"])
+	}
+	if orig.W.Vals[0] != 3 || orig.PW.Vals[0] != 4 {
+		t.Errorf("deepCopy wrong Clone type expected reflective copy, expected 3 4 actual %+v %+v", orig.W.Vals[0], orig.PW.Vals[0])
+	}
+}
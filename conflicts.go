@@ -0,0 +1,210 @@
+package jsonpatch
+
+import (
+	"strconv"
+)
+
+// OverlapKind is how two ops interfere.
+type OverlapKind string
+
+const (
+	// OverlapKindWrite is two ops which write overlapping values.
+	OverlapKindWrite = OverlapKind("write")
+	// OverlapKindRead is an op which reads a value the other op writes, with a test op or the from of a move or copy.
+	OverlapKindRead = OverlapKind("read")
+	// OverlapKindShift is an op which may insert or remove a slice element, shifting the index of a slice element the other op accesses.
+	OverlapKindShift = OverlapKind("shift")
+)
+
+// Overlap is a pair of ops, one from each patch, which interfere, so the patches may have different results depending on the order they're applied.
+type Overlap struct {
+	// A and B are the indexes of the ops in the first and second patch.
+	A int
+	B int
+	// Path is the pointer where the ops interfere: the shorter of the overlapping paths, or the slice whose indexes are shifted.
+	Path string
+	Kind OverlapKind
+}
+
+// Conflicts returns the pairs of ops in a and b which interfere. If it's empty, the patches commute: they may be applied in either order, or in parallel to different copies of an object, with the same result.
+//
+// The analysis doesn't know the object, so it's conservative:
+//   - Every op writes its path, and a move also writes its from. A test op reads its path, and a move or copy reads its from.
+//   - Two ops interfere if one writes a value which contains, equals, or is contained by a value the other reads or writes.
+//   - An add, move, or copy to a path ending in an index or "-", or a remove or move from a path ending in an index, may insert or remove a slice element. It interferes with ops on elements of the same slice at or after that index. A "-" may append at any index, so it interferes with ops on every element.
+//   - A WildcardToken may match any token, so it's treated as equal to every token, and as any slice index. So is a key selector, except that key selectors on the same field with different values select different elements.
+//   - A path which can't be parsed is treated as the root, which interferes with every op.
+//
+// Each pair of ops is reported once, with the first way they interfere.
+func Conflicts(a JSONPatch, b JSONPatch) []Overlap {
+	aAccesses := make([][]opAccess, len(a))
+	for i, op := range a {
+		aAccesses[i] = getOpAccesses(op)
+	}
+	bAccesses := make([][]opAccess, len(b))
+	for i, op := range b {
+		bAccesses[i] = getOpAccesses(op)
+	}
+
+	overlaps := []Overlap{}
+	for i := range a {
+		for j := range b {
+			if overlap, ok := getOverlap(aAccesses[i], bAccesses[j]); ok {
+				overlap.A = i
+				overlap.B = j
+				overlaps = append(overlaps, overlap)
+			}
+		}
+	}
+	return overlaps
+}
+
+// Commute returns whether the patches a and b commute, i.e. Conflicts returns no overlaps.
+func Commute(a JSONPatch, b JSONPatch) bool {
+	return len(Conflicts(a, b)) == 0
+}
+
+// opAccess is a path an op reads or writes.
+type opAccess struct {
+	path  []string
+	write bool
+	// shift is whether the access may insert or remove a slice element at the last path token.
+	shift bool
+}
+
+// getOpAccesses returns the paths the op reads and writes.
+func getOpAccesses(op JSONPatchOp) []opAccess {
+	path := parseAccessPath(op.Path)
+	switch op.Op {
+	case OpTypeTest:
+		return []opAccess{{path: path}}
+	case OpTypeRemove:
+		return []opAccess{{path: path, write: true, shift: isIndexToken(path, false)}}
+	case OpTypeReplace:
+		return []opAccess{{path: path, write: true}}
+	case OpTypeMove:
+		from := parseAccessPath(op.From)
+		return []opAccess{
+			{path: from, write: true, shift: isIndexToken(from, false)},
+			{path: path, write: true, shift: isIndexToken(path, true)},
+		}
+	case OpTypeCopy:
+		return []opAccess{
+			{path: parseAccessPath(op.From)},
+			{path: path, write: true, shift: isIndexToken(path, true)},
+		}
+	case OpTypeAdd:
+		return []opAccess{{path: path, write: true, shift: isIndexToken(path, true)}}
+	}
+	// custom ops may do anything at their path
+	return []opAccess{{path: path, write: true}}
+}
+
+// parseAccessPath parses the path, or returns the root if it can't be parsed.
+func parseAccessPath(path string) []string {
+	parts, err := ParsePath(path)
+	if err != nil {
+		return []string{}
+	}
+	return parts
+}
+
+// isIndexToken returns whether the last token of path may be a slice index, or "-" if dash is true.
+func isIndexToken(path []string, dash bool) bool {
+	if len(path) == 0 {
+		return false
+	}
+	_, ok := getAccessIndex(path[len(path)-1], dash)
+	return ok
+}
+
+// getAccessIndex returns the slice index the token may access, and whether it may be one. A "-" if dash is true, a WildcardToken, and a key selector may be any index, and are returned as -1.
+func getAccessIndex(token string, dash bool) (int, bool) {
+	if _, _, ok := parseKeySelector(token); ok || token == WildcardToken {
+		return -1, true
+	}
+	return getIndexToken(token, dash)
+}
+
+// isAccessPathPrefix returns whether prefix may be a prefix of path, with tokens compared by isAccessToken.
+func isAccessPathPrefix(prefix []string, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i, token := range prefix {
+		if !isAccessToken(token, path[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAccessToken returns whether the path tokens a and b may access the same value.
+func isAccessToken(a string, b string) bool {
+	if a == b || a == WildcardToken || b == WildcardToken {
+		return true
+	}
+	aField, aValue, aOK := parseKeySelector(a)
+	bField, bValue, bOK := parseKeySelector(b)
+	if aOK && bOK && aField == bField {
+		return aValue == bValue
+	}
+	return aOK || bOK
+}
+
+// getIndexToken returns the slice index of the token, and whether it may be one. The "-" is returned as -1, if dash is true.
+func getIndexToken(token string, dash bool) (int, bool) {
+	if token == "-" {
+		return -1, dash
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') || token[0] == '+' {
+		return 0, false
+	}
+	return i, true
+}
+
+// getOverlap returns how the accesses of two ops interfere, if they do.
+func getOverlap(aAccesses []opAccess, bAccesses []opAccess) (Overlap, bool) {
+	for _, aAccess := range aAccesses {
+		for _, bAccess := range bAccesses {
+			if !aAccess.write && !bAccess.write {
+				continue
+			}
+			if isAccessPathPrefix(aAccess.path, bAccess.path) || isAccessPathPrefix(bAccess.path, aAccess.path) {
+				path := aAccess.path
+				if len(bAccess.path) < len(path) {
+					path = bAccess.path
+				}
+				kind := OverlapKindWrite
+				if !aAccess.write || !bAccess.write {
+					kind = OverlapKindRead
+				}
+				return Overlap{Path: FormatPath(path), Kind: kind}, true
+			}
+			for _, pair := range [][2]opAccess{{aAccess, bAccess}, {bAccess, aAccess}} {
+				if isShifted(pair[0], pair[1].path) {
+					return Overlap{Path: FormatPath(pair[0].path[:len(pair[0].path)-1]), Kind: OverlapKindShift}, true
+				}
+			}
+		}
+	}
+	return Overlap{}, false
+}
+
+// isShifted returns whether the access may insert or remove a slice element which shifts the index of a slice element on path.
+func isShifted(access opAccess, path []string) bool {
+	if !access.shift {
+		return false
+	}
+	parent := access.path[:len(access.path)-1]
+	if len(path) <= len(parent) || !isAccessPathPrefix(parent, path) {
+		return false
+	}
+	pathIndex, ok := getAccessIndex(path[len(parent)], true)
+	if !ok {
+		return false
+	}
+	accessIndex, _ := getAccessIndex(access.path[len(access.path)-1], true)
+	return accessIndex == -1 || pathIndex == -1 || pathIndex >= accessIndex
+}
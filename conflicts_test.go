@@ -0,0 +1,130 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        JSONPatch
+		b        JSONPatch
+		expected []Overlap
+	}{
+		{
+			"wildcard",
+			JSONPatch{{Op: OpTypeReplace, Path: "/servers/*/enabled", Value: true}, {Op: OpTypeRemove, Path: "/tags/*"}},
+			JSONPatch{{Op: OpTypeReplace, Path: "/servers/0/enabled", Value: false}, {Op: OpTypeReplace, Path: "/servers/0/name", Value: "a"}, {Op: OpTypeTest, Path: "/tags/3", Value: "b"}},
+			[]Overlap{{A: 0, B: 0, Path: "/servers/*/enabled", Kind: OverlapKindWrite}, {A: 1, B: 2, Path: "/tags/*", Kind: OverlapKindRead}},
+		},
+		{
+			"key selector",
+			JSONPatch{{Op: OpTypeRemove, Path: "/servers/[name=web]"}, {Op: OpTypeReplace, Path: "/servers/[name=db]/port", Value: 1}},
+			JSONPatch{{Op: OpTypeReplace, Path: "/servers/0/enabled", Value: true}, {Op: OpTypeReplace, Path: "/servers/[name=api]/port", Value: 2}},
+			[]Overlap{{A: 0, B: 0, Path: "/servers/[name=web]", Kind: OverlapKindWrite}, {A: 0, B: 1, Path: "/servers", Kind: OverlapKindShift}},
+		},
+		{
+			"independent",
+			JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "a"}, {Op: OpTypeAdd, Path: "/ports/http", Value: 80}},
+			JSONPatch{{Op: OpTypeReplace, Path: "/names", Value: "b"}, {Op: OpTypeRemove, Path: "/ports/https"}, {Op: OpTypeTest, Path: "/count", Value: 1}},
+			[]Overlap{},
+		},
+		{
+			"same path",
+			JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "a"}},
+			JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "b"}},
+			[]Overlap{{A: 0, B: 0, Path: "/name", Kind: OverlapKindWrite}},
+		},
+		{
+			"parent",
+			JSONPatch{{Op: OpTypeReplace, Path: "/server", Value: 1}, {Op: OpTypeReplace, Path: "/other", Value: 1}},
+			JSONPatch{{Op: OpTypeRemove, Path: "/other/a"}, {Op: OpTypeReplace, Path: "/server/port", Value: 2}},
+			[]Overlap{{A: 0, B: 1, Path: "/server", Kind: OverlapKindWrite}, {A: 1, B: 0, Path: "/other", Kind: OverlapKindWrite}},
+		},
+		{
+			"reads",
+			JSONPatch{{Op: OpTypeTest, Path: "/server/port", Value: 1}, {Op: OpTypeCopy, From: "/backup", Path: "/copy"}, {Op: OpTypeTest, Path: "/name", Value: "a"}},
+			JSONPatch{{Op: OpTypeReplace, Path: "/server", Value: 1}, {Op: OpTypeReplace, Path: "/backup/host", Value: "b"}, {Op: OpTypeTest, Path: "/name", Value: "a"}},
+			[]Overlap{{A: 0, B: 0, Path: "/server", Kind: OverlapKindRead}, {A: 1, B: 1, Path: "/backup", Kind: OverlapKindRead}},
+		},
+		{
+			"move from",
+			JSONPatch{{Op: OpTypeMove, From: "/a", Path: "/b"}},
+			JSONPatch{{Op: OpTypeTest, Path: "/a/x", Value: 1}, {Op: OpTypeReplace, Path: "/c", Value: 1}},
+			[]Overlap{{A: 0, B: 0, Path: "/a", Kind: OverlapKindRead}},
+		},
+		{
+			"insert shifts later indexes",
+			JSONPatch{{Op: OpTypeAdd, Path: "/tags/2", Value: "x"}},
+			JSONPatch{{Op: OpTypeReplace, Path: "/tags/1", Value: "a"}, {Op: OpTypeReplace, Path: "/tags/3", Value: "b"}, {Op: OpTypeTest, Path: "/tags/5/name", Value: "c"}, {Op: OpTypeReplace, Path: "/other/3", Value: "d"}},
+			[]Overlap{{A: 0, B: 1, Path: "/tags", Kind: OverlapKindShift}, {A: 0, B: 2, Path: "/tags", Kind: OverlapKindShift}},
+		},
+		{
+			"remove shifts later indexes",
+			JSONPatch{{Op: OpTypeReplace, Path: "/tags/0", Value: "a"}, {Op: OpTypeReplace, Path: "/tags/4", Value: "b"}},
+			JSONPatch{{Op: OpTypeRemove, Path: "/tags/3"}},
+			[]Overlap{{A: 1, B: 0, Path: "/tags", Kind: OverlapKindShift}},
+		},
+		{
+			"append",
+			JSONPatch{{Op: OpTypeAdd, Path: "/tags/-", Value: "a"}},
+			JSONPatch{{Op: OpTypeAdd, Path: "/tags/-", Value: "b"}, {Op: OpTypeTest, Path: "/tags/0", Value: "c"}, {Op: OpTypeReplace, Path: "/tags", Value: nil}},
+			[]Overlap{{A: 0, B: 0, Path: "/tags/-", Kind: OverlapKindWrite}, {A: 0, B: 1, Path: "/tags", Kind: OverlapKindShift}, {A: 0, B: 2, Path: "/tags", Kind: OverlapKindWrite}},
+		},
+		{
+			"map keys aren't indexes",
+			JSONPatch{{Op: OpTypeAdd, Path: "/ports/http", Value: 80}, {Op: OpTypeAdd, Path: "/tags/01", Value: 1}},
+			JSONPatch{{Op: OpTypeReplace, Path: "/ports/https", Value: 443}, {Op: OpTypeReplace, Path: "/tags/5", Value: 1}},
+			[]Overlap{},
+		},
+		{
+			"unparseable path is root",
+			JSONPatch{{Op: OpTypeReplace, Path: "no-slash", Value: 1}},
+			JSONPatch{{Op: OpTypeTest, Path: "/a", Value: 1}},
+			[]Overlap{{A: 0, B: 0, Path: "", Kind: OverlapKindRead}},
+		},
+		{
+			"custom op",
+			JSONPatch{{Op: "increment", Path: "/count", Value: 1}},
+			JSONPatch{{Op: "increment", Path: "/count", Value: 1}},
+			[]Overlap{{A: 0, B: 0, Path: "/count", Kind: OverlapKindWrite}},
+		},
+	}
+
+	for _, test := range tests {
+		actual := Conflicts(test.a, test.b)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Conflicts %v expected %+v actual %+v", test.name, test.expected, actual)
+		}
+		if Commute(test.a, test.b) != (len(test.expected) == 0) {
+			t.Errorf("Commute %v expected %+v actual %+v", test.name, len(test.expected) == 0, !(len(test.expected) == 0))
+		}
+	}
+}
+
+// TestConflictsCommute checks patches which Conflicts says commute have the same result in either order.
+func TestConflictsCommute(t *testing.T) {
+	type TestObj struct {
+		Name  string         `json:"name"`
+		Tags  []string       `json:"tags"`
+		Ports map[string]int `json:"ports"`
+	}
+	a := JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "a"}, {Op: OpTypeCopy, From: "/tags/2", Path: "/tags/1"}}
+	b := JSONPatch{{Op: OpTypeAdd, Path: "/ports/http", Value: 80}, {Op: OpTypeReplace, Path: "/tags/0", Value: "b"}}
+	if !Commute(a, b) {
+		t.Fatalf("Commute expected true actual %+v", Conflicts(a, b))
+	}
+
+	ab := TestObj{Tags: []string{"x", "y", "z"}, Ports: map[string]int{}}
+	ba := TestObj{Tags: []string{"x", "y", "z"}, Ports: map[string]int{}}
+	if err := Apply(append(append(JSONPatch{}, a...), b...), &ab); err != nil {
+		t.Fatalf("Apply a b error expected nil actual %+v", err)
+	}
+	if err := Apply(append(append(JSONPatch{}, b...), a...), &ba); err != nil {
+		t.Fatalf("Apply b a error expected nil actual %+v", err)
+	}
+	if !reflect.DeepEqual(ab, ba) {
+		t.Errorf("Commute patches expected same result actual %+v %+v", ab, ba)
+	}
+}
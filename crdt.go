@@ -0,0 +1,795 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// CRDTID is a logical timestamp, which identifies a CRDTOp, and orders concurrent ops. IDs are ordered by Counter, then Replica.
+type CRDTID struct {
+	Counter uint64 `json:"counter"`
+	Replica string `json:"replica"`
+}
+
+// Less returns whether id is before other.
+func (id CRDTID) Less(other CRDTID) bool {
+	if id.Counter != other.Counter {
+		return id.Counter < other.Counter
+	}
+	return id.Replica < other.Replica
+}
+
+func (id CRDTID) String() string {
+	return strconv.FormatUint(id.Counter, 10) + "@" + id.Replica
+}
+
+// CRDTOpKind is the kind of a CRDTOp.
+type CRDTOpKind string
+
+const (
+	// CRDTOpKindSet sets the last-writer-wins register at Path to Value.
+	CRDTOpKindSet = CRDTOpKind("set")
+	// CRDTOpKindMapAdd adds Key to the observed-remove map at Path with Value. The op ID tags the add.
+	CRDTOpKindMapAdd = CRDTOpKind("mapAdd")
+	// CRDTOpKindMapRemove removes the adds of Key to the map at Path which were observed, the Tags. Concurrent adds aren't removed.
+	CRDTOpKindMapRemove = CRDTOpKind("mapRemove")
+	// CRDTOpKindSeqInsert inserts Value into the sequence at Path, after the element After, or at the start if After is nil. The op ID is the new element ID.
+	CRDTOpKindSeqInsert = CRDTOpKind("seqInsert")
+	// CRDTOpKindSeqRemove removes the element Elem from the sequence at Path.
+	CRDTOpKindSeqRemove = CRDTOpKind("seqRemove")
+	// CRDTOpKindSeqSet sets the last-writer-wins value of the element Elem of the sequence at Path to Value.
+	CRDTOpKindSeqSet = CRDTOpKind("seqSet")
+)
+
+// CRDTOp is an operation on a CRDTDocument. The Path is a JSON Pointer to a register, map, or sequence, through struct fields.
+type CRDTOp struct {
+	ID    CRDTID      `json:"id"`
+	Kind  CRDTOpKind  `json:"kind"`
+	Path  string      `json:"path"`
+	Key   string      `json:"key,omitempty"`
+	Tags  []CRDTID    `json:"tags,omitempty"`
+	Elem  *CRDTID     `json:"elem,omitempty"`
+	After *CRDTID     `json:"after,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// CRDTDocument is a document of type T which is replicated without coordination. Each replica applies patches locally, and exchanges the resulting ops with Ops and Import.
+// Replicas which start from the same value and import the same ops, in any order, converge to the same value.
+//
+// Each JSONPatchOp is turned into ops on the CRDT the value is stored in, which is built from the type T:
+//   - A struct with fields with json tags is a struct of CRDTs. Fields which can't be addressed by a path keep their initial values.
+//   - A map with string or integer keys is an observed-remove map, where an add which is concurrent with a remove wins. Its values are last-writer-wins registers.
+//   - A slice is an RGA sequence, where concurrent inserts at the same place are ordered by their IDs. Its elements are last-writer-wins registers.
+//   - Any other value, including pointers, is a last-writer-wins register.
+//
+// An op on a member of a register, for example a field of a struct in a map, sets the whole register. An empty map or slice is nil if it was nil initially.
+// An add op on a slice element inserts it, and a remove op removes it, per RFC 6902, regardless of the Patcher Options.
+type CRDTDocument[T any] struct {
+	mu      sync.Mutex
+	replica string
+	clock   uint64
+	initial T // to rebuild the CRDT from, if a local patch fails part way
+	root    crdtNode
+	patcher *Patcher
+
+	log     []CRDTOp
+	applied map[CRDTID]bool
+	pending []CRDTOp // remote ops whose sequence element hasn't been inserted yet
+}
+
+// NewCRDTDocument returns a CRDTDocument for the replica, which must have a unique non-empty ID, starting from a copy of initial.
+// Every replica must start from the same initial value.
+func NewCRDTDocument[T any](replica string, initial T) (*CRDTDocument[T], error) {
+	return NewCRDTDocumentWithPatcher(replica, initial, &Patcher{})
+}
+
+// NewCRDTDocumentWithPatcher returns a CRDTDocument like NewCRDTDocument, which applies patches with the Patcher, for example to apply custom ops.
+func NewCRDTDocumentWithPatcher[T any](replica string, initial T, patcher *Patcher) (*CRDTDocument[T], error) {
+	if replica == "" {
+		return nil, errors.New("replica ID must not be empty")
+	}
+	return &CRDTDocument[T]{
+		replica: replica,
+		initial: copyDocumentVal(initial),
+		root:    newCRDTNode(reflect.ValueOf(&initial).Elem()),
+		patcher: patcher,
+		applied: map[CRDTID]bool{},
+	}, nil
+}
+
+// crdtNode is a *crdtRegister, *crdtStruct, *crdtMap, or *crdtSeq.
+type crdtNode interface {
+	materialize() reflect.Value
+}
+
+type crdtRegister struct {
+	id  CRDTID
+	val reflect.Value
+}
+
+type crdtStruct struct {
+	base   reflect.Value // the initial value, for fields which aren't CRDTs
+	fields map[string]crdtNode
+	index  map[string]int
+}
+
+type crdtMap struct {
+	typ     reflect.Type
+	wasNil  bool
+	entries map[string]*crdtMapEntry
+}
+
+// crdtMapEntry is a map key. It exists if it has any adds, and its value is the value of the latest add.
+type crdtMapEntry struct {
+	adds    map[CRDTID]reflect.Value
+	removed map[CRDTID]bool // so an add which arrives after its remove isn't added
+}
+
+type crdtSeq struct {
+	typ    reflect.Type
+	wasNil bool
+	elems  []*crdtSeqElem
+}
+
+type crdtSeqElem struct {
+	id      CRDTID
+	reg     crdtRegister
+	removed bool
+}
+
+// newCRDTNode returns the CRDT for the initial value val. Initial map adds and sequence elements have IDs with a Counter of 0, which is before every op.
+func newCRDTNode(val reflect.Value) crdtNode {
+	switch val.Kind() {
+	case reflect.Struct:
+		n := &crdtStruct{base: deepCopy(val), fields: map[string]crdtNode{}, index: map[string]int{}}
+		for i := 0; i < val.NumField(); i++ {
+			if field := val.Type().Field(i); isPathField(field) {
+				n.fields[field.Tag.Get("json")] = newCRDTNode(val.Field(i))
+				n.index[field.Tag.Get("json")] = i
+			}
+		}
+		if len(n.fields) > 0 {
+			return n
+		}
+	case reflect.Map:
+		n := &crdtMap{typ: val.Type(), wasNil: val.IsNil(), entries: map[string]*crdtMapEntry{}}
+		iter := val.MapRange()
+		ok := true
+		for iter.Next() {
+			token, err := formatMapKey(iter.Key())
+			if err != nil {
+				ok = false
+				break
+			}
+			n.entries[token] = &crdtMapEntry{adds: map[CRDTID]reflect.Value{{}: deepCopy(iter.Value())}, removed: map[CRDTID]bool{}}
+		}
+		if ok {
+			return n
+		}
+	case reflect.Slice:
+		n := &crdtSeq{typ: val.Type(), wasNil: val.IsNil()}
+		for i := 0; i < val.Len(); i++ {
+			id := CRDTID{Replica: strconv.Itoa(i)}
+			n.elems = append(n.elems, &crdtSeqElem{id: id, reg: crdtRegister{id: id, val: deepCopy(val.Index(i))}})
+		}
+		return n
+	}
+	return &crdtRegister{val: deepCopy(val)}
+}
+
+func (n *crdtRegister) materialize() reflect.Value {
+	return deepCopy(n.val)
+}
+
+func (n *crdtStruct) materialize() reflect.Value {
+	val := deepCopy(n.base)
+	for tag, field := range n.fields {
+		val.Field(n.index[tag]).Set(field.materialize())
+	}
+	return val
+}
+
+func (n *crdtMap) materialize() reflect.Value {
+	tokens := n.visibleKeys()
+	if len(tokens) == 0 && n.wasNil {
+		return reflect.Zero(n.typ)
+	}
+	val := reflect.MakeMapWithSize(n.typ, len(tokens))
+	for _, token := range tokens {
+		key, _ := ConvertKeyToType(token, n.typ.Key()) // the token was formatted from a key of this type
+		elem, _ := n.entries[token].value()
+		val.SetMapIndex(key, deepCopy(elem))
+	}
+	return val
+}
+
+func (n *crdtMap) visibleKeys() []string {
+	tokens := []string{}
+	for token, entry := range n.entries {
+		if len(entry.adds) > 0 {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// value returns the value of the latest add, and whether the entry exists.
+func (e *crdtMapEntry) value() (reflect.Value, bool) {
+	latest := CRDTID{}
+	val := reflect.Value{}
+	for id, addVal := range e.adds {
+		if !val.IsValid() || latest.Less(id) {
+			latest = id
+			val = addVal
+		}
+	}
+	return val, val.IsValid()
+}
+
+func (n *crdtSeq) materialize() reflect.Value {
+	visible := n.visible()
+	if len(visible) == 0 && n.wasNil {
+		return reflect.Zero(n.typ)
+	}
+	val := reflect.MakeSlice(n.typ, len(visible), len(visible))
+	for i, elem := range visible {
+		val.Index(i).Set(deepCopy(elem.reg.val))
+	}
+	return val
+}
+
+func (n *crdtSeq) visible() []*crdtSeqElem {
+	visible := []*crdtSeqElem{}
+	for _, elem := range n.elems {
+		if !elem.removed {
+			visible = append(visible, elem)
+		}
+	}
+	return visible
+}
+
+func (n *crdtSeq) find(id CRDTID) int {
+	for i, elem := range n.elems {
+		if elem.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Value returns a copy of the current value of the document.
+func (d *CRDTDocument[T]) Value() T {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.value()
+}
+
+func (d *CRDTDocument[T]) value() T {
+	return d.root.materialize().Interface().(T)
+}
+
+// Ops returns the ops this replica has applied, local and imported, in the order they were applied.
+// Importing them into another replica makes it converge with this one.
+func (d *CRDTDocument[T]) Ops() []CRDTOp {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]CRDTOp(nil), d.log...)
+}
+
+// Apply applies the patch to the document, recording the ops it produces, to be sent to the other replicas.
+// If any op fails, the document is unchanged, and the error is returned.
+func (d *CRDTDocument[T]) Apply(patch JSONPatch) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	validator := &Patcher{Options: d.patcher.Options, ops: d.patcher.ops}
+	validator.Options.InsertOnAdd = true
+	validator.Options.ShiftOnRemove = true
+
+	// the whole patch is validated first, because ops are translated one at a time, and undoing them means rebuilding the CRDT
+	cur := d.value()
+	patched := copyDocumentVal(cur)
+	if err := validator.Apply(patch, &patched); err != nil {
+		return err
+	}
+
+	logLen, clock := len(d.log), d.clock
+	for _, patchOp := range patch {
+		if err := d.translatePatchOp(validator, patchOp, &cur); err != nil {
+			d.rollback(logLen, clock)
+			return err
+		}
+	}
+	return nil
+}
+
+// translatePatchOp applies patchOp to cur, the document value, and emits the CRDT ops it translates to.
+func (d *CRDTDocument[T]) translatePatchOp(validator *Patcher, patchOp JSONPatchOp, cur *T) error {
+	// wildcards are expanded and key selectors resolved, so the op translates to the elements it was applied to
+	scratch := copyDocumentVal(*cur)
+	ops, err := validator.applyResolvedOp(reflect.ValueOf(&scratch).Elem(), patchOp)
+	if err != nil {
+		return errors.New("applying validated op: " + err.Error())
+	}
+	for _, op := range ops {
+		next := copyDocumentVal(*cur)
+		if err := validator.Apply(JSONPatch{op}, &next); err != nil {
+			return errors.New("applying validated op: " + err.Error())
+		}
+		if err := d.translateOp(op, reflect.ValueOf(&next).Elem()); err != nil {
+			return errors.New("translating op to CRDT ops: " + err.Error())
+		}
+		*cur = next
+	}
+	return nil
+}
+
+// rollback discards the ops emitted after the first logLen ops of the log, and restores the clock.
+// CRDT ops can't be undone, so the CRDT is rebuilt from the initial value and the ops which are kept. Pending ops weren't applied, so they're kept as is.
+func (d *CRDTDocument[T]) rollback(logLen int, clock uint64) {
+	kept := d.log[:logLen]
+	initial := copyDocumentVal(d.initial)
+	d.root = newCRDTNode(reflect.ValueOf(&initial).Elem())
+	d.log = make([]CRDTOp, 0, len(kept))
+	d.applied = map[CRDTID]bool{}
+	for _, op := range kept {
+		// each op was applied in this order before, so it applies again
+		d.applyCRDTOp(op)
+		d.log = append(d.log, op)
+		d.applied[op.ID] = true
+	}
+	d.clock = clock
+}
+
+// crdtLocation is where a path is in the CRDT.
+type crdtLocation struct {
+	// node is the node at nodePath, if the location isn't in a map or sequence.
+	node     crdtNode
+	nodePath []string
+	// container is the *crdtMap or *crdtSeq at nodePath, if the location is in one, and token is the map key or sequence index.
+	container crdtNode
+	token     string
+}
+
+// locate returns where the path is in the CRDT. A path inside a register, or inside a map value or sequence element, returns the register, value, or element.
+func (d *CRDTDocument[T]) locate(path []string) (crdtLocation, error) {
+	node := d.root
+	nodePath := []string{}
+	for _, token := range path {
+		switch n := node.(type) {
+		case *crdtStruct:
+			field, ok := n.fields[token]
+			if !ok {
+				return crdtLocation{}, errors.New("no field '" + token + "'")
+			}
+			node = field
+			nodePath = append(nodePath, token)
+		case *crdtMap, *crdtSeq:
+			return crdtLocation{nodePath: nodePath, container: n, token: token}, nil
+		case *crdtRegister:
+			return crdtLocation{node: n, nodePath: nodePath}, nil
+		}
+	}
+	return crdtLocation{node: node, nodePath: nodePath}, nil
+}
+
+// translateOp emits the CRDT ops for the JSON Patch op, which produced the value next.
+func (d *CRDTDocument[T]) translateOp(op JSONPatchOp, next reflect.Value) error {
+	if op.Op == OpTypeTest {
+		return nil
+	}
+	path, err := ParsePath(op.Path)
+	if err != nil {
+		return err
+	}
+	if op.Op == OpTypeMove {
+		from, err := ParsePath(op.From)
+		if err != nil {
+			return err
+		}
+		if isPathPrefix(from, path) && len(from) == len(path) {
+			return nil
+		}
+		if err := d.translatePath(OpTypeRemove, from, next); err != nil {
+			return err
+		}
+		return d.translatePath(OpTypeAdd, path, next)
+	}
+	if op.Op == OpTypeCopy {
+		return d.translatePath(OpTypeAdd, path, next)
+	}
+	return d.translatePath(op.Op, path, next)
+}
+
+// translatePath emits the CRDT ops for an op of the given type at path, which produced the value next.
+// Custom op types are treated like replace.
+func (d *CRDTDocument[T]) translatePath(opType OpType, path []string, next reflect.Value) error {
+	loc, err := d.locate(path)
+	if err != nil {
+		return err
+	}
+	if loc.container == nil {
+		val, _, err := getValAt(loc.nodePath, next, false)
+		if err != nil {
+			return err
+		}
+		return d.assign(loc.node, loc.nodePath, val)
+	}
+
+	containerPath := FormatPath(loc.nodePath)
+	elemPath := append(loc.nodePath[:len(loc.nodePath):len(loc.nodePath)], loc.token)
+	isElem := len(elemPath) == len(path)
+
+	switch n := loc.container.(type) {
+	case *crdtMap:
+		entry, exists := n.entries[loc.token]
+		if opType == OpTypeRemove && isElem {
+			if !exists {
+				return nil // removing a missing key does nothing, unless Options.ErrorOnRemoveMissing, which was validated
+			}
+			return d.emit(CRDTOp{Kind: CRDTOpKindMapRemove, Path: containerPath, Key: loc.token, Tags: sortedCRDTIDs(entry.adds)})
+		}
+		val, _, err := getValAt(elemPath, next, false)
+		if err != nil {
+			return err
+		}
+		return d.emit(CRDTOp{Kind: CRDTOpKindMapAdd, Path: containerPath, Key: loc.token, Value: deepCopy(val).Interface()})
+
+	case *crdtSeq:
+		visible := n.visible()
+		if opType == OpTypeAdd && isElem {
+			i := len(visible)
+			if loc.token != "-" {
+				if i, err = strconv.Atoi(loc.token); err != nil {
+					return err
+				}
+			}
+			op := CRDTOp{Kind: CRDTOpKindSeqInsert, Path: containerPath}
+			if i > 0 {
+				after := visible[i-1].id
+				op.After = &after
+			}
+			val, _, err := getValAt(append(loc.nodePath[:len(loc.nodePath):len(loc.nodePath)], strconv.Itoa(i)), next, false)
+			if err != nil {
+				return err
+			}
+			op.Value = deepCopy(val).Interface()
+			return d.emit(op)
+		}
+		i, err := strconv.Atoi(loc.token)
+		if err != nil || i < 0 || i >= len(visible) {
+			return errors.New("no sequence element '" + loc.token + "'")
+		}
+		elem := visible[i].id
+		if opType == OpTypeRemove && isElem {
+			return d.emit(CRDTOp{Kind: CRDTOpKindSeqRemove, Path: containerPath, Elem: &elem})
+		}
+		val, _, err := getValAt(elemPath, next, false)
+		if err != nil {
+			return err
+		}
+		return d.emit(CRDTOp{Kind: CRDTOpKindSeqSet, Path: containerPath, Elem: &elem, Value: deepCopy(val).Interface()})
+	}
+	return errors.New("unknown CRDT container")
+}
+
+// assign emits the CRDT ops to set the node at path to val.
+func (d *CRDTDocument[T]) assign(node crdtNode, path []string, val reflect.Value) error {
+	switch n := node.(type) {
+	case *crdtRegister:
+		if reflect.DeepEqual(n.val.Interface(), val.Interface()) {
+			return nil
+		}
+		return d.emit(CRDTOp{Kind: CRDTOpKindSet, Path: FormatPath(path), Value: deepCopy(val).Interface()})
+
+	case *crdtStruct:
+		tags := make([]string, 0, len(n.fields))
+		for tag := range n.fields {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			if err := d.assign(n.fields[tag], append(path[:len(path):len(path)], tag), val.Field(n.index[tag])); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *crdtMap:
+		newKeys := map[string]reflect.Value{}
+		iter := val.MapRange()
+		for iter.Next() {
+			token, err := formatMapKey(iter.Key())
+			if err != nil {
+				return err
+			}
+			newKeys[token] = iter.Value()
+		}
+		for _, token := range n.visibleKeys() {
+			if _, ok := newKeys[token]; !ok {
+				if err := d.emit(CRDTOp{Kind: CRDTOpKindMapRemove, Path: FormatPath(path), Key: token, Tags: sortedCRDTIDs(n.entries[token].adds)}); err != nil {
+					return err
+				}
+			}
+		}
+		tokens := make([]string, 0, len(newKeys))
+		for token := range newKeys {
+			tokens = append(tokens, token)
+		}
+		sort.Strings(tokens)
+		for _, token := range tokens {
+			if entry, ok := n.entries[token]; ok {
+				if old, ok := entry.value(); ok && reflect.DeepEqual(old.Interface(), newKeys[token].Interface()) {
+					continue
+				}
+			}
+			if err := d.emit(CRDTOp{Kind: CRDTOpKindMapAdd, Path: FormatPath(path), Key: token, Value: deepCopy(newKeys[token]).Interface()}); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *crdtSeq:
+		if reflect.DeepEqual(n.materialize().Interface(), val.Interface()) {
+			return nil
+		}
+		for _, elem := range n.visible() {
+			id := elem.id
+			if err := d.emit(CRDTOp{Kind: CRDTOpKindSeqRemove, Path: FormatPath(path), Elem: &id}); err != nil {
+				return err
+			}
+		}
+		after := (*CRDTID)(nil)
+		for i := 0; i < val.Len(); i++ {
+			op := CRDTOp{Kind: CRDTOpKindSeqInsert, Path: FormatPath(path), After: after, Value: deepCopy(val.Index(i)).Interface()}
+			if err := d.emit(op); err != nil {
+				return err
+			}
+			id := CRDTID{Counter: d.clock, Replica: d.replica}
+			after = &id
+		}
+		return nil
+	}
+	return errors.New("unknown CRDT node")
+}
+
+func sortedCRDTIDs(ids map[CRDTID]reflect.Value) []CRDTID {
+	sorted := make([]CRDTID, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Less(sorted[j]) })
+	return sorted
+}
+
+// emit applies a new local op, with the next ID of the replica.
+func (d *CRDTDocument[T]) emit(op CRDTOp) error {
+	d.clock++
+	op.ID = CRDTID{Counter: d.clock, Replica: d.replica}
+	ready, err := d.applyCRDTOp(op)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return errors.New("local op " + op.ID.String() + " depends on a missing sequence element")
+	}
+	d.log = append(d.log, op)
+	d.applied[op.ID] = true
+	return nil
+}
+
+// Import applies ops from other replicas, in any order. Ops which were already applied are ignored.
+// A sequence op whose element hasn't been inserted yet is kept until it is, so ops may be imported before the ops they depend on.
+// Returns an error if an op is malformed, or doesn't match the document type. The ops before it are still applied.
+func (d *CRDTDocument[T]) Import(ops []CRDTOp) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, op := range ops {
+		if op.ID.Counter == 0 || op.ID.Replica == "" {
+			return errors.New("malformed op ID '" + op.ID.String() + "'")
+		}
+		if d.applied[op.ID] || d.isPending(op.ID) {
+			continue
+		}
+		if op.ID.Counter > d.clock {
+			d.clock = op.ID.Counter
+		}
+		ready, err := d.applyCRDTOp(op)
+		if err != nil {
+			return fmt.Errorf("importing op %v: %v", op.ID, err)
+		}
+		if !ready {
+			d.pending = append(d.pending, op)
+			continue
+		}
+		d.log = append(d.log, op)
+		d.applied[op.ID] = true
+		if err := d.applyPending(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *CRDTDocument[T]) isPending(id CRDTID) bool {
+	for _, op := range d.pending {
+		if op.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPending applies the pending ops which are ready, until none are.
+func (d *CRDTDocument[T]) applyPending() error {
+	for progress := true; progress; {
+		progress = false
+		remaining := d.pending[:0]
+		for _, op := range d.pending {
+			ready, err := d.applyCRDTOp(op)
+			if err != nil {
+				return fmt.Errorf("importing op %v: %v", op.ID, err)
+			}
+			if !ready {
+				remaining = append(remaining, op)
+				continue
+			}
+			d.log = append(d.log, op)
+			d.applied[op.ID] = true
+			progress = true
+		}
+		d.pending = remaining
+	}
+	return nil
+}
+
+// applyCRDTOp applies the op to the CRDT, and returns whether it was applied, or depends on a sequence element which doesn't exist yet.
+func (d *CRDTDocument[T]) applyCRDTOp(op CRDTOp) (bool, error) {
+	path, err := ParsePath(op.Path)
+	if err != nil {
+		return false, err
+	}
+	node := d.root
+	for _, token := range path {
+		n, ok := node.(*crdtStruct)
+		if !ok {
+			return false, errors.New("path '" + op.Path + "' isn't through struct fields")
+		}
+		if node, ok = n.fields[token]; !ok {
+			return false, errors.New("path '" + op.Path + "' has no field '" + token + "'")
+		}
+	}
+
+	switch op.Kind {
+	case CRDTOpKindSet:
+		n, ok := node.(*crdtRegister)
+		if !ok {
+			return false, errors.New("set path '" + op.Path + "' isn't a register")
+		}
+		val, err := convertJSONValue(op.Value, n.val.Type())
+		if err != nil {
+			return false, err
+		}
+		if n.id.Less(op.ID) {
+			n.id = op.ID
+			n.val = val
+		}
+		return true, nil
+
+	case CRDTOpKindMapAdd, CRDTOpKindMapRemove:
+		n, ok := node.(*crdtMap)
+		if !ok {
+			return false, errors.New(string(op.Kind) + " path '" + op.Path + "' isn't a map")
+		}
+		if _, err := ConvertKeyToType(op.Key, n.typ.Key()); err != nil {
+			return false, err
+		}
+		entry, ok := n.entries[op.Key]
+		if !ok {
+			entry = &crdtMapEntry{adds: map[CRDTID]reflect.Value{}, removed: map[CRDTID]bool{}}
+			n.entries[op.Key] = entry
+		}
+		if op.Kind == CRDTOpKindMapRemove {
+			for _, tag := range op.Tags {
+				delete(entry.adds, tag)
+				entry.removed[tag] = true
+			}
+			return true, nil
+		}
+		val, err := convertJSONValue(op.Value, n.typ.Elem())
+		if err != nil {
+			return false, err
+		}
+		if !entry.removed[op.ID] {
+			entry.adds[op.ID] = val
+		}
+		return true, nil
+
+	case CRDTOpKindSeqInsert:
+		n, ok := node.(*crdtSeq)
+		if !ok {
+			return false, errors.New("seqInsert path '" + op.Path + "' isn't a sequence")
+		}
+		val, err := convertJSONValue(op.Value, n.typ.Elem())
+		if err != nil {
+			return false, err
+		}
+		i := 0
+		if op.After != nil {
+			after := n.find(*op.After)
+			if after < 0 {
+				return false, nil
+			}
+			i = after + 1
+		}
+		// RGA: elements inserted after the same element are ordered latest first, and skipping later IDs skips them and everything inserted after them
+		for i < len(n.elems) && op.ID.Less(n.elems[i].id) {
+			i++
+		}
+		elem := &crdtSeqElem{id: op.ID, reg: crdtRegister{id: op.ID, val: val}}
+		n.elems = append(n.elems, nil)
+		copy(n.elems[i+1:], n.elems[i:])
+		n.elems[i] = elem
+		return true, nil
+
+	case CRDTOpKindSeqRemove, CRDTOpKindSeqSet:
+		n, ok := node.(*crdtSeq)
+		if !ok {
+			return false, errors.New(string(op.Kind) + " path '" + op.Path + "' isn't a sequence")
+		}
+		if op.Elem == nil {
+			return false, errors.New(string(op.Kind) + " has no elem")
+		}
+		i := n.find(*op.Elem)
+		if i < 0 {
+			return false, nil
+		}
+		if op.Kind == CRDTOpKindSeqRemove {
+			n.elems[i].removed = true
+			return true, nil
+		}
+		val, err := convertJSONValue(op.Value, n.typ.Elem())
+		if err != nil {
+			return false, err
+		}
+		if reg := &n.elems[i].reg; reg.id.Less(op.ID) {
+			reg.id = op.ID
+			reg.val = val
+		}
+		return true, nil
+	}
+	return false, errors.New("unknown CRDT op kind '" + string(op.Kind) + "'")
+}
+
+// WriteCRDTOps writes the ops to w as JSON Lines, one CRDTOp per line.
+func WriteCRDTOps(w io.Writer, ops []CRDTOp) error {
+	enc := json.NewEncoder(w)
+	for _, op := range ops {
+		if err := enc.Encode(op); err != nil {
+			return errors.New("writing op " + op.ID.String() + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// ReadCRDTOps reads ops written by WriteCRDTOps from r. Values are decoded as generic JSON, and converted to the document types by Import.
+func ReadCRDTOps(r io.Reader) ([]CRDTOp, error) {
+	dec := json.NewDecoder(r)
+	ops := []CRDTOp{}
+	for {
+		op := CRDTOp{}
+		if err := dec.Decode(&op); err == io.EOF {
+			return ops, nil
+		} else if err != nil {
+			return nil, errors.New("reading op " + strconv.Itoa(len(ops)) + ": " + err.Error())
+		}
+		ops = append(ops, op)
+	}
+}
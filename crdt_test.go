@@ -0,0 +1,439 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// TestCRDTDocumentApply checks a single replica applies patches the same as Apply with InsertOnAdd and ShiftOnRemove.
+func TestCRDTDocumentApply(t *testing.T) {
+	type Server struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Name    string            `json:"name"`
+		Limit   *int              `json:"limit"`
+		Tags    []string          `json:"tags"`
+		Servers map[string]Server `json:"servers"`
+		Backup  Server            `json:"backup"`
+		Ports   map[int]string    `json:"ports"`
+	}
+
+	initial := TestObj{
+		Name:    "web",
+		Tags:    []string{"a", "b", "c"},
+		Servers: map[string]Server{"x": {Host: "x.example", Port: 80}, "y": {Host: "y.example", Port: 80}},
+		Backup:  Server{Host: "backup.example", Port: 80},
+		Ports:   map[int]string{},
+	}
+
+	doc, err := NewCRDTDocument("a", initial)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := deepCopy(reflect.ValueOf(initial)).Interface().(TestObj)
+	limit := 5
+	patches := []JSONPatch{
+		{{Op: OpTypeReplace, Path: "/name", Value: "api"}, {Op: OpTypeAdd, Path: "/limit", Value: limit}},
+		{{Op: OpTypeAdd, Path: "/tags/1", Value: "ab"}, {Op: OpTypeAdd, Path: "/tags/-", Value: "d"}, {Op: OpTypeRemove, Path: "/tags/0"}},
+		{{Op: OpTypeReplace, Path: "/servers/x/port", Value: 8080}, {Op: OpTypeRemove, Path: "/servers/y"}, {Op: OpTypeAdd, Path: "/servers/z", Value: Server{Host: "z.example"}}},
+		{{Op: OpTypeReplace, Path: "/backup/port", Value: 9090}, {Op: OpTypeAdd, Path: "/ports/443", Value: "https"}},
+		{{Op: OpTypeMove, From: "/tags/2", Path: "/tags/0"}, {Op: OpTypeCopy, From: "/servers/x", Path: "/servers/w"}, {Op: OpTypeTest, Path: "/name", Value: "api"}},
+		{{Op: OpTypeReplace, Path: "/backup", Value: Server{Host: "new.example"}}, {Op: OpTypeRemove, Path: "/limit"}},
+		{{Op: OpTypeReplace, Path: "/tags", Value: []string{"z"}}, {Op: OpTypeReplace, Path: "/servers", Value: map[string]Server{"w": {Host: "w2.example"}, "v": {}}}},
+	}
+	for i, patch := range patches {
+		if err := doc.Apply(patch); err != nil {
+			t.Fatalf("CRDTDocument.Apply %+v error expected nil actual %+v", i, err)
+		}
+		if err := ApplyWithOptions(patch, &expected, Options{InsertOnAdd: true, ShiftOnRemove: true}); err != nil {
+			t.Fatalf("Apply %+v error expected nil actual %+v", i, err)
+		}
+		if actual := doc.Value(); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("CRDTDocument.Apply %+v expected %+v actual %+v", i, expected, actual)
+		}
+	}
+
+	ops := len(doc.Ops())
+	if err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "bad"}, {Op: OpTypeTest, Path: "/name", Value: "api"}}); err == nil {
+		t.Errorf("CRDTDocument.Apply failed test expected error actual nil")
+	}
+	if actual := doc.Value(); !reflect.DeepEqual(actual, expected) || len(doc.Ops()) != ops {
+		t.Errorf("CRDTDocument.Apply failed expected unchanged actual %+v", actual)
+	}
+
+	if _, err := NewCRDTDocument("", initial); err == nil {
+		t.Errorf("NewCRDTDocument empty replica expected error actual nil")
+	}
+}
+
+func TestCRDTDocumentApplyRollback(t *testing.T) {
+	type TestObj struct {
+		Name  string   `json:"name"`
+		Tags  []string `json:"tags"`
+		Count int      `json:"count"`
+	}
+
+	// the custom op succeeds only once, so it passes validation, and then fails after the ops before it are translated
+	calls := 0
+	patcher := &Patcher{}
+	patcher.RegisterOp("once", func(target reflect.Value, op JSONPatchOp) error {
+		calls++
+		if calls > 1 {
+			return errors.New("called more than once")
+		}
+		target.SetInt(target.Int() + 1)
+		return nil
+	})
+	initial := TestObj{Name: "web", Tags: []string{"a"}}
+	doc, err := NewCRDTDocumentWithPatcher("a", initial, patcher)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	other, err := NewCRDTDocument("b", initial)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := other.Apply(JSONPatch{{Op: OpTypeAdd, Path: "/tags/-", Value: "b"}}); err != nil {
+		t.Fatalf("CRDTDocument.Apply error expected nil actual %+v", err)
+	}
+	if err := doc.Import(other.Ops()); err != nil {
+		t.Fatalf("CRDTDocument.Import error expected nil actual %+v", err)
+	}
+	before, ops := doc.Value(), doc.Ops()
+
+	err = doc.Apply(JSONPatch{
+		{Op: OpTypeReplace, Path: "/name", Value: "api"},
+		{Op: OpTypeAdd, Path: "/tags/0", Value: "z"},
+		{Op: "once", Path: "/count"},
+	})
+	if err == nil {
+		t.Fatalf("CRDTDocument.Apply failed translation expected error actual nil")
+	}
+	if actual := doc.Value(); !reflect.DeepEqual(actual, before) {
+		t.Errorf("CRDTDocument.Apply failed translation expected %+v actual %+v", before, actual)
+	}
+	if actual := doc.Ops(); !reflect.DeepEqual(actual, ops) {
+		t.Errorf("CRDTDocument.Apply failed translation ops expected %+v actual %+v", ops, actual)
+	}
+
+	// the document still applies and syncs after the rollback
+	if err := doc.Apply(JSONPatch{{Op: OpTypeAdd, Path: "/tags/0", Value: "y"}}); err != nil {
+		t.Fatalf("CRDTDocument.Apply after rollback error expected nil actual %+v", err)
+	}
+	syncCRDTDocs(t, doc, other)
+	expected := TestObj{Name: "web", Tags: []string{"y", "a", "b"}}
+	if actual := doc.Value(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("CRDTDocument.Apply after rollback expected %+v actual %+v", expected, actual)
+	}
+	if actual := other.Value(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("CRDTDocument.Import after rollback expected %+v actual %+v", expected, actual)
+	}
+}
+
+// syncCRDTDocs imports the ops of every doc into every other doc.
+func syncCRDTDocs[T any](t *testing.T, docs ...*CRDTDocument[T]) {
+	t.Helper()
+	for _, from := range docs {
+		for _, to := range docs {
+			if err := to.Import(from.Ops()); err != nil {
+				t.Fatalf("CRDTDocument.Import error expected nil actual %+v", err)
+			}
+		}
+	}
+}
+
+func TestCRDTDocumentConcurrent(t *testing.T) {
+	type Server struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Name    string            `json:"name"`
+		Limit   *int              `json:"limit"`
+		Tags    []string          `json:"tags"`
+		Servers map[string]Server `json:"servers"`
+		Backup  Server            `json:"backup"`
+		Ports   map[int]string    `json:"ports"`
+	}
+
+	initial := TestObj{
+		Name:    "web",
+		Tags:    []string{"a", "b", "c"},
+		Servers: map[string]Server{"x": {Host: "x.example", Port: 80}, "y": {Host: "y.example", Port: 80}},
+		Backup:  Server{Host: "backup.example", Port: 80},
+		Ports:   map[int]string{},
+	}
+
+	a, err := NewCRDTDocument("a", initial)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	b, err := NewCRDTDocument("b", initial)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if err := a.Apply(JSONPatch{
+		{Op: OpTypeReplace, Path: "/name", Value: "from-a"},
+		{Op: OpTypeRemove, Path: "/servers/x"},
+		{Op: OpTypeAdd, Path: "/tags/1", Value: "a1"},
+		{Op: OpTypeRemove, Path: "/tags/2"},
+		{Op: OpTypeReplace, Path: "/backup/host", Value: "a.example"},
+	}); err != nil {
+		t.Fatalf("CRDTDocument.Apply error expected nil actual %+v", err)
+	}
+	if err := b.Apply(JSONPatch{
+		{Op: OpTypeReplace, Path: "/name", Value: "from-b"},
+		{Op: OpTypeReplace, Path: "/servers/x/port", Value: 8080},
+		{Op: OpTypeAdd, Path: "/tags/1", Value: "b1"},
+		{Op: OpTypeReplace, Path: "/tags/1", Value: "b1-changed"},
+		{Op: OpTypeReplace, Path: "/tags/3", Value: "c-changed"},
+		{Op: OpTypeReplace, Path: "/backup/port", Value: 9090},
+	}); err != nil {
+		t.Fatalf("CRDTDocument.Apply error expected nil actual %+v", err)
+	}
+
+	syncCRDTDocs(t, a, b)
+	aVal := a.Value()
+	bVal := b.Value()
+	if !reflect.DeepEqual(aVal, bVal) {
+		t.Fatalf("CRDTDocument replicas expected to converge actual %+v %+v", aVal, bVal)
+	}
+
+	expected := TestObj{
+		// concurrent sets have the same counter, so the later replica ID wins
+		Name: "from-b",
+		// concurrent inserts after "a" are ordered latest ID first
+		Tags: []string{"a", "b1-changed", "a1", "c-changed"},
+		// the update is concurrent with the remove, so it wins
+		Servers: map[string]Server{"x": {Host: "x.example", Port: 8080}, "y": {Host: "y.example", Port: 80}},
+		Backup:  Server{Host: "a.example", Port: 9090},
+		Ports:   map[int]string{},
+	}
+	if !reflect.DeepEqual(aVal, expected) {
+		t.Errorf("CRDTDocument concurrent expected %+v actual %+v", expected, aVal)
+	}
+
+	// after syncing, a remove observes the update, so it removes the key
+	if err := a.Apply(JSONPatch{{Op: OpTypeRemove, Path: "/servers/x"}}); err != nil {
+		t.Fatalf("CRDTDocument.Apply error expected nil actual %+v", err)
+	}
+	syncCRDTDocs(t, a, b)
+	if _, ok := b.Value().Servers["x"]; ok {
+		t.Errorf("CRDTDocument remove after sync expected removed actual %+v", b.Value().Servers)
+	}
+}
+
+func TestCRDTDocumentImportOrder(t *testing.T) {
+	type Server struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Name    string            `json:"name"`
+		Limit   *int              `json:"limit"`
+		Tags    []string          `json:"tags"`
+		Servers map[string]Server `json:"servers"`
+		Backup  Server            `json:"backup"`
+		Ports   map[int]string    `json:"ports"`
+	}
+
+	initial := TestObj{
+		Name:    "web",
+		Tags:    []string{"a", "b", "c"},
+		Servers: map[string]Server{"x": {Host: "x.example", Port: 80}, "y": {Host: "y.example", Port: 80}},
+		Backup:  Server{Host: "backup.example", Port: 80},
+		Ports:   map[int]string{},
+	}
+
+	replicas := []*CRDTDocument[TestObj]{}
+	for _, id := range []string{"a", "b", "c"} {
+		replica, err := NewCRDTDocument(id, initial)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		replicas = append(replicas, replica)
+	}
+	patches := [][]JSONPatch{
+		{
+			{{Op: OpTypeAdd, Path: "/tags/0", Value: "a0"}},
+			{{Op: OpTypeAdd, Path: "/tags/1", Value: "a1"}, {Op: OpTypeAdd, Path: "/servers/q", Value: Server{Port: 1}}},
+			{{Op: OpTypeRemove, Path: "/tags/3"}, {Op: OpTypeAdd, Path: "/ports/80", Value: "http"}},
+		},
+		{
+			{{Op: OpTypeAdd, Path: "/tags/0", Value: "b0"}, {Op: OpTypeReplace, Path: "/name", Value: "b"}},
+			{{Op: OpTypeReplace, Path: "/tags", Value: []string{"x", "y"}}},
+			{{Op: OpTypeAdd, Path: "/tags/1", Value: "b1"}, {Op: OpTypeRemove, Path: "/servers/y"}},
+		},
+		{
+			{{Op: OpTypeAdd, Path: "/tags/-", Value: "c-end"}},
+			{{Op: OpTypeAdd, Path: "/servers/q", Value: Server{Port: 3}}},
+			{{Op: OpTypeMove, From: "/tags/0", Path: "/tags/2"}},
+		},
+	}
+
+	// interleave local patches with partial syncs
+	for round := 0; round < 3; round++ {
+		for i, replica := range replicas {
+			if err := replica.Apply(patches[i][round]); err != nil {
+				t.Fatalf("CRDTDocument.Apply replica %+v round %+v error expected nil actual %+v", i, round, err)
+			}
+		}
+		if err := replicas[0].Import(replicas[1].Ops()); err != nil {
+			t.Fatalf("CRDTDocument.Import error expected nil actual %+v", err)
+		}
+	}
+
+	all := []CRDTOp{}
+	for _, replica := range replicas {
+		all = append(all, replica.Ops()...)
+	}
+
+	// a new replica imports every op in random orders, including before the ops they depend on
+	expected := (*TestObj)(nil)
+	for i := 0; i < 20; i++ {
+		shuffled := append([]CRDTOp(nil), all...)
+		rand.New(rand.NewSource(int64(i))).Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		replica, err := NewCRDTDocument("d", initial)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		for _, op := range shuffled {
+			if err := replica.Import([]CRDTOp{op}); err != nil {
+				t.Fatalf("CRDTDocument.Import error expected nil actual %+v", err)
+			}
+		}
+		if len(replica.pending) != 0 {
+			t.Errorf("CRDTDocument.Import expected no pending ops actual %+v", replica.pending)
+		}
+		val := replica.Value()
+		if expected == nil {
+			expected = &val
+		} else if !reflect.DeepEqual(val, *expected) {
+			t.Errorf("CRDTDocument.Import order %+v expected %+v actual %+v", i, *expected, val)
+		}
+	}
+
+	syncCRDTDocs(t, replicas...)
+	for i, replica := range replicas {
+		if val := replica.Value(); !reflect.DeepEqual(val, *expected) {
+			t.Errorf("CRDTDocument replica %+v expected %+v actual %+v", i, *expected, val)
+		}
+	}
+
+	// importing again is idempotent
+	before := len(replicas[0].Ops())
+	if err := replicas[0].Import(all); err != nil {
+		t.Fatalf("CRDTDocument.Import error expected nil actual %+v", err)
+	}
+	if len(replicas[0].Ops()) != before || !reflect.DeepEqual(replicas[0].Value(), *expected) {
+		t.Errorf("CRDTDocument.Import again expected unchanged")
+	}
+}
+
+func TestCRDTOpsJSONLines(t *testing.T) {
+	type Server struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Name    string            `json:"name"`
+		Limit   *int              `json:"limit"`
+		Tags    []string          `json:"tags"`
+		Servers map[string]Server `json:"servers"`
+		Backup  Server            `json:"backup"`
+		Ports   map[int]string    `json:"ports"`
+	}
+
+	initial := TestObj{
+		Name:    "web",
+		Tags:    []string{"a", "b", "c"},
+		Servers: map[string]Server{"x": {Host: "x.example", Port: 80}, "y": {Host: "y.example", Port: 80}},
+		Backup:  Server{Host: "backup.example", Port: 80},
+		Ports:   map[int]string{},
+	}
+
+	a, err := NewCRDTDocument("a", initial)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	limit := 3
+	if err := a.Apply(JSONPatch{
+		{Op: OpTypeAdd, Path: "/limit", Value: limit},
+		{Op: OpTypeAdd, Path: "/servers/z", Value: Server{Host: "z.example", Port: 1}},
+		{Op: OpTypeAdd, Path: "/tags/1", Value: "x"},
+		{Op: OpTypeAdd, Path: "/ports/8080", Value: "alt"},
+		{Op: OpTypeReplace, Path: "/backup", Value: Server{Host: "b"}},
+	}); err != nil {
+		t.Fatalf("CRDTDocument.Apply error expected nil actual %+v", err)
+	}
+
+	buf := bytes.Buffer{}
+	if err := WriteCRDTOps(&buf, a.Ops()); err != nil {
+		t.Fatalf("WriteCRDTOps error expected nil actual %+v", err)
+	}
+	ops, err := ReadCRDTOps(&buf)
+	if err != nil {
+		t.Fatalf("ReadCRDTOps error expected nil actual %+v", err)
+	}
+	if len(ops) != len(a.Ops()) {
+		t.Fatalf("ReadCRDTOps expected %+v ops actual %+v", len(a.Ops()), len(ops))
+	}
+
+	b, err := NewCRDTDocument("b", initial)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := b.Import(ops); err != nil {
+		t.Fatalf("CRDTDocument.Import decoded error expected nil actual %+v", err)
+	}
+	if !reflect.DeepEqual(a.Value(), b.Value()) {
+		t.Errorf("CRDTDocument.Import decoded expected %+v actual %+v", a.Value(), b.Value())
+	}
+
+	bad := []CRDTOp{{ID: CRDTID{Counter: 1, Replica: "c"}, Kind: CRDTOpKindSet, Path: "/nonexistent"}}
+	if err := b.Import(bad); err == nil {
+		t.Errorf("CRDTDocument.Import bad path expected error actual nil")
+	}
+	if err := b.Import([]CRDTOp{{Kind: CRDTOpKindSet, Path: "/name"}}); err == nil {
+		t.Errorf("CRDTDocument.Import missing ID expected error actual nil")
+	}
+}
+
+func TestCRDTDocumentWildcard(t *testing.T) {
+	type Server struct {
+		Port int `json:"port"`
+	}
+	type TestObj struct {
+		Servers []Server          `json:"servers"`
+		Ports   map[string]Server `json:"ports"`
+	}
+
+	initial := TestObj{Servers: []Server{{Port: 80}, {Port: 81}}, Ports: map[string]Server{"a": {}, "b": {}}}
+	patcher := &Patcher{Options: Options{Wildcards: true}}
+	a, err := NewCRDTDocumentWithPatcher("a", initial, patcher)
+	if err != nil {
+		t.Fatalf("NewCRDTDocument error expected nil actual %+v", err)
+	}
+	b, err := NewCRDTDocumentWithPatcher("b", initial, patcher)
+	if err != nil {
+		t.Fatalf("NewCRDTDocument error expected nil actual %+v", err)
+	}
+	if err := a.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/servers/*/port", Value: 8080}, {Op: OpTypeReplace, Path: "/ports/*", Value: Server{Port: 443}}}); err != nil {
+		t.Fatalf("CRDTDocument.Apply error expected nil actual %+v", err)
+	}
+	if err := b.Import(a.Ops()); err != nil {
+		t.Fatalf("CRDTDocument.Import error expected nil actual %+v", err)
+	}
+	expected := TestObj{Servers: []Server{{Port: 8080}, {Port: 8080}}, Ports: map[string]Server{"a": {Port: 443}, "b": {Port: 443}}}
+	for _, doc := range []*CRDTDocument[TestObj]{a, b} {
+		if actual := doc.Value(); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("CRDTDocument wildcard expected %+v actual %+v", expected, actual)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// SliceDiffStrategy is how DiffWithOptions diffs slices.
+type SliceDiffStrategy string
+
+const (
+	// SliceDiffStrategyIndex compares the elements at each index, replacing the ones which differ, and appends or removes elements at the end.
+	// Inserting or removing one element replaces every element after it.
+	SliceDiffStrategyIndex = SliceDiffStrategy("index")
+
+	// SliceDiffStrategyLCS keeps the longest common subsequence of equal elements, per Myers' diff algorithm, and removes, inserts, or moves the rest.
+	// An element removed from a and equal to one inserted in b is moved, rather than removed and added.
+	SliceDiffStrategyLCS = SliceDiffStrategy("lcs")
+
+	// SliceDiffStrategyKeyed matches elements of a and b which are structs or maps with the same key, and moves them into place and diffs them, removing and inserting the elements which aren't matched.
+	// The key is the json tag or map key in the `patchMergeKey` tag of the slice's struct field, or else DiffOptions.Key.
+	// Slices without a key, or with elements which are nil or have duplicate or missing keys, are diffed with SliceDiffStrategyLCS.
+	SliceDiffStrategyKeyed = SliceDiffStrategy("keyed")
+)
+
+// DiffOptions configures how DiffWithOptions diffs values.
+type DiffOptions struct {
+	// Slices is the strategy for diffing slices. The zero value is SliceDiffStrategyIndex.
+	Slices SliceDiffStrategy
+
+	// Key is the json tag or map key which identifies slice elements for SliceDiffStrategyKeyed, for slices whose struct field has no `patchMergeKey` tag.
+	Key string
+}
+
+// Diff returns a patch which transforms a into b, which must be the same type, or pointers to the same type.
+// Struct fields are addressed by their json tags, the same as Apply. Maps are diffed by key, and slices by index.
+// A struct with untagged or unexported fields which differ, or a slice of pointers where an element changes to or from nil, is replaced as a whole, because there's no path to the part which changed.
+// Returns an error if the objects can only differ by replacing the root, or if they differ in an interface value, which Apply doesn't support.
+func Diff(a interface{}, b interface{}) (JSONPatch, error) {
+	return DiffWithOptions(a, b, DiffOptions{})
+}
+
+// DiffWithOptions returns a patch which transforms a into b, diffing slices with the strategy in the options.
+// See Diff.
+//
+// Ops on slice elements are indexed as of when they're applied, in order. Elements inserted before the end of a slice are added at the end and moved into place, because an add op only inserts with Options.InsertOnAdd, but a move op always inserts.
+// Removed slice elements are removed by index, so the patch only applies as intended with Options.ShiftOnRemove, for example with StrictOptions.
+func DiffWithOptions(a interface{}, b interface{}, opts DiffOptions) (JSONPatch, error) {
+	switch opts.Slices {
+	case "", SliceDiffStrategyIndex, SliceDiffStrategyLCS, SliceDiffStrategyKeyed:
+	default:
+		return nil, errors.New("unknown slice diff strategy '" + string(opts.Slices) + "'")
+	}
+	aVal := reflect.ValueOf(a)
+	bVal := reflect.ValueOf(b)
+	if aVal.Type() != bVal.Type() {
+		return nil, fmt.Errorf("can't diff different types %T and %T", a, b)
+	}
+	for aVal.Kind() == reflect.Ptr {
+		if aVal.IsNil() || bVal.IsNil() {
+			return nil, errors.New("can't diff nil pointers")
+		}
+		aVal = aVal.Elem()
+		bVal = bVal.Elem()
+	}
+	patch := JSONPatch{}
+	d := differ{opts: opts}
+	if err := d.diffVal(&patch, nil, reflect.Invalid, "", aVal, bVal); err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// differ diffs values with the options.
+type differ struct {
+	opts DiffOptions
+}
+
+// diffVal appends the ops to transform a into b at path to patch. The parent is the kind of the value containing a, or Invalid if a is the root.
+// The key is the `patchMergeKey` tag of the struct field, if a is one.
+func (d differ) diffVal(patch *JSONPatch, path []string, parent reflect.Kind, key string, a reflect.Value, b reflect.Value) error {
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() && b.IsNil() {
+			return nil
+		}
+		if a.IsNil() || b.IsNil() {
+			return diffSet(patch, path, parent, a, b)
+		}
+		if a.Pointer() == b.Pointer() {
+			return nil
+		}
+		return d.diffVal(patch, path, parent, key, a.Elem(), b.Elem())
+
+	case reflect.Struct:
+		if !diffableStruct(a, b) {
+			return diffSet(patch, path, parent, a, b)
+		}
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if !isPathField(field) {
+				continue
+			}
+			if err := d.diffVal(patch, append(path[:len(path):len(path)], field.Tag.Get("json")), reflect.Struct, field.Tag.Get("patchMergeKey"), a.Field(i), b.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if a.IsNil() != b.IsNil() {
+			return diffSet(patch, path, parent, a, b)
+		}
+		return d.diffMap(patch, path, a, b)
+
+	case reflect.Slice:
+		if a.IsNil() != b.IsNil() {
+			return diffSet(patch, path, parent, a, b)
+		}
+		return d.diffSlice(patch, path, parent, key, a, b)
+
+	case reflect.Interface:
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			return nil
+		}
+		return errors.New("can't diff interface at '" + FormatPath(path) + "': interfaces aren't supported yet")
+	}
+
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return nil
+	}
+	return diffSet(patch, path, parent, a, b)
+}
+
+// diffSet appends the op to set the value at path from a to b as a whole, to patch.
+// A pointer field is removed if b is nil, and added if a is nil, because replace requires a value to replace.
+func diffSet(patch *JSONPatch, path []string, parent reflect.Kind, a reflect.Value, b reflect.Value) error {
+	if parent == reflect.Invalid {
+		return errors.New("can't diff values which differ at the root")
+	}
+	pathStr := FormatPath(path)
+	val := deepCopy(b)
+
+	// map values are set as their exact type, but struct fields and slice elements which are pointers are set to the value they point to
+	if parent != reflect.Map && a.Kind() == reflect.Ptr {
+		if b.IsNil() {
+			*patch = append(*patch, JSONPatchOp{Op: OpTypeRemove, Path: pathStr})
+			return nil
+		}
+		val = val.Elem()
+	}
+
+	op := OpType(OpTypeReplace)
+	if isNilVal(a) && parent != reflect.Map {
+		op = OpTypeAdd
+	}
+	*patch = append(*patch, JSONPatchOp{Op: op, Path: pathStr, Value: val.Interface()})
+	return nil
+}
+
+// isNilVal returns whether val is a nil pointer, map, or slice.
+func isNilVal(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		return val.IsNil()
+	}
+	return false
+}
+
+// diffableStruct returns whether the struct values a and b only differ in fields which can be addressed by a path, i.e. exported fields with json tags.
+func diffableStruct(a reflect.Value, b reflect.Value) bool {
+	// unexported fields can't be compared individually, so compare b to a with all its addressable fields taken from b
+	cp := reflect.New(a.Type()).Elem()
+	cp.Set(a)
+	for i := 0; i < a.NumField(); i++ {
+		if isPathField(a.Type().Field(i)) {
+			cp.Field(i).Set(b.Field(i))
+		}
+	}
+	return reflect.DeepEqual(cp.Interface(), b.Interface())
+}
+
+// isPathField returns whether the struct field can be addressed by a path.
+func isPathField(field reflect.StructField) bool {
+	tag := field.Tag.Get("json")
+	return field.PkgPath == "" && tag != "" && tag != "-"
+}
+
+// diffableSlice returns whether the slices a and b can be diffed by index.
+// Slice elements which are pointers can't be set to or from nil by path, so if any element changes to or from nil, the slice must be set as a whole.
+func diffableSlice(a reflect.Value, b reflect.Value) bool {
+	if a.Type().Elem().Kind() != reflect.Ptr {
+		return true
+	}
+	for i := 0; i < b.Len(); i++ {
+		if b.Index(i).IsNil() && (i >= a.Len() || !a.Index(i).IsNil()) {
+			return false
+		}
+		if i < a.Len() && a.Index(i).IsNil() && !b.Index(i).IsNil() {
+			return false
+		}
+	}
+	return true
+}
+
+// diffMap appends the ops to transform the map a into the map b at path to patch. Keys are diffed in sorted order, so the patch is deterministic.
+func (d differ) diffMap(patch *JSONPatch, path []string, a reflect.Value, b reflect.Value) error {
+	keys := map[string]reflect.Value{}
+	for _, mapVal := range []reflect.Value{a, b} {
+		iter := mapVal.MapRange()
+		for iter.Next() {
+			token, err := formatMapKey(iter.Key())
+			if err != nil {
+				return errors.New("diffing map at '" + FormatPath(path) + "': " + err.Error())
+			}
+			keys[token] = iter.Key()
+		}
+	}
+	tokens := make([]string, 0, len(keys))
+	for token := range keys {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+
+	for _, token := range tokens {
+		key := keys[token]
+		keyPath := append(path[:len(path):len(path)], token)
+		aElem := a.MapIndex(key)
+		bElem := b.MapIndex(key)
+		switch {
+		case !aElem.IsValid():
+			*patch = append(*patch, JSONPatchOp{Op: OpTypeAdd, Path: FormatPath(keyPath), Value: deepCopy(bElem).Interface()})
+		case !bElem.IsValid():
+			*patch = append(*patch, JSONPatchOp{Op: OpTypeRemove, Path: FormatPath(keyPath)})
+		default:
+			if err := d.diffVal(patch, keyPath, reflect.Map, "", aElem, bElem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatMapKey returns the path token of a map key, which must be a string or integer, the types ConvertKeyToType supports.
+func formatMapKey(key reflect.Value) (string, error) {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", errors.New("unsupported map key type " + key.Type().String())
+}
+
+// diffSliceIndexes appends the ops to transform the slice a into the slice b at path to patch, comparing elements at the same index.
+// Elements past the end of a are appended, and elements past the end of b are removed from the end.
+func (d differ) diffSliceIndexes(patch *JSONPatch, path []string, a reflect.Value, b reflect.Value) error {
+	common := a.Len()
+	if b.Len() < common {
+		common = b.Len()
+	}
+	for i := 0; i < common; i++ {
+		if err := d.diffVal(patch, append(path[:len(path):len(path)], strconv.Itoa(i)), reflect.Slice, "", a.Index(i), b.Index(i)); err != nil {
+			return err
+		}
+	}
+	for i := common; i < b.Len(); i++ {
+		val := deepCopy(b.Index(i))
+		if val.Kind() == reflect.Ptr {
+			val = val.Elem()
+		}
+		*patch = append(*patch, JSONPatchOp{Op: OpTypeAdd, Path: FormatPath(append(path[:len(path):len(path)], "-")), Value: val.Interface()})
+	}
+	for i := a.Len() - 1; i >= common; i-- {
+		*patch = append(*patch, JSONPatchOp{Op: OpTypeRemove, Path: FormatPath(append(path[:len(path):len(path)], strconv.Itoa(i)))})
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	type Inner struct {
+		Port int    `json:"port"`
+		Host string `json:"host"`
+	}
+	type TestObj struct {
+		Name     string            `json:"name"`
+		Limit    *int              `json:"limit"`
+		Tags     []string          `json:"tags"`
+		Servers  map[string]Inner  `json:"servers"`
+		PtrMap   map[string]*Inner `json:"ptrMap"`
+		Inners   []*Inner          `json:"inners"`
+		Inner    Inner             `json:"inner"`
+		InnerPtr *Inner            `json:"innerPtr"`
+		IntKeys  map[int]string    `json:"intKeys"`
+		Updated  time.Time         `json:"updated"`
+		Untagged string
+	}
+
+	one := 1
+	two := 2
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		a    TestObj
+		b    TestObj
+	}{
+		{"equal", TestObj{Name: "a", Tags: []string{"x"}}, TestObj{Name: "a", Tags: []string{"x"}}},
+		{"scalar", TestObj{Name: "a"}, TestObj{Name: "b"}},
+		{"ptr add", TestObj{}, TestObj{Limit: &one}},
+		{"ptr remove", TestObj{Limit: &one}, TestObj{}},
+		{"ptr change", TestObj{Limit: &one}, TestObj{Limit: &two}},
+		{"slice append", TestObj{Tags: []string{"a"}}, TestObj{Tags: []string{"a", "b", "c"}}},
+		{"slice truncate", TestObj{Tags: []string{"a", "b", "c"}}, TestObj{Tags: []string{"b"}}},
+		{"slice nil", TestObj{Tags: []string{"a"}}, TestObj{}},
+		{"slice from nil", TestObj{}, TestObj{Tags: []string{}}},
+		{"map keys", TestObj{Servers: map[string]Inner{"a": {Port: 1}, "b": {Port: 2}}}, TestObj{Servers: map[string]Inner{"b": {Port: 3}, "c/d~": {Port: 4}}}},
+		{"map from nil", TestObj{}, TestObj{Servers: map[string]Inner{"a": {Port: 1}}}},
+		{"map ptr values", TestObj{PtrMap: map[string]*Inner{"a": {Port: 1}, "b": nil, "c": {Port: 3}}}, TestObj{PtrMap: map[string]*Inner{"a": nil, "b": {Port: 2}, "c": {Port: 4}}}},
+		{"slice ptrs", TestObj{Inners: []*Inner{{Port: 1}}}, TestObj{Inners: []*Inner{{Port: 2}, {Port: 3}}}},
+		{"slice ptrs nil", TestObj{Inners: []*Inner{{Port: 1}, {Port: 2}}}, TestObj{Inners: []*Inner{{Port: 1}, nil}}},
+		{"nested struct", TestObj{Inner: Inner{Port: 1, Host: "a"}}, TestObj{Inner: Inner{Port: 2, Host: "a"}}},
+		{"nested ptr", TestObj{}, TestObj{InnerPtr: &Inner{Host: "b"}}},
+		{"int keys", TestObj{IntKeys: map[int]string{1: "a", -2: "b"}}, TestObj{IntKeys: map[int]string{1: "c", 3: "d"}}},
+		{"opaque struct", TestObj{Updated: now}, TestObj{Updated: now.Add(time.Hour)}},
+	}
+
+	for _, test := range tests {
+		patch, err := Diff(&test.a, &test.b)
+		if err != nil {
+			t.Errorf("Diff %v error expected nil actual %+v", test.name, err)
+			continue
+		}
+		if len(patch) == 0 != reflect.DeepEqual(test.a, test.b) {
+			t.Errorf("Diff %v expected empty patch only if equal, actual %+v", test.name, patch)
+		}
+		obj := deepCopy(reflect.ValueOf(test.a)).Interface().(TestObj)
+		if err := ApplyWithOptions(patch, &obj, Options{ShiftOnRemove: true}); err != nil {
+			t.Errorf("Diff %v patch %+v Apply error expected nil actual %+v", test.name, patch, err)
+			continue
+		}
+		if !reflect.DeepEqual(obj, test.b) {
+			t.Errorf("Diff %v patch %+v Apply expected %+v actual %+v", test.name, patch, test.b, obj)
+		}
+		obj = deepCopy(reflect.ValueOf(test.a)).Interface().(TestObj)
+		if err := ApplyWithOptions(patch, &obj, StrictOptions()); err != nil {
+			t.Errorf("Diff %v patch %+v strict Apply error expected nil actual %+v", test.name, patch, err)
+		} else if !reflect.DeepEqual(obj, test.b) {
+			t.Errorf("Diff %v patch %+v strict Apply expected %+v actual %+v", test.name, patch, test.b, obj)
+		}
+	}
+}
+
+func TestDiffOps(t *testing.T) {
+	type TestObj struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+
+	a := TestObj{Name: "a", Tags: []string{"x", "y", "z"}}
+	b := TestObj{Name: "b", Tags: []string{"x"}}
+	patch, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff error expected nil actual %+v", err)
+	}
+	expected := JSONPatch{
+		{Op: OpTypeReplace, Path: "/name", Value: "b"},
+		{Op: OpTypeRemove, Path: "/tags/2"},
+		{Op: OpTypeRemove, Path: "/tags/1"},
+	}
+	if !reflect.DeepEqual(patch, expected) {
+		t.Errorf("Diff expected %+v actual %+v", expected, patch)
+	}
+
+	b.Tags[0] = "changed"
+	if patch[0].Value != "b" || a.Tags[0] != "x" {
+		t.Errorf("Diff expected patch values not to alias objects")
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	type Inner struct {
+		Port int `json:"port"`
+	}
+	type TestObj struct {
+		Name     string `json:"name"`
+		Untagged string
+	}
+
+	if _, err := Diff(TestObj{}, Inner{}); err == nil {
+		t.Errorf("Diff different types expected error actual nil")
+	}
+	if _, err := Diff(&TestObj{}, (*TestObj)(nil)); err == nil {
+		t.Errorf("Diff nil expected error actual nil")
+	}
+	if _, err := Diff(TestObj{Untagged: "a"}, TestObj{Untagged: "b"}); err == nil {
+		t.Errorf("Diff untagged root field expected error actual nil")
+	}
+	if _, err := Diff(1, 2); err == nil {
+		t.Errorf("Diff scalar root expected error actual nil")
+	}
+	type ifaceObj struct {
+		V interface{} `json:"v"`
+	}
+	if _, err := Diff(ifaceObj{V: 1}, ifaceObj{V: 2}); err == nil {
+		t.Errorf("Diff interface expected error actual nil")
+	}
+	if patch, err := Diff(ifaceObj{V: 1}, ifaceObj{V: 1}); err != nil || len(patch) != 0 {
+		t.Errorf("Diff equal interface expected empty nil actual %+v %+v", patch, err)
+	}
+}
@@ -0,0 +1,236 @@
+package jsonpatch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// ErrVersionConflict is returned by Document.ApplyIfVersion when the document isn't at the expected version.
+var ErrVersionConflict = errors.New("document version conflict")
+
+// Document owns a value of type T, and applies patches to it from multiple goroutines, versioning each change.
+//
+// Patches are applied to a copy of the value, which replaces it if the whole patch succeeds, so a failed patch changes nothing, and snapshots are never modified.
+type Document[T any] struct {
+	mu      sync.RWMutex
+	writeMu sync.Mutex // serializes writers, so readers aren't blocked while a patch is applied
+	state   *documentState[T]
+	patcher *Patcher
+
+	observers      []documentObserverEntry[T] // called by writers, with writeMu held, so they see changes in order
+	nextObserverID uint64
+}
+
+type documentObserverEntry[T any] struct {
+	id uint64
+	fn documentObserver[T]
+}
+
+// documentChange is a patch which changed a Document. The patch is the Document's copy, which observers must not modify.
+// The resolved ops are the ops the patch applied, with wildcards expanded and key selectors resolved to indices.
+type documentChange[T any] struct {
+	patch    JSONPatch
+	resolved JSONPatch
+	meta     map[string]string
+	state    *documentState[T]
+}
+
+type documentObserver[T any] func(change documentChange[T])
+
+// documentState is a version of a Document. It's never modified after it's created, except to cache its hash.
+type documentState[T any] struct {
+	val     T
+	version uint64
+
+	hashOnce sync.Once
+	hash     string
+	hashErr  error
+}
+
+// Snapshot is a read-only view of a Document at a version.
+type Snapshot[T any] struct {
+	state *documentState[T]
+}
+
+// NewDocument returns a Document at version 0, which owns a deep copy of val.
+func NewDocument[T any](val T) *Document[T] {
+	return NewDocumentWithPatcher(val, &Patcher{})
+}
+
+// NewDocumentWithPatcher returns a Document at version 0, which owns a deep copy of val, and applies patches with the given Patcher.
+func NewDocumentWithPatcher[T any](val T, patcher *Patcher) *Document[T] {
+	return &Document[T]{
+		state:   &documentState[T]{val: copyDocumentVal(val)},
+		patcher: patcher,
+	}
+}
+
+// copyDocumentVal returns a deep copy of val.
+func copyDocumentVal[T any](val T) T {
+	cp := reflect.New(reflect.TypeOf(&val).Elem()).Elem()
+	cp.Set(deepCopy(reflect.ValueOf(&val).Elem()))
+	return cp.Interface().(T)
+}
+
+// Apply applies the patch to the document, and returns the new version.
+// If the patch fails, the document is unchanged, and the error and current version are returned.
+// A patch of only test ops doesn't change the version.
+func (d *Document[T]) Apply(patch JSONPatch) (uint64, error) {
+	return d.ApplyWithMeta(patch, nil)
+}
+
+// ApplyWithMeta applies the patch to the document like Apply, recording the metadata with it in the document History, for example the user or request which made the change.
+func (d *Document[T]) ApplyWithMeta(patch JSONPatch, meta map[string]string) (uint64, error) {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	return d.apply(patch, meta)
+}
+
+// ApplyIfVersion applies the patch to the document if it's at the expected version, and returns the new version.
+// If the document isn't at the expected version, ErrVersionConflict and the current version are returned, and the patch isn't applied.
+// This can be used for optimistic concurrency, for example with the version of a Snapshot, or with HTTP If-Match and ETag.
+func (d *Document[T]) ApplyIfVersion(patch JSONPatch, expected uint64) (uint64, error) {
+	return d.ApplyIfVersionWithMeta(patch, expected, nil)
+}
+
+// ApplyIfVersionWithMeta applies the patch to the document like ApplyIfVersion, recording the metadata with it in the document History.
+func (d *Document[T]) ApplyIfVersionWithMeta(patch JSONPatch, expected uint64, meta map[string]string) (uint64, error) {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	if version := d.current().version; version != expected {
+		return version, ErrVersionConflict
+	}
+	return d.apply(patch, meta)
+}
+
+// apply applies the patch to a copy of the current state, and replaces the state with it if the patch succeeds.
+// The writeMu must be held.
+func (d *Document[T]) apply(patch JSONPatch, meta map[string]string) (uint64, error) {
+	old := d.current()
+	if !hasChangeOps(patch) {
+		if err := d.patcher.Apply(patch, &old.val); err != nil {
+			return old.version, err
+		}
+		return old.version, nil
+	}
+
+	// the patch values are stored in the new state, so they're copied, to keep callers reusing the patch from changing it
+	patch = deepCopy(reflect.ValueOf(patch)).Interface().(JSONPatch)
+	val := copyDocumentVal(old.val)
+	resolved := JSONPatch{}
+	for _, patchOp := range patch {
+		ops, err := d.patcher.applyResolvedOp(reflect.ValueOf(&val).Elem(), patchOp)
+		if err != nil {
+			return old.version, err
+		}
+		resolved = append(resolved, ops...)
+	}
+
+	state := &documentState[T]{val: val, version: old.version + 1}
+	d.mu.Lock()
+	d.state = state
+	d.mu.Unlock()
+
+	change := documentChange[T]{patch: patch, resolved: resolved, meta: meta, state: state}
+	for _, observer := range d.observers {
+		observer.fn(change)
+	}
+	return state.version, nil
+}
+
+// observe calls observer with every change after the current state, which is returned, with the id to pass to unobserve.
+// The current state and the observer are taken together, so the observer doesn't miss or repeat a change.
+func (d *Document[T]) observe(observer documentObserver[T]) (*documentState[T], uint64) {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	d.nextObserverID++
+	d.observers = append(d.observers, documentObserverEntry[T]{id: d.nextObserverID, fn: observer})
+	return d.current(), d.nextObserverID
+}
+
+// unobserve removes the observer with the given id. After it returns, the observer isn't called again.
+// The after func, if not nil, is called before another change is observed.
+func (d *Document[T]) unobserve(id uint64, after func()) {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	for i, observer := range d.observers {
+		if observer.id == id {
+			d.observers = append(d.observers[:i:i], d.observers[i+1:]...)
+			break
+		}
+	}
+	if after != nil {
+		after()
+	}
+}
+
+// hasChangeOps returns whether the patch has any op which isn't a test op.
+func hasChangeOps(patch JSONPatch) bool {
+	for _, op := range patch {
+		if op.Op != OpTypeTest {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Document[T]) current() *documentState[T] {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.state
+}
+
+// Version returns the current version of the document.
+func (d *Document[T]) Version() uint64 {
+	return d.current().version
+}
+
+// Snapshot returns a read-only snapshot of the current version of the document.
+// Snapshots are never modified by later patches.
+func (d *Document[T]) Snapshot() Snapshot[T] {
+	return Snapshot[T]{state: d.current()}
+}
+
+// ETag returns the ETag of the current version of the document. See Snapshot.ETag.
+func (d *Document[T]) ETag() (string, error) {
+	return d.Snapshot().ETag()
+}
+
+// Version returns the version of the document the snapshot was taken at.
+func (s Snapshot[T]) Version() uint64 {
+	return s.state.version
+}
+
+// Value returns a deep copy of the snapshot value, which may be modified without affecting the snapshot or document.
+func (s Snapshot[T]) Value() T {
+	return copyDocumentVal(s.state.val)
+}
+
+// Hash returns the hex SHA-256 of the JSON encoding of the snapshot value.
+// The hash is stable, because encoding/json encodes structs in field order, and maps in key order.
+// Returns an error if the value can't be encoded as JSON.
+func (s Snapshot[T]) Hash() (string, error) {
+	s.state.hashOnce.Do(func() {
+		bts, err := json.Marshal(s.state.val)
+		if err != nil {
+			s.state.hashErr = errors.New("encoding document to hash: " + err.Error())
+			return
+		}
+		sum := sha256.Sum256(bts)
+		s.state.hash = hex.EncodeToString(sum[:])
+	})
+	return s.state.hash, s.state.hashErr
+}
+
+// ETag returns the snapshot Hash as a strong HTTP ETag, including the quotes.
+func (s Snapshot[T]) ETag() (string, error) {
+	hash, err := s.Hash()
+	if err != nil {
+		return "", err
+	}
+	return `"` + hash + `"`, nil
+}
@@ -0,0 +1,225 @@
+package jsonpatch
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestDocumentApply(t *testing.T) {
+	type TestObj struct {
+		Name  string         `json:"name"`
+		Tags  []string       `json:"tags"`
+		Ports map[string]int `json:"ports"`
+	}
+
+	orig := TestObj{Name: "web", Tags: []string{"a"}, Ports: map[string]int{"http": 80}}
+	doc := NewDocument(orig)
+	if doc.Version() != 0 {
+		t.Errorf("Document.Version expected %+v actual %+v", 0, doc.Version())
+	}
+	before := doc.Snapshot()
+
+	version, err := doc.Apply(JSONPatch{
+		{Op: OpTypeReplace, Path: "/name", Value: "api"},
+		{Op: OpTypeAdd, Path: "/tags/-", Value: "b"},
+		{Op: OpTypeAdd, Path: "/ports/https", Value: 443},
+	})
+	if err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	if version != 1 || doc.Version() != 1 {
+		t.Errorf("Document.Apply version expected %+v actual %+v %+v", 1, version, doc.Version())
+	}
+
+	val := doc.Snapshot().Value()
+	if val.Name != "api" || len(val.Tags) != 2 || val.Ports["https"] != 443 {
+		t.Errorf("Document.Apply value expected patched actual %+v", val)
+	}
+	if old := before.Value(); old.Name != "web" || len(old.Tags) != 1 || len(old.Ports) != 1 {
+		t.Errorf("Document.Apply old snapshot expected unchanged actual %+v", old)
+	}
+	if before.Version() != 0 {
+		t.Errorf("Document.Apply old snapshot version expected %+v actual %+v", 0, before.Version())
+	}
+	if len(orig.Ports) != 1 {
+		t.Errorf("Document.Apply original value expected unchanged actual %+v", orig)
+	}
+
+	val.Ports["ftp"] = 21
+	if _, ok := doc.Snapshot().Value().Ports["ftp"]; ok {
+		t.Errorf("Snapshot.Value expected copy, modifying it changed the document")
+	}
+}
+
+func TestDocumentApplyAtomic(t *testing.T) {
+	type TestObj struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	doc := NewDocument(TestObj{Name: "web", Count: 1})
+	version, err := doc.Apply(JSONPatch{
+		{Op: OpTypeReplace, Path: "/name", Value: "api"},
+		{Op: OpTypeReplace, Path: "/nonexistent", Value: 1},
+	})
+	if err == nil {
+		t.Errorf("Document.Apply bad path expected error actual nil")
+	}
+	if version != 0 || doc.Version() != 0 {
+		t.Errorf("Document.Apply failed version expected %+v actual %+v %+v", 0, version, doc.Version())
+	}
+	if val := doc.Snapshot().Value(); val.Name != "web" {
+		t.Errorf("Document.Apply failed expected unchanged actual %+v", val)
+	}
+
+	version, err = doc.Apply(JSONPatch{{Op: OpTypeTest, Path: "/name", Value: "web"}})
+	if err != nil {
+		t.Errorf("Document.Apply test error expected nil actual %+v", err)
+	}
+	if version != 0 {
+		t.Errorf("Document.Apply test-only version expected %+v actual %+v", 0, version)
+	}
+}
+
+func TestDocumentApplyIfVersion(t *testing.T) {
+	type TestObj struct {
+		Count int `json:"count"`
+	}
+
+	doc := NewDocument(TestObj{Count: 1})
+	snap := doc.Snapshot()
+
+	if _, err := doc.ApplyIfVersion(JSONPatch{{Op: OpTypeReplace, Path: "/count", Value: 2}}, snap.Version()); err != nil {
+		t.Fatalf("Document.ApplyIfVersion error expected nil actual %+v", err)
+	}
+
+	version, err := doc.ApplyIfVersion(JSONPatch{{Op: OpTypeReplace, Path: "/count", Value: 3}}, snap.Version())
+	if err != ErrVersionConflict {
+		t.Errorf("Document.ApplyIfVersion stale error expected %+v actual %+v", ErrVersionConflict, err)
+	}
+	if version != 1 {
+		t.Errorf("Document.ApplyIfVersion stale version expected %+v actual %+v", 1, version)
+	}
+	if val := doc.Snapshot().Value(); val.Count != 2 {
+		t.Errorf("Document.ApplyIfVersion stale expected unchanged actual %+v", val)
+	}
+}
+
+func TestDocumentETag(t *testing.T) {
+	type TestObj struct {
+		Name  string         `json:"name"`
+		Ports map[string]int `json:"ports"`
+	}
+
+	a := NewDocument(TestObj{Name: "web", Ports: map[string]int{"http": 80, "https": 443}})
+	b := NewDocument(TestObj{Name: "web", Ports: map[string]int{"https": 443, "http": 80}})
+
+	aTag, err := a.ETag()
+	if err != nil {
+		t.Fatalf("Document.ETag error expected nil actual %+v", err)
+	}
+	bTag, err := b.ETag()
+	if err != nil {
+		t.Fatalf("Document.ETag error expected nil actual %+v", err)
+	}
+	if aTag != bTag {
+		t.Errorf("Document.ETag equal values expected equal actual %+v %+v", aTag, bTag)
+	}
+	if len(aTag) != 66 || aTag[0] != '"' || aTag[65] != '"' {
+		t.Errorf("Document.ETag expected quoted sha256 actual %+v", aTag)
+	}
+
+	if _, err := a.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "api"}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	if newTag, _ := a.ETag(); newTag == aTag {
+		t.Errorf("Document.ETag after change expected different actual %+v", newTag)
+	}
+
+	bad := NewDocument(map[string]interface{}{"f": func() {}})
+	if _, err := bad.ETag(); err == nil {
+		t.Errorf("Document.ETag unencodable expected error actual nil")
+	}
+}
+
+func TestDocumentConcurrent(t *testing.T) {
+	type TestObj struct {
+		Count int            `json:"count"`
+		Ports map[string]int `json:"ports"`
+	}
+
+	doc := NewDocument(TestObj{Ports: map[string]int{}})
+	const writers = 8
+	const writes = 50
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				key := strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				if _, err := doc.Apply(JSONPatch{{Op: OpTypeAdd, Path: "/ports/" + key, Value: j}}); err != nil {
+					t.Errorf("Document.Apply concurrent error expected nil actual %+v", err)
+				}
+				snap := doc.Snapshot()
+				if _, err := snap.ETag(); err != nil {
+					t.Errorf("Snapshot.ETag concurrent error expected nil actual %+v", err)
+				}
+			}
+		}(i)
+	}
+
+	// compare-and-swap increments from several goroutines, retrying on conflict
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				for {
+					snap := doc.Snapshot()
+					count := snap.Value().Count
+					_, err := doc.ApplyIfVersion(JSONPatch{{Op: OpTypeReplace, Path: "/count", Value: count + 1}}, snap.Version())
+					if err == nil {
+						break
+					}
+					if err != ErrVersionConflict {
+						t.Errorf("Document.ApplyIfVersion concurrent error expected nil actual %+v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	val := doc.Snapshot().Value()
+	if len(val.Ports) != writers*writes {
+		t.Errorf("Document concurrent ports expected %+v actual %+v", writers*writes, len(val.Ports))
+	}
+	if val.Count != writers*writes {
+		t.Errorf("Document concurrent count expected %+v actual %+v", writers*writes, val.Count)
+	}
+	if doc.Version() != uint64(2*writers*writes) {
+		t.Errorf("Document concurrent version expected %+v actual %+v", 2*writers*writes, doc.Version())
+	}
+}
+
+func TestDocumentPatchableSnapshot(t *testing.T) {
+	type TestObj struct {
+		M testOrderedMap `json:"m"`
+	}
+
+	doc := NewDocument(TestObj{M: testOrderedMap{keys: []string{"a"}, vals: map[string]int{"a": 1}}})
+	before := doc.Snapshot()
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeAdd, Path: "/m/b", Value: 2}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	if old := before.Value(); len(old.M.keys) != 1 || len(old.M.vals) != 1 {
+		t.Errorf("Document.Apply old snapshot expected unchanged actual %+v", old)
+	}
+	if val := doc.Snapshot().Value(); len(val.M.keys) != 2 || val.M.vals["b"] != 2 {
+		t.Errorf("Document.Apply value expected patched actual %+v", val)
+	}
+}
@@ -0,0 +1,174 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HistoryEntry is a patch which changed a Document, and the version it produced.
+type HistoryEntry struct {
+	Version uint64            `json:"version"`
+	Time    time.Time         `json:"time"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	Patch   JSONPatch         `json:"patch"`
+}
+
+// History records every patch applied to a Document, and reconstructs the document at any version since the History was created.
+//
+// Past versions are rebuilt by replaying patches from the nearest earlier snapshot, with the document's Patcher, so custom ops must be deterministic.
+// The History keeps a snapshot every snapshotInterval versions, to bound the cost of replaying.
+type History[T any] struct {
+	mu               sync.RWMutex
+	patcher          *Patcher
+	snapshotInterval uint64
+	entries          []HistoryEntry
+	snapshots        []*documentState[T] // in version order. The first is the version the History was created at.
+	now              func() time.Time
+}
+
+// NewHistory returns a History which records every change to doc from its current version.
+// The History keeps a snapshot every snapshotInterval versions. If snapshotInterval is 0, it only keeps the initial snapshot, and always replays from it.
+func NewHistory[T any](doc *Document[T], snapshotInterval uint64) *History[T] {
+	h := &History[T]{
+		patcher:          doc.patcher,
+		snapshotInterval: snapshotInterval,
+		now:              time.Now,
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	initial, _ := doc.observe(h.record)
+	h.snapshots = []*documentState[T]{initial}
+	return h
+}
+
+// record is the Document observer, which records the change.
+func (h *History[T]) record(change documentChange[T]) {
+	entry := HistoryEntry{
+		Version: change.state.version,
+		Time:    h.now(),
+		Meta:    copyMeta(change.meta),
+		Patch:   change.patch,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, entry)
+	if h.snapshotInterval > 0 && (entry.Version-h.snapshots[0].version)%h.snapshotInterval == 0 {
+		// document states are never modified, so the snapshot can share it
+		h.snapshots = append(h.snapshots, change.state)
+	}
+}
+
+func copyMeta(meta map[string]string) map[string]string {
+	if meta == nil {
+		return nil
+	}
+	cp := make(map[string]string, len(meta))
+	for k, v := range meta {
+		cp[k] = v
+	}
+	return cp
+}
+
+// FirstVersion returns the version of the document when the History was created, which is the earliest version it can reconstruct.
+func (h *History[T]) FirstVersion() uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.snapshots[0].version
+}
+
+// LastVersion returns the latest version the History has recorded.
+func (h *History[T]) LastVersion() uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.lastVersion()
+}
+
+func (h *History[T]) lastVersion() uint64 {
+	return h.snapshots[0].version + uint64(len(h.entries))
+}
+
+// Entries returns the recorded entries which produced the versions after from, up to and including to.
+func (h *History[T]) Entries(from uint64, to uint64) ([]HistoryEntry, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if err := h.checkVersion(from); err != nil {
+		return nil, err
+	}
+	if err := h.checkVersion(to); err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, errors.New("history entries from version " + strconv.FormatUint(from, 10) + " is after to version " + strconv.FormatUint(to, 10))
+	}
+	first := h.snapshots[0].version
+	return append([]HistoryEntry(nil), h.entries[from-first:to-first]...), nil
+}
+
+func (h *History[T]) checkVersion(version uint64) error {
+	if version < h.snapshots[0].version || version > h.lastVersion() {
+		return errors.New("version " + strconv.FormatUint(version, 10) + " not in history, which has versions " + strconv.FormatUint(h.snapshots[0].version, 10) + " to " + strconv.FormatUint(h.lastVersion(), 10))
+	}
+	return nil
+}
+
+// At returns the document at the given version, replayed from the nearest earlier snapshot.
+// The returned value is a copy, which may be modified.
+func (h *History[T]) At(version uint64) (T, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if err := h.checkVersion(version); err != nil {
+		return *new(T), err
+	}
+
+	i := sort.Search(len(h.snapshots), func(i int) bool { return h.snapshots[i].version > version }) - 1
+	snapshot := h.snapshots[i]
+	val := copyDocumentVal(snapshot.val)
+
+	first := h.snapshots[0].version
+	for _, entry := range h.entries[snapshot.version-first : version-first] {
+		// Apply stores patch values in val, so they're copied, to keep the entries unchanged
+		patch := deepCopy(reflect.ValueOf(entry.Patch)).Interface().(JSONPatch)
+		if err := h.patcher.Apply(patch, &val); err != nil {
+			return *new(T), errors.New("replaying version " + strconv.FormatUint(entry.Version, 10) + ": " + err.Error())
+		}
+	}
+	return val, nil
+}
+
+// NetPatch returns a single patch which transforms the document at version from into the document at version to, as computed by Diff.
+// Unlike the recorded patches, it has no intermediate changes, and from may be after to, to undo changes.
+// Like any Diff, it removes slice elements by index, so it only applies as intended with Options.ShiftOnRemove.
+func (h *History[T]) NetPatch(from uint64, to uint64) (JSONPatch, error) {
+	fromVal, err := h.At(from)
+	if err != nil {
+		return nil, err
+	}
+	toVal, err := h.At(to)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(&fromVal, &toVal)
+}
+
+// WriteJSONLines writes the recorded entries to w as JSON Lines, one HistoryEntry per line, oldest first.
+// Sensitive op values are redacted per the Patcher's Options.Redact, and key selectors on sensitive fields in op paths are redacted, so replaying the output doesn't restore them.
+func (h *History[T]) WriteJSONLines(w io.Writer) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	enc := json.NewEncoder(w)
+	for _, entry := range h.entries {
+		entry.Patch = h.patcher.Options.redactPatch(typ, entry.Patch)
+		if err := enc.Encode(entry); err != nil {
+			return errors.New("writing history version " + strconv.FormatUint(entry.Version, 10) + ": " + err.Error())
+		}
+	}
+	return nil
+}
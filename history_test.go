@@ -0,0 +1,192 @@
+package jsonpatch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHistoryAt(t *testing.T) {
+	type TestObj struct {
+		Name  string         `json:"name"`
+		Tags  []string       `json:"tags"`
+		Ports map[string]int `json:"ports"`
+	}
+
+	doc := NewDocument(TestObj{Name: "v0", Ports: map[string]int{}})
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "before"}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+
+	hist := NewHistory(doc, 3)
+	expected := map[uint64]TestObj{1: doc.Snapshot().Value()}
+	for i := 2; i <= 10; i++ {
+		tags := []string{}
+		for j := 0; j < i; j++ {
+			tags = append(tags, strconv.Itoa(j))
+		}
+		patch := JSONPatch{
+			{Op: OpTypeReplace, Path: "/name", Value: "v" + strconv.Itoa(i)},
+			{Op: OpTypeAdd, Path: "/ports/p" + strconv.Itoa(i), Value: i},
+			{Op: OpTypeAdd, Path: "/tags", Value: tags},
+		}
+		if i%4 == 0 {
+			patch = append(patch, JSONPatchOp{Op: OpTypeRemove, Path: "/ports/p" + strconv.Itoa(i-1)})
+		}
+		version, err := doc.Apply(patch)
+		if err != nil {
+			t.Fatalf("Document.Apply error expected nil actual %+v", err)
+		}
+		tags[0] = "modified after apply"
+		expected[version] = doc.Snapshot().Value()
+	}
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeRemove, Path: "/nonexistent"}}); err == nil {
+		t.Fatalf("Document.Apply bad patch expected error actual nil")
+	}
+
+	if hist.FirstVersion() != 1 || hist.LastVersion() != 10 {
+		t.Errorf("History versions expected 1 10 actual %+v %+v", hist.FirstVersion(), hist.LastVersion())
+	}
+	if len(hist.snapshots) != 4 {
+		t.Errorf("History snapshots expected %+v actual %+v", 4, len(hist.snapshots))
+	}
+
+	for version, exp := range expected {
+		actual, err := hist.At(version)
+		if err != nil {
+			t.Errorf("History.At %+v error expected nil actual %+v", version, err)
+			continue
+		}
+		if !reflect.DeepEqual(exp, actual) {
+			t.Errorf("History.At %+v expected %+v actual %+v", version, exp, actual)
+		}
+	}
+
+	val, _ := hist.At(5)
+	val.Ports["modified"] = 1
+	if again, _ := hist.At(5); !reflect.DeepEqual(again, expected[5]) {
+		t.Errorf("History.At expected copy, modifying it changed the history")
+	}
+
+	if _, err := hist.At(0); err == nil {
+		t.Errorf("History.At before first version expected error actual nil")
+	}
+	if _, err := hist.At(11); err == nil {
+		t.Errorf("History.At after last version expected error actual nil")
+	}
+}
+
+func TestHistoryEntries(t *testing.T) {
+	type TestObj struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	doc := NewDocument(TestObj{})
+	hist := NewHistory(doc, 0)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	hist.now = func() time.Time { return now }
+
+	if _, err := doc.ApplyWithMeta(JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "a"}}, map[string]string{"user": "alice"}); err != nil {
+		t.Fatalf("Document.ApplyWithMeta error expected nil actual %+v", err)
+	}
+	if _, err := doc.ApplyIfVersionWithMeta(JSONPatch{{Op: OpTypeReplace, Path: "/count", Value: 2}}, 1, map[string]string{"user": "bob"}); err != nil {
+		t.Fatalf("Document.ApplyIfVersionWithMeta error expected nil actual %+v", err)
+	}
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeTest, Path: "/count", Value: 2}}); err != nil {
+		t.Fatalf("Document.Apply test error expected nil actual %+v", err)
+	}
+
+	entries, err := hist.Entries(0, 2)
+	if err != nil {
+		t.Fatalf("History.Entries error expected nil actual %+v", err)
+	}
+	if len(entries) != 2 || entries[0].Version != 1 || entries[1].Version != 2 {
+		t.Fatalf("History.Entries expected versions 1 2 actual %+v", entries)
+	}
+	if entries[0].Meta["user"] != "alice" || entries[1].Meta["user"] != "bob" || !entries[0].Time.Equal(now) {
+		t.Errorf("History.Entries expected meta and time actual %+v", entries)
+	}
+	if entries, err := hist.Entries(1, 2); err != nil || len(entries) != 1 || entries[0].Version != 2 {
+		t.Errorf("History.Entries 1 2 expected version 2 actual %+v %+v", entries, err)
+	}
+	if _, err := hist.Entries(2, 1); err == nil {
+		t.Errorf("History.Entries reversed expected error actual nil")
+	}
+
+	buf := bytes.Buffer{}
+	if err := hist.WriteJSONLines(&buf); err != nil {
+		t.Fatalf("History.WriteJSONLines error expected nil actual %+v", err)
+	}
+	scanner := bufio.NewScanner(&buf)
+	lines := 0
+	for scanner.Scan() {
+		line := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("History.WriteJSONLines line %+v expected JSON actual error %+v", lines, err)
+		}
+		patch := line["patch"].([]interface{})
+		op := patch[0].(map[string]interface{})
+		if line["version"] != float64(lines+1) || op["op"] != "replace" || op["path"] == nil {
+			t.Errorf("History.WriteJSONLines line %+v expected entry actual %+v", lines, line)
+		}
+		if _, ok := op["from"]; ok {
+			t.Errorf("History.WriteJSONLines expected no from on replace actual %+v", op)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("History.WriteJSONLines lines expected %+v actual %+v", 2, lines)
+	}
+}
+
+func TestHistoryNetPatch(t *testing.T) {
+	type TestObj struct {
+		Name  string         `json:"name"`
+		Tags  []string       `json:"tags"`
+		Ports map[string]int `json:"ports"`
+	}
+
+	doc := NewDocument(TestObj{Name: "a", Tags: []string{"x"}, Ports: map[string]int{"http": 80}})
+	hist := NewHistory(doc, 2)
+	patches := []JSONPatch{
+		{{Op: OpTypeReplace, Path: "/name", Value: "b"}},
+		{{Op: OpTypeAdd, Path: "/tags/-", Value: "y"}, {Op: OpTypeAdd, Path: "/ports/https", Value: 443}},
+		{{Op: OpTypeReplace, Path: "/name", Value: "a"}, {Op: OpTypeRemove, Path: "/ports/http"}},
+	}
+	for _, patch := range patches {
+		if _, err := doc.Apply(patch); err != nil {
+			t.Fatalf("Document.Apply error expected nil actual %+v", err)
+		}
+	}
+
+	for _, versions := range [][2]uint64{{0, 3}, {3, 0}, {1, 2}, {2, 2}} {
+		patch, err := hist.NetPatch(versions[0], versions[1])
+		if err != nil {
+			t.Errorf("History.NetPatch %+v error expected nil actual %+v", versions, err)
+			continue
+		}
+		val, _ := hist.At(versions[0])
+		if err := ApplyWithOptions(patch, &val, Options{ShiftOnRemove: true}); err != nil {
+			t.Errorf("History.NetPatch %+v Apply error expected nil actual %+v", versions, err)
+			continue
+		}
+		if expected, _ := hist.At(versions[1]); !reflect.DeepEqual(expected, val) {
+			t.Errorf("History.NetPatch %+v expected %+v actual %+v", versions, expected, val)
+		}
+	}
+
+	patch, _ := hist.NetPatch(0, 3)
+	for _, op := range patch {
+		if op.Path == "/name" {
+			t.Errorf("History.NetPatch expected no intermediate name change actual %+v", patch)
+		}
+	}
+	if _, err := hist.NetPatch(0, 4); err == nil {
+		t.Errorf("History.NetPatch unknown version expected error actual nil")
+	}
+}
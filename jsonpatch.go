@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	// "encoding/json"
@@ -21,111 +22,381 @@ const (
 )
 
 type JSONPatchOp struct {
-	Op    OpType
-	Path  string
-	Value interface{}
-	From  string
+	Op    OpType      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+	From  string      `json:"from,omitempty"`
 }
 
 type JSONPatch []JSONPatchOp
 
-func Apply(patch JSONPatch, realObj interface{}) error {
-	obj := reflect.ValueOf(realObj)
-	if obj.Kind() != reflect.Ptr {
-		return errors.New("object must be a pointer")
+// Patchable is implemented by types which apply JSON Patch ops to themselves, for example ordered maps, or types whose members are behind accessor methods, which can't be patched via reflection.
+// When the path of an op passes through a value implementing Patchable, the op is deferred to it, the same way encoding/json defers to json.Unmarshaler.
+// The remainingPath is the path tokens after the Patchable value, and is never empty. Ops on the value itself, for example replacing it, are applied normally.
+// The op Path, and the From of move and copy ops, are rewritten to be relative to the Patchable value.
+type Patchable interface {
+	PatchApply(op JSONPatchOp, remainingPath []string) error
+}
+
+var patchableType = reflect.TypeOf((*Patchable)(nil)).Elem()
+
+// PatchCloner is optionally implemented by types whose unexported fields need deep copying, typically Patchable types.
+// Clone returns a deep copy of the value which shares nothing with it, either of the same type or a pointer to one. Values are copied with it wherever the library copies objects, for example by Preview and Document, because reflection can only copy unexported fields shallowly.
+// If Clone returns any other type, the value is copied via reflection instead.
+type PatchCloner interface {
+	Clone() interface{}
+}
+
+var patchClonerType = reflect.TypeOf((*PatchCloner)(nil)).Elem()
+
+// Options configures how patches are applied.
+// The zero value is the default, lenient behavior of Apply, which departs from RFC 6902 where Go types make that less surprising. StrictOptions follows the RFC wherever Go types allow it.
+// Each departure from the RFC can be selected individually.
+type Options struct {
+	// CreateMissing creates missing containers on the path of add, move, and copy ops, like `mkdir -p`.
+	// Nil pointers and maps are constructed, missing map keys are created, and a path token of "-" or the length of a slice appends a new element.
+	CreateMissing bool
+
+	// ErrorOnRemoveMissing makes a remove op on a map key which doesn't exist, or a pointer field which is nil, return an error, per RFC6902§4.2.
+	// Otherwise, it does nothing.
+	ErrorOnRemoveMissing bool
+
+	// ErrorOnRemoveValueField makes a remove op on a struct field which isn't a pointer return an error, because struct fields can't be removed.
+	// Otherwise, the field is set to a default-constructed object. This also makes a move from such a field return an error.
+	ErrorOnRemoveValueField bool
+
+	// ShiftOnRemove makes a remove op on a slice element remove it, shifting the following elements, per RFC6902§4.2.
+	// Otherwise, the element is set to a default-constructed object, keeping the length of the slice, the same as a value field. Move ops always remove their from.
+	ShiftOnRemove bool
+
+	// InsertOnAdd makes an add op on a slice element insert it, shifting the following elements, per RFC6902§4.1.
+	// Otherwise, the element is replaced. Move and copy ops always insert.
+	InsertOnAdd bool
+
+	// ErrorOnReplaceNil makes a replace op on a nil slice or map field return an error, because there's no value to replace, per RFC6902§4.3.
+	// Otherwise, it's set. A replace op on a nil pointer field always returns an error.
+	ErrorOnReplaceNil bool
+
+	// ExactMapValues makes an add or replace op on a map value return an error unless the patch value is exactly the map's value type, the same as struct fields.
+	// Otherwise, any value assignable to the map's value type is set, for example any value in a map[string]interface{}.
+	// This isn't an RFC 6902 rule, so StrictOptions doesn't set it.
+	ExactMapValues bool
+
+	// Wildcards makes a path token of "*" in add, replace, remove, and test ops match every element of a slice or array, or value of a map, applying the op to each.
+	// This isn't part of RFC 6901, and makes a map key of "*" impossible to address. See WildcardToken.
+	// Preview, Document notifications, and CRDTDocument expand wildcards into an op for each match, and Conflicts treats a wildcard as matching any token.
+	Wildcards bool
+
+	// Redact is the policy for reporting the values of struct fields tagged `jsonpatch:"sensitive"`, and every value inside them, in Preview changes, Summarize summaries, Document notifications, and History.WriteJSONLines.
+	// If it's nil, they're reported as RedactedValue. Values which have sensitive fields in them are reported as generic JSON values, with those fields redacted.
+	// Patches are applied with the real values. Errors don't include values, except in key selectors and merge keys, which report sensitive values as RedactedValue.
+	// APIs which hand values to code that needs them aren't redacted: SyncServer snapshots and patches, Merge3 Conflict values, OpResult.Target, and WriteCRDTOps.
+	Redact RedactionPolicy
+}
+
+// StrictOptions returns Options which follow RFC 6902 wherever Go types allow it.
+func StrictOptions() Options {
+	return Options{
+		ErrorOnRemoveMissing:    true,
+		ErrorOnRemoveValueField: true,
+		ShiftOnRemove:           true,
+		InsertOnAdd:             true,
+		ErrorOnReplaceNil:       true,
 	}
-	if obj.IsNil() {
-		return errors.New("object must not be nil")
+}
+
+// Apply applies the patch to realObj, which must be a non-nil pointer.
+// Custom ops registered package-wide with RegisterOp are applied, as well as the RFC 6902 ops.
+func Apply(patch JSONPatch, realObj interface{}) error {
+	return (&Patcher{}).Apply(patch, realObj)
+}
+
+// ApplyWithOptions applies the patch to realObj, which must be a non-nil pointer, with the given options.
+func ApplyWithOptions(patch JSONPatch, realObj interface{}, opts Options) error {
+	return (&Patcher{Options: opts}).Apply(patch, realObj)
+}
+
+func (p *Patcher) applyOp(obj reflect.Value, patchOp JSONPatchOp) error {
+	// fmt.Printf("DEBUG Apply oPath.Type().Name() '%+v'\n", oPath.Type().Name())
+
+	path, err := ParsePath(patchOp.Path)
+	if err != nil {
+		return err
 	}
-	obj = reflect.Indirect(obj)
-	for _, patchOp := range patch {
-		if err := applyOp(obj, patchOp); err != nil {
-			return err
+	fromPath := []string(nil)
+	if patchOp.Op == OpTypeMove || patchOp.Op == OpTypeCopy {
+		if fromPath, err = ParsePath(patchOp.From); err != nil {
+			return errors.New("from: " + err.Error())
 		}
 	}
-	return nil
+
+	if p.Options.Wildcards && hasWildcard(path, fromPath) {
+		return p.applyWildcard(obj, patchOp, path, fromPath)
+	}
+	return p.applyParsedOp(obj, patchOp, path, fromPath)
 }
 
-func applyOp(obj reflect.Value, patchOp JSONPatchOp) error {
-	// fmt.Printf("DEBUG Apply oPath.Type().Name() '%+v'\n", oPath.Type().Name())
+// applyParsedOp applies patchOp to obj, with its Path and From already parsed. The fromPath is only used by move and copy ops.
+func (p *Patcher) applyParsedOp(obj reflect.Value, patchOp JSONPatchOp, path []string, fromPath []string) error {
+	if deferred, err := applyPatchable(obj, patchOp, path, fromPath); deferred {
+		return err
+	}
 
 	switch patchOp.Op {
 	case OpTypeAdd:
-		if err := applyAdd(obj, patchOp.Path, patchOp.Value); err != nil {
+		if err := applyAdd(obj, path, patchOp.Value, p.Options); err != nil {
 			return err
 		}
 	case OpTypeRemove:
-		if err := applyRemove(obj, patchOp.Path); err != nil {
+		if err := applyRemove(obj, path, p.Options); err != nil {
 			return err
 		}
 	case OpTypeReplace:
-		if err := applyReplace(obj, patchOp.Path, patchOp.Value); err != nil {
+		if err := applyReplace(obj, path, patchOp.Value, p.Options); err != nil {
 			return err
 		}
 	case OpTypeMove:
-		if err := applyMove(obj, patchOp.Path, patchOp.From); err != nil {
+		if err := applyMove(obj, path, fromPath, p.Options); err != nil {
 			return err
 		}
 	case OpTypeCopy:
-		if err := applyCopy(obj, patchOp.Path, patchOp.From); err != nil {
+		if err := applyCopy(obj, path, fromPath, p.Options); err != nil {
 			return err
 		}
 	case OpTypeTest:
-		return errors.New("not implemented")
+		if err := applyTest(obj, path, patchOp.Value); err != nil {
+			return err
+		}
 	default:
-		return errors.New("unknown op type")
+		handler, ok := p.getOp(patchOp.Op)
+		if !ok {
+			return errors.New("unknown op type")
+		}
+		if err := applyCustom(obj, patchOp, path, handler); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// getValAt returns the reflect.Value for the field at the given path of the object.
-// If add is true, nil pointers in the object are constructed; otherwise, an error is returned if a member is nil.
-func getValAt(path string, obj reflect.Value) (reflect.Value, error) {
-	pathParts := strings.Split(path, "/")
-	if len(pathParts) < 1 {
-		return reflect.Value{}, fmt.Errorf("malformed patch op path: %+v", pathParts)
+// ParsePath parses a JSON Pointer, per RFC 6901, into its reference tokens, unescaping "~1" to "/" and "~0" to "~".
+// The empty path, which references the root object, has no tokens.
+func ParsePath(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
 	}
-	pathParts = pathParts[1:]
-	err := error(nil)
+	if path[0] != '/' {
+		return nil, errors.New("malformed patch op path '" + redactKeySelectors(path) + "': must be empty or start with '/'")
+	}
+	pathParts := strings.Split(path[1:], "/")
+	for i, part := range pathParts {
+		if !strings.Contains(part, "~") {
+			continue
+		}
+		for j := 0; j < len(part); j++ {
+			if part[j] == '~' && (j+1 == len(part) || (part[j+1] != '0' && part[j+1] != '1')) {
+				return nil, errors.New("malformed patch op path '" + redactKeySelectors(path) + "': '~' must be escaped as '~0'")
+			}
+		}
+		pathParts[i] = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+	}
+	return pathParts, nil
+}
+
+// FormatPath formats reference tokens as a JSON Pointer, per RFC 6901, escaping "~" as "~0" and "/" as "~1".
+// It's the inverse of ParsePath.
+func FormatPath(pathParts []string) string {
+	path := ""
 	for _, part := range pathParts {
-		obj, err = getNextVal(part, obj, false)
+		path += "/" + strings.Replace(strings.Replace(part, "~", "~0", -1), "/", "~1", -1)
+	}
+	return path
+}
+
+// isPathPrefix returns whether the tokens of prefix are the first tokens of path. A path is a prefix of itself.
+func isPathPrefix(prefix []string, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i, part := range prefix {
+		if path[i] != part {
+			return false
+		}
+	}
+	return true
+}
+
+// applyPatchable defers patchOp to the first Patchable on its path, if any.
+// The fromPath is only used by move and copy ops.
+// Returns whether the op was deferred, and the error returned by the Patchable.
+func applyPatchable(obj reflect.Value, patchOp JSONPatchOp, pathParts []string, fromParts []string) (bool, error) {
+	patchable, i, wbs, ok := findPatchable(obj, pathParts)
+
+	if patchOp.Op != OpTypeMove && patchOp.Op != OpTypeCopy {
+		if !ok {
+			return false, nil
+		}
+		op := patchOp
+		op.Path = FormatPath(pathParts[i:])
+		if err := patchable.PatchApply(op, pathParts[i:]); err != nil {
+			return true, err
+		}
+		wbs.store()
+		return true, nil
+	}
+
+	_, fromI, _, fromOK := findPatchable(obj, fromParts)
+	if !ok && !fromOK {
+		return false, nil
+	}
+	if !ok || !fromOK || i != fromI || !isPathPrefix(pathParts[:i], fromParts) {
+		return true, errors.New(string(patchOp.Op) + " op 'from' and 'path' must both be in the same Patchable, or neither")
+	}
+	op := patchOp
+	op.Path = FormatPath(pathParts[i:])
+	op.From = FormatPath(fromParts[i:])
+	if err := patchable.PatchApply(op, pathParts[i:]); err != nil {
+		return true, err
+	}
+	wbs.store()
+	return true, nil
+}
+
+// findPatchable returns the first Patchable value on the path of the given tokens, and the number of tokens preceding it.
+// The last value of the path isn't considered, because ops on the value itself are applied normally.
+// Returns false if there is no Patchable on the path, or if the path doesn't exist, in which case the op itself reports the error.
+// Map values on the path are copied, and must be stored back with the returned mapWriteBacks after the Patchable is applied.
+func findPatchable(obj reflect.Value, pathParts []string) (Patchable, int, mapWriteBacks, bool) {
+	wbs := mapWriteBacks(nil)
+	err := error(nil)
+	for i, part := range pathParts {
+		if patchable, ok := getPatchable(obj); ok {
+			return patchable, i, wbs, true
+		}
+		obj, err = getNextVal(part, obj, false, &wbs)
 		if err != nil {
-			return reflect.Value{}, err
+			return nil, 0, nil, false
 		}
 	}
-	return obj, nil
+	return nil, 0, nil, false
+}
+
+// getPatchable returns obj as a Patchable, if it or a pointer to it implements Patchable.
+func getPatchable(obj reflect.Value) (Patchable, bool) {
+	if obj.Kind() == reflect.Ptr && obj.IsNil() {
+		return nil, false
+	}
+	if obj.CanAddr() && obj.Addr().CanInterface() && obj.Addr().Type().Implements(patchableType) {
+		return obj.Addr().Interface().(Patchable), true
+	}
+	if obj.CanInterface() && obj.Type().Implements(patchableType) {
+		return obj.Interface().(Patchable), true
+	}
+	return nil, false
 }
 
-// getValBefore gets the reflect.Value immediately preceding the last path. For example, path `/a/b/c` returns `obj.A.B`.
+// getValAt returns the reflect.Value for the field at the given path of the object.
 // If add is true, nil pointers in the object are constructed; otherwise, an error is returned if a member is nil.
-func getValBefore(path string, obj reflect.Value) (reflect.Value, error) {
-	// TODO move split outside these calls, to avoid splitting twice, for this and the following getNextVal for the last val
-	pathParts := strings.Split(path, "/")
-	if len(pathParts) < 1 {
-		return reflect.Value{}, fmt.Errorf("malformed patch op path: %+v", pathParts)
-	}
-	if len(pathParts) < 2 {
-		// path is "/foo", so the object preceding the last is the root object.
-		return obj, nil
+// Map values on the path are copied, and must be stored back with the returned mapWriteBacks after the value is modified.
+func getValAt(path []string, obj reflect.Value, add bool) (reflect.Value, mapWriteBacks, error) {
+	wbs := mapWriteBacks(nil)
+	err := error(nil)
+	for _, part := range path {
+		obj, err = getNextVal(part, obj, add, &wbs)
+		if err != nil {
+			return reflect.Value{}, nil, err
+		}
 	}
-	pathParts = pathParts[1 : len(pathParts)-1]
-	// fmt.Printf("DEBUG getValBefore pathParts: %+v\n", pathParts)
+	return obj, wbs, nil
+}
 
+// getValBefore gets the reflect.Value immediately preceding the last path token. For example, path `/a/b/c` returns `obj.A.B`.
+// Returns an error if the path is empty, because the root object has no value preceding it.
+// If add is true, nil pointers and maps in the object are constructed, and missing map keys are created; otherwise, an error is returned if a member is nil.
+// If the value before the last path is a pointer, it's dereferenced.
+// Map values on the path are copied, and must be stored back with the returned mapWriteBacks after the value is modified.
+func getValBefore(path []string, obj reflect.Value, add bool) (reflect.Value, mapWriteBacks, error) {
+	if len(path) < 1 {
+		return reflect.Value{}, nil, errors.New("malformed patch op path: the root object can't be patched, path must have at least one token")
+	}
+	wbs := mapWriteBacks(nil)
 	err := error(nil)
-	for _, part := range pathParts {
-		obj, err = getNextVal(part, obj, false)
+	for _, part := range path[:len(path)-1] {
+		obj, err = getNextVal(part, obj, add, &wbs)
 		if err != nil {
-			return reflect.Value{}, err
+			return reflect.Value{}, nil, err
+		}
+	}
+	obj, err = indirectVal(obj, add)
+	if err != nil {
+		return reflect.Value{}, nil, err
+	}
+	return obj, wbs, nil
+}
+
+// mapWriteBack is a map value which was copied so it could be modified, because map values aren't addressable.
+type mapWriteBack struct {
+	m   reflect.Value
+	key reflect.Value
+	val reflect.Value
+}
+
+// mapWriteBacks are the map values copied on a path, outermost first.
+type mapWriteBacks []mapWriteBack
+
+// store sets the copied map values back in their maps, innermost first, so copies of outer values get the modified inner values.
+func (wbs mapWriteBacks) store() {
+	for i := len(wbs) - 1; i >= 0; i-- {
+		wbs[i].m.SetMapIndex(wbs[i].key, wbs[i].val)
+	}
+}
+
+// indirectVal returns the value obj points to, if it's a pointer.
+// If add is true, a nil pointer is constructed; otherwise, an error is returned if it's nil.
+func indirectVal(obj reflect.Value, add bool) (reflect.Value, error) {
+	if obj.Kind() != reflect.Ptr {
+		return obj, nil
+	}
+	if obj.IsNil() {
+		if !add {
+			return reflect.Value{}, errors.New("object is a nil pointer")
 		}
+		if !obj.CanSet() {
+			return reflect.Value{}, errors.New("can't construct nil pointer")
+		}
+		obj.Set(reflect.New(obj.Type().Elem()))
+	}
+	return obj.Elem(), nil
+}
+
+// newMapElem returns a new value of a map element type, for adding at a missing key.
+// Maps and pointers are constructed, so further path tokens can be added to them.
+func newMapElem(elemType reflect.Type) reflect.Value {
+	val := reflect.New(elemType).Elem()
+	switch elemType.Kind() {
+	case reflect.Map:
+		val.Set(reflect.MakeMap(elemType))
+	case reflect.Ptr:
+		val.Set(reflect.New(elemType.Elem()))
 	}
-	return obj, nil
+	return val
 }
 
-func getNextVal(key string, obj reflect.Value, add bool) (reflect.Value, error) {
+// getNextVal returns the member of obj at key.
+// If add is true, nil pointers and maps are constructed, missing map keys are created, and a key of "-" or the length of a slice appends a new element.
+// If wbs is not nil, map values are returned as addressable copies, which are appended to wbs to be stored back after they're modified.
+func getNextVal(key string, obj reflect.Value, add bool, wbs *mapWriteBacks) (reflect.Value, error) {
 	switch obj.Kind() {
 	case reflect.Interface:
 		return reflect.Value{}, errors.New("interfaces aren't supported yet")
 
+	case reflect.Ptr:
+		obj, err := indirectVal(obj, add)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("getting '%+v': %+v", key, err)
+		}
+		return getNextVal(key, obj, add, wbs)
+
 	case reflect.Struct:
 		oType := obj.Type()
 		// TODO get field by toLower(name) if no tag exists, to match encoding/json pkg.
@@ -143,16 +414,24 @@ func getNextVal(key string, obj reflect.Value, add bool) (reflect.Value, error)
 		return reflect.Value{}, fmt.Errorf("object has no json tag '%+v' (only tags are supported, this library doesn't use field names like encoding/json!)", key)
 
 	case reflect.Slice:
-		partI, err := strconv.Atoi(key)
-		if err != nil {
-			return reflect.Value{}, fmt.Errorf("object at path is an array, but path element is not a number: %+v", key)
+		if add && (key == "-" || key == strconv.Itoa(obj.Len())) {
+			if !obj.CanSet() {
+				return reflect.Value{}, fmt.Errorf("can't append to slice at '%+v'", key)
+			}
+			obj.Set(reflect.Append(obj, reflect.Zero(obj.Type().Elem())))
+			return obj.Index(obj.Len() - 1), nil
 		}
-		if obj.Len() < partI {
-			return reflect.Value{}, fmt.Errorf("object is only %+v long, but path references element %+v", obj.Len(), partI)
+		partI, err := getSliceIndex(obj, key, false)
+		if err != nil {
+			return reflect.Value{}, err
 		}
 		return obj.Index(partI), nil
 	case reflect.Array:
-		return reflect.Value{}, errors.New("interfaces aren't supported yet")
+		partI, err := getSliceIndex(obj, key, false)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return obj.Index(partI), nil
 
 	case reflect.Map:
 		keyVal, err := ConvertKeyToType(key, obj.Type().Key())
@@ -165,20 +444,36 @@ func getNextVal(key string, obj reflect.Value, add bool) (reflect.Value, error)
 		mapVal := obj.MapIndex(keyVal)
 		zeroValue := reflect.Value{}
 		if mapVal != zeroValue {
-			// fmt.Println("DEBUG mapVal not zeroValue: returning")
-
-			if !mapVal.CanSet() {
-				return reflect.Value{}, fmt.Errorf("can't set map value at '%+v'", keyVal.Interface())
+			if wbs == nil {
+				return mapVal, nil
+			}
+			if !obj.CanInterface() {
+				return reflect.Value{}, errors.New("can't set value of unexported map at key '" + key + "'")
 			}
-			return mapVal, nil
+			mapValCopy := reflect.New(mapVal.Type()).Elem()
+			mapValCopy.Set(mapVal)
+			*wbs = append(*wbs, mapWriteBack{m: obj, key: keyVal, val: mapValCopy})
+			return mapValCopy, nil
 		}
 
-		if add {
-			mapVal = reflect.Zero(obj.Type().Elem())
-			obj.SetMapIndex(keyVal, mapVal)
-		} else {
+		if !add {
 			return reflect.Value{}, errors.New("map has no key '" + key + "'")
 		}
+		if !obj.CanInterface() {
+			return reflect.Value{}, errors.New("can't add key '" + key + "' to unexported map")
+		}
+		if obj.IsNil() {
+			if !obj.CanSet() {
+				return reflect.Value{}, errors.New("can't construct nil map to add key '" + key + "'")
+			}
+			obj.Set(reflect.MakeMap(obj.Type()))
+		}
+		mapVal = newMapElem(obj.Type().Elem())
+		obj.SetMapIndex(keyVal, mapVal)
+		if wbs != nil {
+			*wbs = append(*wbs, mapWriteBack{m: obj, key: keyVal, val: mapVal})
+		}
+		return mapVal, nil
 	}
 	return reflect.Value{}, fmt.Errorf("obj has no object or slice at '%+v'", key)
 }
@@ -245,45 +540,83 @@ func ConvertKeyToType(key string, keyType reflect.Type) (reflect.Value, error) {
 }
 
 // applyAdd performs a JSON Patch add op to obj at pathToken with patchValue.
-func applyAdd(obj reflect.Value, path string, patchVal interface{}) error {
-	pathParts := strings.Split(path, "/")
-	if len(pathParts) < 1 {
-		return fmt.Errorf("malformed patch op path: %+v", pathParts)
-	}
-	lastPathPart := pathParts[len(pathParts)-1]
-
-	obj, err := getValBefore(path, obj)
+func applyAdd(obj reflect.Value, path []string, patchVal interface{}, opts Options) error {
+	obj, mapWriteBacks, err := getValBefore(path, obj, opts.CreateMissing)
 	if err != nil {
 		return errors.New("getValBefore: " + err.Error())
 	}
 
-	pathToken := lastPathPart
+	pathToken := path[len(path)-1]
 
-	if obj.Kind() == reflect.Map {
-		return applyAddMap(obj, pathToken, patchVal)
-	} else {
-		return applyAddGeneric(obj, pathToken, patchVal)
+	switch {
+	case obj.Kind() == reflect.Map:
+		err = applyAddMap(obj, pathToken, patchVal, opts)
+	case obj.Kind() == reflect.Slice && opts.InsertOnAdd:
+		err = applyAddSlice(obj, pathToken, patchVal)
+	default:
+		err = applyAddGeneric(obj, pathToken, patchVal)
+	}
+	if err != nil {
+		return err
 	}
+	mapWriteBacks.store()
+	return nil
 }
 
 // applyAddMap performs a JSON Patch add op to obj at pathToken with patchValue.
 // Map values aren't addressable, so they need special logic
-func applyAddMap(obj reflect.Value, pathToken string, patchValue interface{}) error {
-	if !obj.CanSet() {
+// If opts.CreateMissing is set and the map is nil, it's constructed.
+func applyAddMap(obj reflect.Value, pathToken string, patchValue interface{}, opts Options) error {
+	if !obj.CanInterface() {
 		return errors.New("can't set value of map at path " + pathToken)
 	}
 	objKey, err := ConvertKeyToType(pathToken, obj.Type().Key())
 	if err != nil {
 		return err
 	}
-	obj.SetMapIndex(objKey, reflect.ValueOf(patchValue))
+	if obj.IsNil() {
+		if !opts.CreateMissing || !obj.CanSet() {
+			return errors.New("can't add to nil map at path " + pathToken)
+		}
+		obj.Set(reflect.MakeMap(obj.Type()))
+	}
+	val, err := getMapPatchVal(obj.Type().Elem(), patchValue, opts)
+	if err != nil {
+		return err
+	}
+	obj.SetMapIndex(objKey, val)
 	return nil
 }
 
-// applyAddMap performs a JSON Patch add op to obj at pathToken with patchValue.
+// getMapPatchVal returns patchVal as a value to set in a map of elemType.
+// A nil patchVal is the nil elemType, if it's nillable. Otherwise, patchVal must be assignable to elemType, or exactly elemType if opts.ExactMapValues is set.
+func getMapPatchVal(elemType reflect.Type, patchVal interface{}, opts Options) (reflect.Value, error) {
+	if patchVal == nil {
+		switch elemType.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			return reflect.Zero(elemType), nil
+		}
+		return reflect.Value{}, fmt.Errorf("can't set map value type '%+v' to nil", elemType)
+	}
+	patchType := reflect.TypeOf(patchVal)
+	if patchType != elemType && (opts.ExactMapValues || !patchType.AssignableTo(elemType)) {
+		return reflect.Value{}, fmt.Errorf("can't set map value type '%+v' to patch value type %T", elemType, patchVal)
+	}
+	return reflect.ValueOf(patchVal), nil
+}
+
+// applyAddSlice performs a JSON Patch add op to the slice obj at pathToken with patchValue, inserting it per RFC6902§4.1.
+func applyAddSlice(obj reflect.Value, pathToken string, patchVal interface{}) error {
+	if patchVal == nil {
+		return fmt.Errorf("can't add nil to slice of '%+v'", obj.Type().Elem().Name())
+	}
+	return applyCopySlice(obj, pathToken, reflect.ValueOf(patchVal))
+}
+
+// applyAddGeneric performs a JSON Patch add op to obj at pathToken with patchValue.
 // This func applies to all objects, except maps, which should use applyAddMap
 func applyAddGeneric(obj reflect.Value, pathToken string, patchVal interface{}) error {
-	objVal, err := getNextVal(pathToken, obj, true)
+	objVal, err := getNextVal(pathToken, obj, true, nil)
 	if err != nil {
 		return errors.New("getting or creating last value in add op: " + err.Error())
 	}
@@ -299,7 +632,7 @@ func applyAddGeneric(obj reflect.Value, pathToken string, patchVal interface{})
 	}
 
 	if !objVal.CanSet() {
-		return errors.New("can't set value at path " + pathToken)
+		return errors.New("can't set value at path " + redactToken(obj.Type(), pathToken))
 	}
 	if objVal.Type() != reflect.TypeOf(patchVal) {
 		// TODO add interface support
@@ -309,81 +642,113 @@ func applyAddGeneric(obj reflect.Value, pathToken string, patchVal interface{})
 	return nil
 }
 
-// applyRemoveMap applies a JSON Patch remove op to the given object at the given path token.
-func applyRemove(obj reflect.Value, path string) error {
-	pathParts := strings.Split(path, "/")
-	if len(pathParts) < 1 {
-		return fmt.Errorf("malformed patch op path: %+v", pathParts)
-	}
-	lastPathPart := pathParts[len(pathParts)-1]
-
-	obj, err := getValBefore(path, obj)
+// applyRemove applies a JSON Patch remove op to the given object at the given path.
+func applyRemove(obj reflect.Value, path []string, opts Options) error {
+	obj, mapWriteBacks, err := getValBefore(path, obj, false)
 	if err != nil {
 		return errors.New("getValBefore: " + err.Error())
 	}
 
-	pathToken := lastPathPart
+	pathToken := path[len(path)-1]
 
-	// TODO add slice/array remove
-	if obj.Kind() == reflect.Map {
-		return applyRemoveMap(obj, pathToken)
-	} else {
-		return applyRemoveGeneric(obj, pathToken)
+	switch obj.Kind() {
+	case reflect.Map:
+		err = applyRemoveMap(obj, pathToken, opts)
+	case reflect.Slice:
+		err = applyRemoveSlice(obj, pathToken, opts)
+	default:
+		err = applyRemoveGeneric(obj, pathToken, opts)
 	}
+	if err != nil {
+		return err
+	}
+	mapWriteBacks.store()
+	return nil
 }
 
 // applyRemoveMap applies a JSON Patch remove op to the given object at the given path token.
 // Map values aren't addressable, so they need special logic
-func applyRemoveMap(obj reflect.Value, pathToken string) error {
+func applyRemoveMap(obj reflect.Value, pathToken string, opts Options) error {
 	objKey, err := ConvertKeyToType(pathToken, obj.Type().Key())
 	if err != nil {
 		return err
 	}
-	// TODO error if key doesn't exist, per RFC6902§4.2
+	if obj.MapIndex(objKey) == (reflect.Value{}) {
+		if opts.ErrorOnRemoveMissing {
+			return errors.New("no value to remove at path " + pathToken)
+		}
+		return nil
+	}
+	if !obj.CanInterface() {
+		return errors.New("can't remove value of map at path " + pathToken)
+	}
 	obj.SetMapIndex(objKey, reflect.Value{}) // deletes the key
 	return nil
 }
 
-// applyRemoveMap applies a JSON Patch remove op to the given object at the given path token.
-// Applies to all types except maps, which must call applyRemoveMap because they need special logic.
-func applyRemoveGeneric(obj reflect.Value, pathToken string) error {
-	objVal, err := getNextVal(pathToken, obj, true)
+// applyRemoveSlice applies a JSON Patch remove op to the given slice at the given path token.
+// If opts.ShiftOnRemove is set, the elements after the removed element are shifted, per RFC6902§4.2. Otherwise, the element is set to a default-constructed object.
+func applyRemoveSlice(obj reflect.Value, pathToken string, opts Options) error {
+	i, err := getSliceIndex(obj, pathToken, false)
+	if err != nil {
+		return err
+	}
+	if !obj.CanSet() {
+		return errors.New("can't set value at path " + redactToken(obj.Type(), pathToken))
+	}
+	if opts.ShiftOnRemove {
+		removeSliceElem(obj, i)
+		return nil
+	}
+	obj.Index(i).Set(reflect.Zero(obj.Type().Elem()))
+	return nil
+}
+
+// applyRemoveGeneric applies a JSON Patch remove op to the given object at the given path token.
+// Applies to all types except maps and slices, which must call applyRemoveMap and applyRemoveSlice because they need special logic.
+func applyRemoveGeneric(obj reflect.Value, pathToken string, opts Options) error {
+	objVal, err := getNextVal(pathToken, obj, false, nil)
 	if err != nil {
 		return errors.New("getting or creating last value in remove op: " + err.Error())
 	}
+	if objVal.Kind() == reflect.Ptr {
+		if objVal.IsNil() && opts.ErrorOnRemoveMissing {
+			return errors.New("no value to remove at path " + pathToken)
+		}
+	} else if opts.ErrorOnRemoveValueField {
+		return errors.New("can't remove value field at path " + pathToken + ", only pointer fields can be removed")
+	}
 	if !objVal.CanSet() {
-		return errors.New("can't set value at path " + pathToken)
+		return errors.New("can't set value at path " + redactToken(obj.Type(), pathToken))
 	}
 	objVal.Set(reflect.Zero(objVal.Type()))
 	return nil
 }
 
-// applyAdd performs a JSON Patch add op to obj at pathToken with patchValue.
-func applyReplace(obj reflect.Value, path string, patchVal interface{}) error {
-	pathParts := strings.Split(path, "/")
-	if len(pathParts) < 1 {
-		return fmt.Errorf("malformed patch op path: %+v", pathParts)
-	}
-	lastPathPart := pathParts[len(pathParts)-1]
-
-	obj, err := getValBefore(path, obj)
+// applyReplace performs a JSON Patch replace op to obj at the path with patchValue.
+func applyReplace(obj reflect.Value, path []string, patchVal interface{}, opts Options) error {
+	obj, mapWriteBacks, err := getValBefore(path, obj, false)
 	if err != nil {
 		return errors.New("getValBefore: " + err.Error())
 	}
 
-	pathToken := lastPathPart
+	pathToken := path[len(path)-1]
 
 	if obj.Kind() == reflect.Map {
-		return applyReplaceMap(obj, pathToken, patchVal)
+		err = applyReplaceMap(obj, pathToken, patchVal, opts)
 	} else {
-		return applyReplaceGeneric(obj, pathToken, patchVal)
+		err = applyReplaceGeneric(obj, pathToken, patchVal, opts)
 	}
-
+	if err != nil {
+		return err
+	}
+	mapWriteBacks.store()
+	return nil
 }
 
-func applyReplaceMap(obj reflect.Value, pathToken string, patchVal interface{}) error {
+func applyReplaceMap(obj reflect.Value, pathToken string, patchVal interface{}, opts Options) error {
 	// map values aren't addressable, so they need special logic
-	if !obj.CanSet() {
+	if !obj.CanInterface() {
 		return errors.New("can't set value of map at path " + pathToken)
 	}
 	objKey, err := ConvertKeyToType(pathToken, obj.Type().Key())
@@ -393,21 +758,29 @@ func applyReplaceMap(obj reflect.Value, pathToken string, patchVal interface{})
 	if obj.MapIndex(objKey) == (reflect.Value{}) {
 		return errors.New("no value to replace at path " + pathToken)
 	}
-	obj.SetMapIndex(objKey, reflect.ValueOf(patchVal))
+	val, err := getMapPatchVal(obj.Type().Elem(), patchVal, opts)
+	if err != nil {
+		return err
+	}
+	obj.SetMapIndex(objKey, val)
 	return nil
 }
 
-func applyReplaceGeneric(obj reflect.Value, pathToken string, patchVal interface{}) error {
-	obj, err := getNextVal(pathToken, obj, false)
+func applyReplaceGeneric(obj reflect.Value, pathToken string, patchVal interface{}, opts Options) error {
+	reportedToken := redactToken(obj.Type(), pathToken)
+	obj, err := getNextVal(pathToken, obj, false, nil)
 	if err != nil {
 		return errors.New("getting last value in add op: " + err.Error())
 	}
+	if opts.ErrorOnReplaceNil && (obj.Kind() == reflect.Slice || obj.Kind() == reflect.Map) && obj.IsNil() {
+		return errors.New("no value to replace at path " + reportedToken)
+	}
 	if obj.Kind() == reflect.Ptr { // TODO: for loop? Allow multiple pointers?
 		obj = reflect.Indirect(obj)
 	}
 
 	if !obj.CanSet() {
-		return errors.New("can't set value at path " + pathToken)
+		return errors.New("can't set value at path " + reportedToken)
 	}
 	if obj.Type() != reflect.TypeOf(patchVal) {
 		// fmt.Printf("DEBUG Apply reflect.TypeOf(patchVal) %+v\n", reflect.TypeOf(patchVal))
@@ -419,99 +792,249 @@ func applyReplaceGeneric(obj reflect.Value, pathToken string, patchVal interface
 	return nil
 }
 
-func applyCopy(obj reflect.Value, path string, fromPath string) error {
-	_, _, err := applyCopyReturningObjs(obj, path, fromPath)
-	return err
+// applyTest performs a JSON Patch test op, returning an error if the value at path isn't equal to patchVal.
+// Values are equal if they're reflect.DeepEqual. If the value at path is a pointer and patchVal isn't, the value it points to is compared.
+func applyTest(obj reflect.Value, path []string, patchVal interface{}) error {
+	objVal, _, err := getValAt(path, obj, false)
+	if err != nil {
+		return errors.New("getting value in test op: " + err.Error())
+	}
+	if objVal.Kind() == reflect.Ptr && objVal.Type() != reflect.TypeOf(patchVal) && !objVal.IsNil() {
+		objVal = objVal.Elem()
+	}
+	if !objVal.CanInterface() {
+		return errors.New("can't test unexported value at path " + redactPath(obj.Type(), path))
+	}
+	if !reflect.DeepEqual(objVal.Interface(), patchVal) {
+		return errors.New("test op failed: value at path " + redactPath(obj.Type(), path) + " is not equal to the patch value")
+	}
+	return nil
 }
 
-// applyCopyReturningObjs applies the copy, and returns the object before the fromPath object, and the last token of fromPath, along with any error
-// If fromPath is a subpath of the path, the returned value and token will be empty.
-func applyCopyReturningObjs(obj reflect.Value, path string, fromPath string) (reflect.Value, string, error) {
-	if strings.HasPrefix(path, fromPath) {
-		if path == fromPath {
-			return reflect.Value{}, "", nil // proper prefixes are allowed, per RFC RFC6902§4.4, and moving to the same place is a no-op.
-		}
-		return reflect.Value{}, "", errors.New("move op 'from' cannot be a proper prefix of the 'path' to move into.")
+// applyCopy performs a JSON Patch copy op.
+// The value is deep-copied, so slices, maps, and pointers in it aren't shared with the 'from', and later ops on either aren't visible in the other.
+// Unlike move, the 'path' may be in the 'from' value, because the value is copied before it's added.
+func applyCopy(obj reflect.Value, path []string, fromPath []string, opts Options) error {
+	fromObj, err := getFromVal(obj, fromPath)
+	if err != nil {
+		return err
+	}
+	return applyCopyVal(obj, path, deepCopy(fromObj), opts.CreateMissing)
+}
+
+// getFromVal returns a copy of the value at the 'from' path of a copy or move op.
+// The value is copied, because the op may modify the memory at the 'from' path, for example by inserting into the same slice, before the value is set at the 'path'.
+func getFromVal(obj reflect.Value, fromPath []string) (reflect.Value, error) {
+	// the from value is only read, so map values copied on its path don't need to be stored back.
+	fromObjBefore, _, err := getValBefore(fromPath, obj, false)
+	if err != nil {
+		return reflect.Value{}, errors.New("getValBefore from: " + err.Error())
 	}
 
-	fromPathParts := strings.Split(fromPath, "/")
-	if len(fromPathParts) < 1 {
-		return reflect.Value{}, "", fmt.Errorf("malformed patch op from path: %+v", fromPathParts)
+	fromPathToken := fromPath[len(fromPath)-1]
+
+	fromObj, err := getNextVal(fromPathToken, fromObjBefore, false, nil)
+	if err != nil {
+		return reflect.Value{}, errors.New("getting last from value in move op: " + err.Error())
 	}
-	lastFromPathPart := fromPathParts[len(fromPathParts)-1]
+	fromObjCopy := reflect.New(fromObj.Type()).Elem()
+	fromObjCopy.Set(fromObj)
+	return fromObjCopy, nil
+}
 
-	fromObjBefore, err := getValBefore(fromPath, obj)
+// applyCopyVal sets the value at path to fromObj, for a JSON Patch copy or move op.
+// Like an add op, setting a slice element inserts it, shifting the following elements.
+// If create is true, missing containers before the last path token are created.
+func applyCopyVal(obj reflect.Value, path []string, fromObj reflect.Value, create bool) error {
+	obj, mapWriteBacks, err := getValBefore(path, obj, create)
 	if err != nil {
-		return reflect.Value{}, "", errors.New("getValBefore from: " + err.Error())
+		return errors.New("getValBefore: " + err.Error())
 	}
 
-	fromPathToken := lastFromPathPart
+	pathToken := path[len(path)-1]
 
-	fromObj, err := getNextVal(fromPathToken, fromObjBefore, false)
+	switch obj.Kind() {
+	case reflect.Map:
+		err = applyCopyMap(obj, pathToken, fromObj, create)
+	case reflect.Slice:
+		err = applyCopySlice(obj, pathToken, fromObj)
+	default:
+		err = applyCopyGeneric(obj, pathToken, fromObj)
+	}
 	if err != nil {
-		return reflect.Value{}, "", errors.New("getting last from value in move op: " + err.Error())
+		return err
 	}
+	mapWriteBacks.store()
+	return nil
+}
 
-	// if obj.Kind() == reflect.Ptr { // TODO: for loop? Allow multiple pointers?
-	// 	obj = reflect.Indirect(obj)
-	// }
-
-	// if !fromObj.CanSet() {
-	// 	return errors.New("can't set value at from path " + fromPathToken)
-	// }
+// applyCopyMap sets the map obj at pathToken to fromObj, for a JSON Patch copy or move op.
+// Map values aren't addressable, so they need special logic
+// If create is true and the map is nil, it's constructed.
+func applyCopyMap(obj reflect.Value, pathToken string, fromObj reflect.Value, create bool) error {
+	if !obj.CanInterface() {
+		return errors.New("can't set value of map at path " + pathToken)
+	}
+	objKey, err := ConvertKeyToType(pathToken, obj.Type().Key())
+	if err != nil {
+		return err
+	}
+	fromObj, err = convertCopyVal(fromObj, obj.Type().Elem())
+	if err != nil {
+		return err
+	}
+	if obj.IsNil() {
+		if !create || !obj.CanSet() {
+			return errors.New("can't add to nil map at path " + pathToken)
+		}
+		obj.Set(reflect.MakeMap(obj.Type()))
+	}
+	obj.SetMapIndex(objKey, fromObj)
+	return nil
+}
 
-	pathParts := strings.Split(path, "/")
-	if len(pathParts) < 1 {
-		return reflect.Value{}, "", fmt.Errorf("malformed patch op path: %+v", pathParts)
+// applyCopySlice inserts fromObj in the slice obj at pathToken, for a JSON Patch copy or move op.
+// The elements at and after pathToken are shifted, per RFC6902§4.1. A pathToken of "-" appends.
+func applyCopySlice(obj reflect.Value, pathToken string, fromObj reflect.Value) error {
+	i, err := getSliceIndex(obj, pathToken, true)
+	if err != nil {
+		return err
+	}
+	if !obj.CanSet() {
+		return errors.New("move can't set value at path " + redactToken(obj.Type(), pathToken))
 	}
-	lastPathPart := pathParts[len(pathParts)-1]
+	fromObj, err = convertCopyVal(fromObj, obj.Type().Elem())
+	if err != nil {
+		return err
+	}
+	insertSliceElem(obj, i, fromObj)
+	return nil
+}
 
-	obj, err = getValBefore(path, obj)
+// getSliceIndex returns the index of pathToken in the slice obj.
+// If add is true, the index may be one past the last element, and "-" is the index past the last element, per RFC6902§4.1.
+func getSliceIndex(obj reflect.Value, pathToken string, add bool) (int, error) {
+	if add && pathToken == "-" {
+		return obj.Len(), nil
+	}
+	if field, value, ok := parseKeySelector(pathToken); ok {
+		return getKeySelectorIndex(obj, pathToken, field, value)
+	}
+	i, err := strconv.Atoi(pathToken)
 	if err != nil {
-		return reflect.Value{}, "", errors.New("getValBefore: " + err.Error())
+		return 0, fmt.Errorf("object at path is an array, but path element is not a number: %+v", pathToken)
+	}
+	max := obj.Len() - 1
+	if add {
+		max = obj.Len()
 	}
+	if i < 0 || i > max {
+		return 0, fmt.Errorf("object is only %+v long, but path references element %+v", obj.Len(), i)
+	}
+	return i, nil
+}
+
+// insertSliceElem inserts val at index i of the settable slice obj, shifting the elements at and after i.
+func insertSliceElem(obj reflect.Value, i int, val reflect.Value) {
+	oldLen := obj.Len()
+	obj.Set(reflect.Append(obj, reflect.Zero(obj.Type().Elem())))
+	reflect.Copy(obj.Slice(i+1, oldLen+1), obj.Slice(i, oldLen))
+	obj.Index(i).Set(val)
+}
 
-	pathToken := lastPathPart
+// removeSliceElem removes index i of the settable slice obj, shifting the elements after i.
+func removeSliceElem(obj reflect.Value, i int) {
+	oldLen := obj.Len()
+	reflect.Copy(obj.Slice(i, oldLen-1), obj.Slice(i+1, oldLen))
+	obj.Index(oldLen - 1).Set(reflect.Zero(obj.Type().Elem())) // don't keep the last element alive in the backing array
+	obj.Set(obj.Slice(0, oldLen-1))
+}
+
+// sortRemovePaths sorts the paths of values to be removed in turn, so the elements of each slice are removed from the last to the first, and removing one doesn't shift the indices of the rest.
+func sortRemovePaths(paths [][]string) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		a, b := paths[i], paths[j]
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] == b[k] {
+				continue
+			}
+			aIndex, aErr := strconv.Atoi(a[k])
+			bIndex, bErr := strconv.Atoi(b[k])
+			if aErr == nil && bErr == nil {
+				return aIndex > bIndex
+			}
+			return a[k] > b[k]
+		}
+		return len(a) > len(b)
+	})
+}
 
-	obj, err = getNextVal(pathToken, obj, true)
+// applyCopyGeneric sets obj at pathToken to fromObj, for a JSON Patch copy or move op.
+// This func applies to all objects, except maps and slices, which should use applyCopyMap and applyCopySlice
+func applyCopyGeneric(obj reflect.Value, pathToken string, fromObj reflect.Value) error {
+	reportedToken := redactToken(obj.Type(), pathToken)
+	obj, err := getNextVal(pathToken, obj, true, nil)
 	if err != nil {
-		return reflect.Value{}, "", errors.New("getting last from value in move op: " + err.Error())
+		return errors.New("getting last from value in move op: " + err.Error())
 	}
 
 	if !obj.CanSet() {
-		return reflect.Value{}, "", errors.New("move can't set value at path " + pathToken)
+		return errors.New("move can't set value at path " + reportedToken)
 	}
 
-	// if the 'from' is a pointer and the 'path' isn't, or vica-versa, make the 'from' match the 'path'.
-	if fromObj.Type().Kind() == reflect.Ptr && obj.Type().Kind() != reflect.Ptr {
-		fromObj = reflect.Indirect(fromObj)
-	} else if obj.Type().Kind() == reflect.Ptr && fromObj.Type().Kind() != reflect.Ptr {
-		// make a new pointer
-		// TODO test, with a map entry (which isn't addressable)
+	fromObj, err = convertCopyVal(fromObj, obj.Type())
+	if err != nil {
+		return err
+	}
+	obj.Set(fromObj)
+	return nil
+}
+
+// convertCopyVal returns fromObj as toType, to be copied or moved into a value of that type.
+// If the 'from' is a pointer and the 'path' isn't, or vica-versa, the 'from' is made to match the 'path'.
+func convertCopyVal(fromObj reflect.Value, toType reflect.Type) (reflect.Value, error) {
+	if fromObj.Kind() == reflect.Ptr && toType.Kind() != reflect.Ptr {
+		if fromObj.IsNil() {
+			fromObj = reflect.Zero(fromObj.Type().Elem()) // a nil pointer is copied to a value as the default-constructed object, the same as remove.
+		} else {
+			fromObj = fromObj.Elem()
+		}
+	} else if toType.Kind() == reflect.Ptr && fromObj.Kind() != reflect.Ptr {
+		// make a new pointer. The from may be a map entry, which isn't addressable, so it can't be fromObj.Addr().
 		newFrom := reflect.New(fromObj.Type())
-		newFromVal := reflect.Indirect(newFrom)
-		newFromVal.Set(fromObj)
-		fromObj = newFromVal.Addr()
+		newFrom.Elem().Set(fromObj)
+		fromObj = newFrom
 	}
 
-	if fromObj.Type() != obj.Type() {
+	if fromObj.Type() != toType {
 		// TODO add interface support
-		return reflect.Value{}, "", fmt.Errorf("can't set path '%+v' to from '%+v'\n", obj.Type().Name(), fromObj.Type().Name())
+		return reflect.Value{}, fmt.Errorf("can't set path '%+v' to from '%+v'", toType.Name(), fromObj.Type().Name())
 	}
-	obj.Set(fromObj)
-
-	return fromObjBefore, fromPathToken, nil
+	return fromObj, nil
 }
 
-func applyMove(obj reflect.Value, path string, fromPath string) error {
-	fromObjBefore, fromPathToken, err := applyCopyReturningObjs(obj, path, fromPath)
+// applyMove performs a JSON Patch move op.
+// Per RFC6902§4.4, the value is removed from the 'from' location, and then added at the 'path', so slice indices in the 'path' are after the removal.
+func applyMove(obj reflect.Value, path []string, fromPath []string, opts Options) error {
+	if isPathPrefix(fromPath, path) && len(fromPath) != len(path) {
+		return errors.New("move op 'from' cannot be a proper prefix of the 'path' to move into, per RFC6902§4.4")
+	}
+	fromObj, err := getFromVal(obj, fromPath)
 	if err != nil {
 		return err
 	}
-	if fromPathToken == "" {
-		return err // empty token from applyCopyReturningObjs means fromPath is a subpath of path, so nothing was moved and we don't need to remove.
+	if len(fromPath) == len(path) && isPathPrefix(fromPath, path) {
+		return nil // moving to the same place is a no-op, once the 'from' is known to exist.
+	}
+	opts.ShiftOnRemove = true // a move inserts at its path, so it must remove its from, or slices would grow.
+	if err := applyRemove(obj, fromPath, opts); err != nil {
+		return err
 	}
-	if err := applyRemove(fromObjBefore, fromPathToken); err != nil {
+	if err := applyCopyVal(obj, path, fromObj, opts.CreateMissing); err != nil {
+		// put the removed value back, so a failed move doesn't modify the object.
+		if restoreErr := applyCopyVal(obj, fromPath, fromObj, false); restoreErr != nil {
+			return errors.New(err.Error() + ", and restoring the 'from' value failed: " + restoreErr.Error())
+		}
 		return err
 	}
 	return nil
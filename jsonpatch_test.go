@@ -1,6 +1,8 @@
 package jsonpatch
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -1037,8 +1039,8 @@ func TestCopyPtrPathNil(t *testing.T) {
 	if *obj.A.B.D != c {
 		t.Errorf("Apply obj.A.B.D expected *%+v actual %+v", c, *obj.A.B.D)
 	}
-	if obj.A.B.D != &c {
-		t.Errorf("Apply obj.A.B.D expected %+v actual %+v (new pointer)", &c, obj.A.B.D)
+	if obj.A.B.D == &c {
+		t.Errorf("Apply obj.A.B.D expected a new pointer, actual the 'from' pointer %+v", obj.A.B.D)
 	}
 }
 
@@ -1089,8 +1091,8 @@ func TestCopyPtrPathNotNil(t *testing.T) {
 	if *obj.A.B.D != c {
 		t.Errorf("Apply obj.A.B.D expected *%+v actual %+v", c, *obj.A.B.D)
 	}
-	if obj.A.B.D != &c {
-		t.Errorf("Apply obj.A.B.D expected %+v actual %+v (new pointer)", &c, obj.A.B.D)
+	if obj.A.B.D == &c {
+		t.Errorf("Apply obj.A.B.D expected a new pointer, actual the 'from' pointer %+v", obj.A.B.D)
 	}
 }
 
@@ -1225,3 +1227,1131 @@ func TestCopyFromPtr(t *testing.T) {
 		t.Fatalf("Apply obj.A.B.D expected %+v actual %+v", expected, obj.A.B.D)
 	}
 }
+
+// testOrderedMap is a Patchable which keeps its keys in insertion order.
+type testOrderedMap struct {
+	keys []string
+	vals map[string]int
+}
+
+func (m *testOrderedMap) PatchApply(op JSONPatchOp, remainingPath []string) error {
+	if len(remainingPath) != 1 {
+		return errors.New("ordered map has no nested values")
+	}
+	key := remainingPath[0]
+	switch op.Op {
+	case OpTypeAdd:
+		val, ok := op.Value.(int)
+		if !ok {
+			return fmt.Errorf("ordered map value must be an int, got %T", op.Value)
+		}
+		if _, ok := m.vals[key]; !ok {
+			m.keys = append(m.keys, key)
+		}
+		m.vals[key] = val
+		return nil
+	case OpTypeRemove:
+		if _, ok := m.vals[key]; !ok {
+			return errors.New("ordered map has no key '" + key + "'")
+		}
+		delete(m.vals, key)
+		for i, k := range m.keys {
+			if k == key {
+				m.keys = append(m.keys[:i], m.keys[i+1:]...)
+				break
+			}
+		}
+		return nil
+	case OpTypeMove:
+		val, ok := m.vals[op.From[1:]]
+		if !ok {
+			return errors.New("ordered map has no key '" + op.From[1:] + "'")
+		}
+		if err := m.PatchApply(JSONPatchOp{Op: OpTypeRemove, Path: op.From}, []string{op.From[1:]}); err != nil {
+			return err
+		}
+		return m.PatchApply(JSONPatchOp{Op: OpTypeAdd, Path: op.Path, Value: val}, remainingPath)
+	}
+	return errors.New("ordered map doesn't support op " + string(op.Op))
+}
+
+func (m *testOrderedMap) Clone() interface{} {
+	cp := &testOrderedMap{keys: append([]string(nil), m.keys...), vals: map[string]int{}}
+	for k, v := range m.vals {
+		cp.vals[k] = v
+	}
+	return cp
+}
+
+func TestPatchable(t *testing.T) {
+	type A struct {
+		M *testOrderedMap `json:"m"`
+		V testOrderedMap  `json:"v"`
+	}
+	type TestObj struct {
+		A A `json:"a"`
+	}
+
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/a/m/c",
+			Value: 42,
+		},
+		JSONPatchOp{
+			Op:   OpTypeRemove,
+			Path: "/a/m/b",
+		},
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/a/v/b",
+			Value: 24,
+		},
+		JSONPatchOp{
+			Op:   OpTypeMove,
+			Path: "/a/v/z",
+			From: "/a/v/a",
+		},
+	}
+
+	obj := &TestObj{
+		A: A{
+			M: &testOrderedMap{keys: []string{"a", "b"}, vals: map[string]int{"a": 1, "b": 2}},
+			V: testOrderedMap{keys: []string{"a"}, vals: map[string]int{"a": 1}},
+		},
+	}
+
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if expected := []string{"a", "c"}; !reflect.DeepEqual(obj.A.M.keys, expected) {
+		t.Errorf("Apply obj.A.M.keys expected %+v actual %+v", expected, obj.A.M.keys)
+	}
+	if obj.A.M.vals["c"] != 42 {
+		t.Errorf(`Apply obj.A.M.vals["c"] expected %+v actual %+v`, 42, obj.A.M.vals["c"])
+	}
+	if expected := []string{"b", "z"}; !reflect.DeepEqual(obj.A.V.keys, expected) {
+		t.Errorf("Apply obj.A.V.keys expected %+v actual %+v", expected, obj.A.V.keys)
+	}
+	if obj.A.V.vals["z"] != 1 {
+		t.Errorf(`Apply obj.A.V.vals["z"] expected %+v actual %+v`, 1, obj.A.V.vals["z"])
+	}
+}
+
+func TestPatchableReplaceSelf(t *testing.T) {
+	type TestObj struct {
+		M testOrderedMap `json:"m"`
+	}
+
+	expected := testOrderedMap{keys: []string{"x"}, vals: map[string]int{"x": 9}}
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:    OpTypeReplace,
+			Path:  "/m",
+			Value: expected,
+		},
+	}
+
+	obj := &TestObj{M: testOrderedMap{keys: []string{"a"}, vals: map[string]int{"a": 1}}}
+
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if !reflect.DeepEqual(obj.M, expected) {
+		t.Errorf("Apply obj.M expected %+v actual %+v", expected, obj.M)
+	}
+}
+
+func TestPatchableMoveOut(t *testing.T) {
+	type TestObj struct {
+		M *testOrderedMap `json:"m"`
+		I int             `json:"i"`
+	}
+
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:   OpTypeMove,
+			Path: "/i",
+			From: "/m/a",
+		},
+	}
+
+	obj := &TestObj{M: &testOrderedMap{keys: []string{"a"}, vals: map[string]int{"a": 1}}}
+
+	if err := Apply(patch, obj); err == nil {
+		t.Errorf("Apply move out of Patchable expected error, actual %+v", err)
+	}
+}
+
+func TestAddCreateMissing(t *testing.T) {
+	type Limits struct {
+		Max int `json:"max"`
+	}
+	type Item struct {
+		Name string `json:"name"`
+	}
+	type Config struct {
+		Limits *Limits                    `json:"limits"`
+		Zones  map[string]map[string]int  `json:"zones"`
+		Ptrs   map[string]*Limits         `json:"ptrs"`
+		Items  []Item                     `json:"items"`
+		Nested map[string]map[string]bool `json:"nested"`
+	}
+	type TestObj struct {
+		Config *Config `json:"config"`
+	}
+
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/config/limits/max",
+			Value: 42,
+		},
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/config/zones/us/east",
+			Value: 1,
+		},
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/config/ptrs/web/max",
+			Value: 24,
+		},
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/config/items/-/name",
+			Value: "apricot",
+		},
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/config/items/1/name",
+			Value: "blackberry",
+		},
+	}
+
+	obj := &TestObj{}
+
+	if err := ApplyWithOptions(patch, obj, Options{CreateMissing: true}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if obj.Config == nil || obj.Config.Limits == nil {
+		t.Fatalf("Apply obj.Config.Limits expected %+v actual %+v", "not nil", obj.Config)
+	}
+	if obj.Config.Limits.Max != 42 {
+		t.Errorf("Apply obj.Config.Limits.Max expected %+v actual %+v", 42, obj.Config.Limits.Max)
+	}
+	if actual := obj.Config.Zones["us"]["east"]; actual != 1 {
+		t.Errorf(`Apply obj.Config.Zones["us"]["east"] expected %+v actual %+v`, 1, actual)
+	}
+	if obj.Config.Ptrs["web"] == nil || obj.Config.Ptrs["web"].Max != 24 {
+		t.Errorf(`Apply obj.Config.Ptrs["web"].Max expected %+v actual %+v`, 24, obj.Config.Ptrs["web"])
+	}
+	if expected := []Item{{Name: "apricot"}, {Name: "blackberry"}}; !reflect.DeepEqual(obj.Config.Items, expected) {
+		t.Errorf("Apply obj.Config.Items expected %+v actual %+v", expected, obj.Config.Items)
+	}
+	if obj.Config.Nested != nil {
+		t.Errorf("Apply obj.Config.Nested expected %+v actual %+v", nil, obj.Config.Nested)
+	}
+}
+
+func TestAddCreateMissingDisabled(t *testing.T) {
+	type Limits struct {
+		Max int `json:"max"`
+	}
+	type Config struct {
+		Limits *Limits                   `json:"limits"`
+		Zones  map[string]map[string]int `json:"zones"`
+	}
+	type TestObj struct {
+		Config *Config `json:"config"`
+	}
+
+	obj := &TestObj{}
+	if err := Apply(JSONPatch{{Op: OpTypeAdd, Path: "/config/limits/max", Value: 42}}, obj); err == nil {
+		t.Errorf("Apply add to nil pointer intermediate expected error, actual %+v", err)
+	}
+	if obj.Config != nil {
+		t.Errorf("Apply failed add obj.Config expected %+v actual %+v", nil, obj.Config)
+	}
+
+	obj = &TestObj{Config: &Config{}}
+	if err := Apply(JSONPatch{{Op: OpTypeAdd, Path: "/config/zones/us/east", Value: 1}}, obj); err == nil {
+		t.Errorf("Apply add to nil map intermediate expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeAdd, Path: "/config/zones/us", Value: map[string]int{}}}, obj); err == nil {
+		t.Errorf("Apply add to nil map expected error, actual %+v", err)
+	}
+
+	// intermediates which already exist don't need to be created.
+	obj = &TestObj{Config: &Config{Limits: &Limits{}, Zones: map[string]map[string]int{"us": {}}}}
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/config/limits/max",
+			Value: 42,
+		},
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/config/zones/us/east",
+			Value: 1,
+		},
+	}
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if obj.Config.Limits.Max != 42 {
+		t.Errorf("Apply obj.Config.Limits.Max expected %+v actual %+v", 42, obj.Config.Limits.Max)
+	}
+	if actual := obj.Config.Zones["us"]["east"]; actual != 1 {
+		t.Errorf(`Apply obj.Config.Zones["us"]["east"] expected %+v actual %+v`, 1, actual)
+	}
+}
+
+func TestMapStructValue(t *testing.T) {
+	type Server struct {
+		Port int               `json:"port"`
+		Tags map[string]string `json:"tags"`
+	}
+	type Region struct {
+		Servers map[string]Server `json:"servers"`
+	}
+	type TestObj struct {
+		Servers map[string]Server            `json:"servers"`
+		Regions map[string]map[string]Region `json:"regions"`
+	}
+
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:    OpTypeReplace,
+			Path:  "/servers/web/port",
+			Value: 8080,
+		},
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/servers/web/tags/env",
+			Value: "prod",
+		},
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/regions/us/east/servers/api/port",
+			Value: 9090,
+		},
+		JSONPatchOp{
+			Op:   OpTypeRemove,
+			Path: "/regions/us/east/servers/api/tags",
+		},
+		JSONPatchOp{
+			Op:   OpTypeCopy,
+			Path: "/servers/db/port",
+			From: "/regions/us/east/servers/api/port",
+		},
+	}
+
+	obj := &TestObj{
+		Servers: map[string]Server{
+			"web": {Port: 80, Tags: map[string]string{}},
+			"db":  {Port: 5432},
+		},
+		Regions: map[string]map[string]Region{
+			"us": {
+				"east": {Servers: map[string]Server{"api": {Port: 443, Tags: map[string]string{"a": "b"}}}},
+			},
+		},
+	}
+
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if actual := obj.Servers["web"].Port; actual != 8080 {
+		t.Errorf(`Apply obj.Servers["web"].Port expected %+v actual %+v`, 8080, actual)
+	}
+	if actual := obj.Servers["web"].Tags["env"]; actual != "prod" {
+		t.Errorf(`Apply obj.Servers["web"].Tags["env"] expected %+v actual %+v`, "prod", actual)
+	}
+	api := obj.Regions["us"]["east"].Servers["api"]
+	if api.Port != 9090 {
+		t.Errorf(`Apply obj.Regions["us"]["east"].Servers["api"].Port expected %+v actual %+v`, 9090, api.Port)
+	}
+	if api.Tags != nil {
+		t.Errorf(`Apply obj.Regions["us"]["east"].Servers["api"].Tags expected %+v actual %+v`, nil, api.Tags)
+	}
+	if actual := obj.Servers["db"].Port; actual != 9090 {
+		t.Errorf(`Apply obj.Servers["db"].Port expected %+v actual %+v`, 9090, actual)
+	}
+}
+
+func TestMapStructValueFailure(t *testing.T) {
+	type Server struct {
+		Port int `json:"port"`
+	}
+	type TestObj struct {
+		Servers map[string]Server `json:"servers"`
+	}
+
+	obj := &TestObj{Servers: map[string]Server{"web": {Port: 80}}}
+
+	if err := Apply(JSONPatch{{Op: OpTypeReplace, Path: "/servers/web/port", Value: "8080"}}, obj); err == nil {
+		t.Errorf("Apply replace with wrong type expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeReplace, Path: "/servers/api/port", Value: 8080}}, obj); err == nil {
+		t.Errorf("Apply replace in nonexistent map key expected error, actual %+v", err)
+	}
+	if expected := map[string]Server{"web": {Port: 80}}; !reflect.DeepEqual(obj.Servers, expected) {
+		t.Errorf("Apply failed ops obj.Servers expected %+v actual %+v", expected, obj.Servers)
+	}
+}
+
+func TestMoveMap(t *testing.T) {
+	type A struct {
+		M map[string]int  `json:"m"`
+		N map[string]*int `json:"n"`
+		C int             `json:"c"`
+		P *int            `json:"p"`
+		S []int           `json:"s"`
+	}
+	type TestObj struct {
+		A A `json:"a"`
+	}
+
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:   OpTypeMove,
+			Path: "/a/m/y",
+			From: "/a/m/x",
+		},
+		JSONPatchOp{
+			Op:   OpTypeMove,
+			Path: "/a/n/z",
+			From: "/a/m/y",
+		},
+		JSONPatchOp{
+			Op:   OpTypeMove,
+			Path: "/a/m/c",
+			From: "/a/c",
+		},
+		JSONPatchOp{
+			Op:   OpTypeMove,
+			Path: "/a/p",
+			From: "/a/m/w",
+		},
+		JSONPatchOp{
+			Op:   OpTypeCopy,
+			Path: "/a/m/s",
+			From: "/a/s/1",
+		},
+		JSONPatchOp{
+			Op:   OpTypeCopy,
+			Path: "/a/s/-",
+			From: "/a/n/z",
+		},
+	}
+
+	obj := &TestObj{
+		A: A{
+			M: map[string]int{"x": 1, "w": 2},
+			N: map[string]*int{},
+			C: 3,
+			S: []int{4, 5},
+		},
+	}
+
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if expected := map[string]int{"c": 3, "s": 5}; !reflect.DeepEqual(obj.A.M, expected) {
+		t.Errorf("Apply obj.A.M expected %+v actual %+v", expected, obj.A.M)
+	}
+	if len(obj.A.N) != 1 || obj.A.N["z"] == nil || *obj.A.N["z"] != 1 {
+		t.Errorf(`Apply obj.A.N expected {z:*1} actual %+v`, obj.A.N)
+	}
+	if obj.A.C != 0 {
+		t.Errorf("Apply obj.A.C expected %+v actual %+v", 0, obj.A.C)
+	}
+	if obj.A.P == nil || *obj.A.P != 2 {
+		t.Errorf("Apply obj.A.P expected *%+v actual %+v", 2, obj.A.P)
+	}
+	if expected := []int{4, 5, 1}; !reflect.DeepEqual(obj.A.S, expected) {
+		t.Errorf("Apply obj.A.S expected %+v actual %+v", expected, obj.A.S)
+	}
+}
+
+func TestMoveMapErrors(t *testing.T) {
+	type A struct {
+		M map[string]int    `json:"m"`
+		S map[string]string `json:"s"`
+		N map[string]int    `json:"n"`
+	}
+	type TestObj struct {
+		A A `json:"a"`
+	}
+
+	obj := &TestObj{
+		A: A{
+			M: map[string]int{"x": 1},
+			S: map[string]string{},
+		},
+	}
+
+	if err := Apply(JSONPatch{{Op: OpTypeMove, Path: "/a/m/y", From: "/a/m/nonexistent"}}, obj); err == nil {
+		t.Errorf("Apply move from nonexistent map key expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeMove, Path: "/a/s/x", From: "/a/m/x"}}, obj); err == nil {
+		t.Errorf("Apply move to map of different type expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeMove, Path: "/a/n/x", From: "/a/m/x"}}, obj); err == nil {
+		t.Errorf("Apply move to nil map expected error, actual %+v", err)
+	}
+	if expected := map[string]int{"x": 1}; !reflect.DeepEqual(obj.A.M, expected) {
+		t.Errorf("Apply failed moves obj.A.M expected %+v actual %+v", expected, obj.A.M)
+	}
+	if len(obj.A.S) != 0 {
+		t.Errorf("Apply failed moves obj.A.S expected %+v actual %+v", map[string]string{}, obj.A.S)
+	}
+
+	if err := ApplyWithOptions(JSONPatch{{Op: OpTypeMove, Path: "/a/n/x", From: "/a/m/x"}}, obj, Options{CreateMissing: true}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if expected := map[string]int{"x": 1}; !reflect.DeepEqual(obj.A.N, expected) {
+		t.Errorf("Apply move to nil map with CreateMissing obj.A.N expected %+v actual %+v", expected, obj.A.N)
+	}
+	if len(obj.A.M) != 0 {
+		t.Errorf("Apply move to nil map with CreateMissing obj.A.M expected %+v actual %+v", map[string]int{}, obj.A.M)
+	}
+}
+
+func TestMoveSlice(t *testing.T) {
+	type A struct {
+		Items []string `json:"items"`
+		Other []string `json:"other"`
+	}
+	type TestObj struct {
+		A A `json:"a"`
+	}
+
+	tests := []struct {
+		name          string
+		patch         JSONPatch
+		expectedItems []string
+		expectedOther []string
+	}{
+		{
+			name:          "move back to front",
+			patch:         JSONPatch{{Op: OpTypeMove, From: "/a/items/3", Path: "/a/items/0"}},
+			expectedItems: []string{"d", "a", "b", "c"},
+			expectedOther: []string{"x"},
+		},
+		{
+			name:          "move front to back",
+			patch:         JSONPatch{{Op: OpTypeMove, From: "/a/items/0", Path: "/a/items/3"}},
+			expectedItems: []string{"b", "c", "d", "a"},
+			expectedOther: []string{"x"},
+		},
+		{
+			name:          "move forward",
+			patch:         JSONPatch{{Op: OpTypeMove, From: "/a/items/1", Path: "/a/items/2"}},
+			expectedItems: []string{"a", "c", "b", "d"},
+			expectedOther: []string{"x"},
+		},
+		{
+			name:          "move to end",
+			patch:         JSONPatch{{Op: OpTypeMove, From: "/a/items/1", Path: "/a/items/-"}},
+			expectedItems: []string{"a", "c", "d", "b"},
+			expectedOther: []string{"x"},
+		},
+		{
+			name:          "move to other slice",
+			patch:         JSONPatch{{Op: OpTypeMove, From: "/a/items/2", Path: "/a/other/0"}},
+			expectedItems: []string{"a", "b", "d"},
+			expectedOther: []string{"c", "x"},
+		},
+		{
+			name:          "move from other slice to end",
+			patch:         JSONPatch{{Op: OpTypeMove, From: "/a/other/0", Path: "/a/items/-"}},
+			expectedItems: []string{"a", "b", "c", "d", "x"},
+			expectedOther: []string{},
+		},
+		{
+			name:          "copy within slice",
+			patch:         JSONPatch{{Op: OpTypeCopy, From: "/a/items/2", Path: "/a/items/1"}},
+			expectedItems: []string{"a", "c", "b", "c", "d"},
+			expectedOther: []string{"x"},
+		},
+		{
+			name:          "copy to other slice end",
+			patch:         JSONPatch{{Op: OpTypeCopy, From: "/a/items/0", Path: "/a/other/1"}},
+			expectedItems: []string{"a", "b", "c", "d"},
+			expectedOther: []string{"x", "a"},
+		},
+		{
+			name:          "remove",
+			patch:         JSONPatch{{Op: OpTypeRemove, Path: "/a/items/1"}},
+			expectedItems: []string{"a", "", "c", "d"},
+			expectedOther: []string{"x"},
+		},
+	}
+
+	for _, test := range tests {
+		obj := &TestObj{
+			A: A{
+				Items: []string{"a", "b", "c", "d"},
+				Other: []string{"x"},
+			},
+		}
+		if err := Apply(test.patch, obj); err != nil {
+			t.Errorf("%v: %+v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(obj.A.Items, test.expectedItems) {
+			t.Errorf("%v: Apply obj.A.Items expected %+v actual %+v", test.name, test.expectedItems, obj.A.Items)
+		}
+		if !reflect.DeepEqual(obj.A.Other, test.expectedOther) {
+			t.Errorf("%v: Apply obj.A.Other expected %+v actual %+v", test.name, test.expectedOther, obj.A.Other)
+		}
+	}
+}
+
+func TestMoveSliceErrors(t *testing.T) {
+	type A struct {
+		Items []string `json:"items"`
+		Nums  []int    `json:"nums"`
+	}
+	type TestObj struct {
+		A A `json:"a"`
+	}
+
+	obj := &TestObj{
+		A: A{
+			Items: []string{"a", "b", "c"},
+			Nums:  []int{1},
+		},
+	}
+
+	if err := Apply(JSONPatch{{Op: OpTypeMove, From: "/a/items/0", Path: "/a/items/3"}}, obj); err == nil {
+		t.Errorf("Apply move past end after removal expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeMove, From: "/a/items/1", Path: "/a/nums/0"}}, obj); err == nil {
+		t.Errorf("Apply move to slice of different type expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeRemove, Path: "/a/items/3"}}, obj); err == nil {
+		t.Errorf("Apply remove past end expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeCopy, From: "/a/items/-", Path: "/a/items/0"}}, obj); err == nil {
+		t.Errorf("Apply copy from '-' expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeMove, From: "/a/items/3", Path: "/a/items/3"}}, obj); err == nil {
+		t.Errorf("Apply move of missing element to itself expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeMove, From: "/a/items/2", Path: "/a/items/2"}}, obj); err != nil {
+		t.Errorf("Apply move of element to itself expected nil, actual %+v", err)
+	}
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(obj.A.Items, expected) {
+		t.Errorf("Apply failed moves obj.A.Items expected %+v actual %+v", expected, obj.A.Items)
+	}
+	if expected := []int{1}; !reflect.DeepEqual(obj.A.Nums, expected) {
+		t.Errorf("Apply failed moves obj.A.Nums expected %+v actual %+v", expected, obj.A.Nums)
+	}
+}
+
+func TestRemoveSliceShiftOnRemove(t *testing.T) {
+	type TestObj struct {
+		Items []string `json:"items"`
+	}
+
+	obj := &TestObj{Items: []string{"a", "b", "c"}}
+	if err := Apply(JSONPatch{{Op: OpTypeRemove, Path: "/items/1"}}, obj); err != nil {
+		t.Fatalf("Apply remove: %+v", err)
+	}
+	if expected := []string{"a", "", "c"}; !reflect.DeepEqual(obj.Items, expected) {
+		t.Errorf("Apply remove obj.Items expected %+v actual %+v", expected, obj.Items)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeRemove, Path: "/items/3"}}, obj); err == nil {
+		t.Errorf("Apply remove past end expected error, actual %+v", err)
+	}
+
+	// a move still removes its from, so it doesn't grow the slice
+	if err := Apply(JSONPatch{{Op: OpTypeMove, From: "/items/0", Path: "/items/-"}}, obj); err != nil {
+		t.Fatalf("Apply move: %+v", err)
+	}
+	if expected := []string{"", "c", "a"}; !reflect.DeepEqual(obj.Items, expected) {
+		t.Errorf("Apply move obj.Items expected %+v actual %+v", expected, obj.Items)
+	}
+
+	opts := Options{ShiftOnRemove: true}
+	obj = &TestObj{Items: []string{"a", "b", "c"}}
+	if err := ApplyWithOptions(JSONPatch{{Op: OpTypeRemove, Path: "/items/1"}}, obj, opts); err != nil {
+		t.Fatalf("Apply ShiftOnRemove remove: %+v", err)
+	}
+	if expected := []string{"a", "c"}; !reflect.DeepEqual(obj.Items, expected) {
+		t.Errorf("Apply ShiftOnRemove remove obj.Items expected %+v actual %+v", expected, obj.Items)
+	}
+	if err := ApplyWithOptions(JSONPatch{{Op: OpTypeRemove, Path: "/items/2"}}, obj, opts); err == nil {
+		t.Errorf("Apply ShiftOnRemove remove past end expected error, actual %+v", err)
+	}
+}
+
+func TestSortRemovePaths(t *testing.T) {
+	paths := [][]string{{"a", "2"}, {"a", "10"}, {"b", "0", "c"}, {"a", "9"}, {"b", "1", "c"}}
+	sortRemovePaths(paths)
+	expected := [][]string{{"b", "1", "c"}, {"b", "0", "c"}, {"a", "10"}, {"a", "9"}, {"a", "2"}}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("sortRemovePaths expected %+v actual %+v", expected, paths)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []string
+		err      bool
+	}{
+		{path: "", expected: []string{}},
+		{path: "/", expected: []string{""}},
+		{path: "/a/b", expected: []string{"a", "b"}},
+		{path: "/a//b", expected: []string{"a", "", "b"}},
+		{path: "/a~1b/c~0d", expected: []string{"a/b", "c~d"}},
+		{path: "/~01", expected: []string{"~1"}},
+		{path: "/~10", expected: []string{"/0"}},
+		{path: "a/b", err: true},
+		{path: "/a~", err: true},
+		{path: "/a~2", err: true},
+	}
+	for _, test := range tests {
+		actual, err := ParsePath(test.path)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParsePath '%v' expected error, actual %+v", test.path, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePath '%v' expected %+v actual error %+v", test.path, test.expected, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("ParsePath '%v' expected %+v actual %+v", test.path, test.expected, actual)
+		}
+		if formatted := FormatPath(actual); formatted != test.path {
+			t.Errorf("FormatPath %+v expected '%v' actual '%v'", actual, test.path, formatted)
+		}
+	}
+}
+
+func TestIsPathPrefix(t *testing.T) {
+	tests := []struct {
+		prefix   []string
+		path     []string
+		expected bool
+	}{
+		{prefix: []string{}, path: []string{"a"}, expected: true},
+		{prefix: []string{"a"}, path: []string{"a"}, expected: true},
+		{prefix: []string{"a"}, path: []string{"a", "b"}, expected: true},
+		{prefix: []string{"a"}, path: []string{"ab"}, expected: false},
+		{prefix: []string{"a", "1"}, path: []string{"a", "10"}, expected: false},
+		{prefix: []string{"a", "b"}, path: []string{"a"}, expected: false},
+	}
+	for _, test := range tests {
+		if actual := isPathPrefix(test.prefix, test.path); actual != test.expected {
+			t.Errorf("isPathPrefix %+v %+v expected %+v actual %+v", test.prefix, test.path, test.expected, actual)
+		}
+	}
+}
+
+func TestMoveCopyPathValidation(t *testing.T) {
+	type Node struct {
+		Name  string `json:"name"`
+		Child *Node  `json:"child"`
+	}
+	type TestObj struct {
+		A    int            `json:"a"`
+		AB   int            `json:"ab"`
+		Node Node           `json:"node"`
+		M    map[string]int `json:"m"`
+		S    []int          `json:"s"`
+	}
+
+	newObj := func() *TestObj {
+		return &TestObj{
+			A:    1,
+			AB:   2,
+			Node: Node{Name: "parent"},
+			M:    map[string]int{"a/b": 3, "c~d": 4},
+			S:    []int{5, 6},
+		}
+	}
+
+	obj := newObj()
+	if err := Apply(JSONPatch{{Op: OpTypeMove, From: "/a", Path: "/ab"}}, obj); err != nil {
+		t.Fatalf("Apply move to path with 'from' as a string prefix: %+v", err)
+	}
+	if obj.A != 0 || obj.AB != 1 {
+		t.Errorf("Apply move to path with 'from' as a string prefix expected a 0 ab 1, actual a %+v ab %+v", obj.A, obj.AB)
+	}
+
+	obj = newObj()
+	if err := Apply(JSONPatch{{Op: OpTypeMove, From: "/node", Path: "/node/child"}}, obj); err == nil {
+		t.Errorf("Apply move into own descendant expected error, actual %+v", err)
+	}
+	if obj.Node.Name != "parent" || obj.Node.Child != nil {
+		t.Errorf("Apply failed move expected node unchanged, actual %+v", obj.Node)
+	}
+
+	obj = newObj()
+	if err := Apply(JSONPatch{{Op: OpTypeMove, From: "/s/0", Path: "/s/0"}}, obj); err != nil {
+		t.Fatalf("Apply move to own path: %+v", err)
+	}
+	if expected := []int{5, 6}; !reflect.DeepEqual(obj.S, expected) {
+		t.Errorf("Apply move to own path obj.S expected %+v actual %+v", expected, obj.S)
+	}
+
+	obj = newObj()
+	if err := Apply(JSONPatch{{Op: OpTypeCopy, From: "/node", Path: "/node/child"}}, obj); err != nil {
+		t.Fatalf("Apply copy into own descendant: %+v", err)
+	}
+	if obj.Node.Child == nil || obj.Node.Child.Name != "parent" || obj.Node.Child.Child != nil {
+		t.Errorf("Apply copy into own descendant obj.Node.Child expected {parent <nil>} actual %+v", obj.Node.Child)
+	}
+
+	obj = newObj()
+	if err := Apply(JSONPatch{{Op: OpTypeCopy, From: "/s/1", Path: "/s/1"}}, obj); err != nil {
+		t.Fatalf("Apply copy to own path: %+v", err)
+	}
+	if expected := []int{5, 6, 6}; !reflect.DeepEqual(obj.S, expected) {
+		t.Errorf("Apply copy to own path in slice obj.S expected %+v actual %+v", expected, obj.S)
+	}
+
+	obj = newObj()
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:   OpTypeMove,
+			From: "/m/a~1b",
+			Path: "/m/a~0b",
+		},
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/m/~1",
+			Value: 7,
+		},
+		JSONPatchOp{
+			Op:   OpTypeRemove,
+			Path: "/m/c~0d",
+		},
+	}
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("Apply escaped paths: %+v", err)
+	}
+	if expected := map[string]int{"a~b": 3, "/": 7}; !reflect.DeepEqual(obj.M, expected) {
+		t.Errorf("Apply escaped paths obj.M expected %+v actual %+v", expected, obj.M)
+	}
+
+	obj = newObj()
+	if err := Apply(JSONPatch{{Op: OpTypeReplace, Path: "a", Value: 2}}, obj); err == nil {
+		t.Errorf("Apply path without leading '/' expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeCopy, From: "/m/~", Path: "/a"}}, obj); err == nil {
+		t.Errorf("Apply malformed 'from' expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeReplace, Path: "", Value: TestObj{}}}, obj); err == nil {
+		t.Errorf("Apply root path expected error, actual %+v", err)
+	}
+}
+
+func TestCopyDeep(t *testing.T) {
+	type B struct {
+		C []int `json:"c"`
+	}
+	type TestObj struct {
+		A []string     `json:"a"`
+		B []string     `json:"b"`
+		M map[string]B `json:"m"`
+		P *B           `json:"p"`
+		Q *B           `json:"q"`
+	}
+
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:   OpTypeCopy,
+			From: "/a",
+			Path: "/b",
+		},
+		JSONPatchOp{
+			Op:    OpTypeReplace,
+			Path:  "/b/0",
+			Value: "changed",
+		},
+		JSONPatchOp{
+			Op:   OpTypeCopy,
+			From: "/m/x",
+			Path: "/m/y",
+		},
+		JSONPatchOp{
+			Op:    OpTypeReplace,
+			Path:  "/m/y/c/0",
+			Value: 10,
+		},
+		JSONPatchOp{
+			Op:   OpTypeCopy,
+			From: "/p",
+			Path: "/q",
+		},
+		JSONPatchOp{
+			Op:    OpTypeAdd,
+			Path:  "/q/c/-",
+			Value: 20,
+		},
+	}
+
+	obj := &TestObj{
+		A: []string{"a"},
+		M: map[string]B{"x": {C: []int{1}}},
+		P: &B{C: []int{2}},
+	}
+
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if expected := []string{"a"}; !reflect.DeepEqual(obj.A, expected) {
+		t.Errorf("Apply copy then replace obj.A expected %+v actual %+v", expected, obj.A)
+	}
+	if expected := []string{"changed"}; !reflect.DeepEqual(obj.B, expected) {
+		t.Errorf("Apply copy then replace obj.B expected %+v actual %+v", expected, obj.B)
+	}
+	if expected := []int{1}; !reflect.DeepEqual(obj.M["x"].C, expected) {
+		t.Errorf(`Apply copy then replace obj.M["x"].C expected %+v actual %+v`, expected, obj.M["x"].C)
+	}
+	if expected := []int{10}; !reflect.DeepEqual(obj.M["y"].C, expected) {
+		t.Errorf(`Apply copy then replace obj.M["y"].C expected %+v actual %+v`, expected, obj.M["y"].C)
+	}
+	if obj.P == obj.Q {
+		t.Errorf("Apply copy pointer expected new pointer, actual the 'from' pointer %p", obj.Q)
+	}
+	if expected := []int{2}; !reflect.DeepEqual(obj.P.C, expected) {
+		t.Errorf("Apply copy then add obj.P.C expected %+v actual %+v", expected, obj.P.C)
+	}
+	if expected := []int{2, 20}; obj.Q == nil || !reflect.DeepEqual(obj.Q.C, expected) {
+		t.Errorf("Apply copy then add obj.Q.C expected %+v actual %+v", expected, obj.Q)
+	}
+}
+
+func TestOptionsStrict(t *testing.T) {
+	type TestObj struct {
+		I int            `json:"i"`
+		P *int           `json:"p"`
+		M map[string]int `json:"m"`
+		S []int          `json:"s"`
+		N []int          `json:"n"`
+	}
+
+	newObj := func() *TestObj {
+		return &TestObj{I: 1, M: map[string]int{"a": 1}, S: []int{1, 2}}
+	}
+
+	tests := []struct {
+		name     string
+		op       JSONPatchOp
+		opts     Options
+		err      bool
+		expected *TestObj
+	}{
+		{
+			name:     "lenient remove missing key",
+			op:       JSONPatchOp{Op: OpTypeRemove, Path: "/m/b"},
+			expected: newObj(),
+		},
+		{
+			name: "strict remove missing key",
+			op:   JSONPatchOp{Op: OpTypeRemove, Path: "/m/b"},
+			opts: Options{ErrorOnRemoveMissing: true},
+			err:  true,
+		},
+		{
+			name: "strict remove nil pointer",
+			op:   JSONPatchOp{Op: OpTypeRemove, Path: "/p"},
+			opts: Options{ErrorOnRemoveMissing: true},
+			err:  true,
+		},
+		{
+			name:     "strict remove existing key",
+			op:       JSONPatchOp{Op: OpTypeRemove, Path: "/m/a"},
+			opts:     StrictOptions(),
+			expected: &TestObj{I: 1, M: map[string]int{}, S: []int{1, 2}},
+		},
+		{
+			name:     "lenient remove value field",
+			op:       JSONPatchOp{Op: OpTypeRemove, Path: "/i"},
+			expected: &TestObj{I: 0, M: map[string]int{"a": 1}, S: []int{1, 2}},
+		},
+		{
+			name: "strict remove value field",
+			op:   JSONPatchOp{Op: OpTypeRemove, Path: "/i"},
+			opts: Options{ErrorOnRemoveValueField: true},
+			err:  true,
+		},
+		{
+			name: "strict move from value field",
+			op:   JSONPatchOp{Op: OpTypeMove, From: "/i", Path: "/s/0"},
+			opts: Options{ErrorOnRemoveValueField: true},
+			err:  true,
+		},
+		{
+			name:     "lenient add slice element",
+			op:       JSONPatchOp{Op: OpTypeAdd, Path: "/s/0", Value: 3},
+			expected: &TestObj{I: 1, M: map[string]int{"a": 1}, S: []int{3, 2}},
+		},
+		{
+			name:     "strict add slice element",
+			op:       JSONPatchOp{Op: OpTypeAdd, Path: "/s/0", Value: 3},
+			opts:     Options{InsertOnAdd: true},
+			expected: &TestObj{I: 1, M: map[string]int{"a": 1}, S: []int{3, 1, 2}},
+		},
+		{
+			name:     "strict add slice end",
+			op:       JSONPatchOp{Op: OpTypeAdd, Path: "/s/-", Value: 3},
+			opts:     Options{InsertOnAdd: true},
+			expected: &TestObj{I: 1, M: map[string]int{"a": 1}, S: []int{1, 2, 3}},
+		},
+		{
+			name: "strict add slice past end",
+			op:   JSONPatchOp{Op: OpTypeAdd, Path: "/s/3", Value: 3},
+			opts: Options{InsertOnAdd: true},
+			err:  true,
+		},
+		{
+			name:     "lenient replace nil slice",
+			op:       JSONPatchOp{Op: OpTypeReplace, Path: "/n", Value: []int{4}},
+			expected: &TestObj{I: 1, M: map[string]int{"a": 1}, S: []int{1, 2}, N: []int{4}},
+		},
+		{
+			name: "strict replace nil slice",
+			op:   JSONPatchOp{Op: OpTypeReplace, Path: "/n", Value: []int{4}},
+			opts: Options{ErrorOnReplaceNil: true},
+			err:  true,
+		},
+		{
+			name: "add map value of wrong type",
+			op:   JSONPatchOp{Op: OpTypeAdd, Path: "/m/a", Value: "1"},
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		obj := newObj()
+		err := ApplyWithOptions(JSONPatch{test.op}, obj, test.opts)
+		if test.err {
+			if err == nil {
+				t.Errorf("%v: expected error, actual %+v", test.name, err)
+			}
+			if !reflect.DeepEqual(obj, newObj()) {
+				t.Errorf("%v: failed op expected object unchanged, actual %+v", test.name, obj)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %+v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(obj, test.expected) {
+			t.Errorf("%v: expected %+v actual %+v", test.name, test.expected, obj)
+		}
+	}
+}
+
+func TestMapInterfaceValues(t *testing.T) {
+	type TestObj struct {
+		M map[string]interface{} `json:"m"`
+		N map[string]int         `json:"n"`
+	}
+
+	patch := JSONPatch{
+		{Op: OpTypeAdd, Path: "/m/a", Value: "x"},
+		{Op: OpTypeAdd, Path: "/m/b", Value: nil},
+		{Op: OpTypeReplace, Path: "/m/c", Value: 2},
+	}
+	obj := &TestObj{M: map[string]interface{}{"c": 1}, N: map[string]int{"d": 3}}
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("Apply map interface values: %+v", err)
+	}
+	if expected := map[string]interface{}{"a": "x", "b": nil, "c": 2}; !reflect.DeepEqual(obj.M, expected) {
+		t.Errorf("Apply obj.M expected %+v actual %+v", expected, obj.M)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeAdd, Path: "/n/d", Value: nil}}, obj); err == nil {
+		t.Errorf("Apply add nil to map of int expected error, actual %+v", err)
+	}
+	if err := Apply(JSONPatch{{Op: OpTypeReplace, Path: "/n/d", Value: "x"}}, obj); err == nil {
+		t.Errorf("Apply replace map of int with string expected error, actual %+v", err)
+	}
+
+	obj = &TestObj{M: map[string]interface{}{"c": 1}}
+	if err := ApplyWithOptions(JSONPatch{{Op: OpTypeAdd, Path: "/m/x", Value: 1}}, obj, StrictOptions()); err != nil {
+		t.Errorf("Apply strict add int to map of interface expected nil, actual %+v", err)
+	}
+
+	opts := Options{ExactMapValues: true}
+	obj = &TestObj{M: map[string]interface{}{"c": 1}}
+	if err := ApplyWithOptions(JSONPatch{{Op: OpTypeAdd, Path: "/m/a", Value: "x"}}, obj, opts); err == nil {
+		t.Errorf("Apply ExactMapValues add string to map of interface expected error, actual %+v", err)
+	}
+	if err := ApplyWithOptions(JSONPatch{{Op: OpTypeReplace, Path: "/m/c", Value: 2}}, obj, opts); err == nil {
+		t.Errorf("Apply ExactMapValues replace int in map of interface expected error, actual %+v", err)
+	}
+	if expected := map[string]interface{}{"c": 1}; !reflect.DeepEqual(obj.M, expected) {
+		t.Errorf("Apply ExactMapValues failures obj.M expected %+v actual %+v", expected, obj.M)
+	}
+}
+
+func TestTestOp(t *testing.T) {
+	type B struct {
+		C int `json:"c"`
+	}
+	type TestObj struct {
+		I int            `json:"i"`
+		P *int           `json:"p"`
+		M map[string]B   `json:"m"`
+		S []string       `json:"s"`
+		N map[string]int `json:"n"`
+	}
+
+	p := 42
+	obj := &TestObj{
+		I: 1,
+		P: &p,
+		M: map[string]B{"x": {C: 2}},
+		S: []string{"a", "b"},
+	}
+
+	passing := JSONPatch{
+		{Op: OpTypeTest, Path: "/i", Value: 1},
+		{Op: OpTypeTest, Path: "/p", Value: 42},
+		{Op: OpTypeTest, Path: "/p", Value: &p},
+		{Op: OpTypeTest, Path: "/m/x", Value: B{C: 2}},
+		{Op: OpTypeTest, Path: "/m/x/c", Value: 2},
+		{Op: OpTypeTest, Path: "/s", Value: []string{"a", "b"}},
+		{Op: OpTypeTest, Path: "/s/1", Value: "b"},
+		{Op: OpTypeTest, Path: "/n", Value: map[string]int(nil)},
+	}
+	for _, op := range passing {
+		if err := Apply(JSONPatch{op}, obj); err != nil {
+			t.Errorf("Apply test %v %+v expected success, actual %+v", op.Path, op.Value, err)
+		}
+	}
+
+	failing := JSONPatch{
+		{Op: OpTypeTest, Path: "/i", Value: 2},
+		{Op: OpTypeTest, Path: "/i", Value: int64(1)},
+		{Op: OpTypeTest, Path: "/p", Value: 41},
+		{Op: OpTypeTest, Path: "/m/y", Value: B{C: 2}},
+		{Op: OpTypeTest, Path: "/s", Value: []string{"b", "a"}},
+		{Op: OpTypeTest, Path: "/s/2", Value: "c"},
+		{Op: OpTypeTest, Path: "/nonexistent", Value: 1},
+	}
+	for _, op := range failing {
+		if err := Apply(JSONPatch{op}, obj); err == nil {
+			t.Errorf("Apply test %v %+v expected error, actual %+v", op.Path, op.Value, err)
+		}
+	}
+}
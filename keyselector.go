@@ -0,0 +1,182 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// parseKeySelector parses a path token of the form "[field=value]", which selects the slice element whose field, or map key, is value.
+// Returns false if the token isn't a key selector.
+func parseKeySelector(token string) (string, string, bool) {
+	if len(token) < 2 || token[0] != '[' || token[len(token)-1] != ']' {
+		return "", "", false
+	}
+	field, val, ok := strings.Cut(token[1:len(token)-1], "=")
+	if !ok || field == "" {
+		return "", "", false
+	}
+	return field, val, true
+}
+
+// getKeySelectorIndex returns the index of the single element of the slice or array obj which matches the key selector.
+// Returns an error if no element or more than one element matches.
+func getKeySelectorIndex(obj reflect.Value, token string, field string, value string) (int, error) {
+	matches := getKeySelectorMatches(obj, field, value)
+	token = redactKeySelector(obj.Type().Elem(), token, field)
+	if len(matches) == 0 {
+		return 0, errors.New("key selector " + token + " matches no element")
+	}
+	if len(matches) > 1 {
+		return 0, errors.New("key selector " + token + " matches more than one element, " + strconv.Itoa(matches[0]) + " and " + strconv.Itoa(matches[1]))
+	}
+	return matches[0], nil
+}
+
+// getKeySelectorMatches returns the indices of the elements of the slice or array obj whose field is value.
+// An element matches if it's a struct whose field with the json tag field is value, or a map whose key field is value, after dereferencing pointers.
+func getKeySelectorMatches(obj reflect.Value, field string, value string) []int {
+	matches := []int{}
+	for i := 0; i < obj.Len(); i++ {
+		if keySelectorMatches(obj.Index(i), field, value) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// keySelectorMatches returns whether elem has the field or map key with the value.
+func keySelectorMatches(elem reflect.Value, field string, value string) bool {
+	elemVal, ok := getKeyVal(elem, field)
+	return ok && elemVal == value
+}
+
+// getKeyVal returns the value of the field of elem with the json tag field, or of its map key field, after dereferencing pointers, formatted as in a key selector.
+// Returns false if elem has no such field or key, or if its value isn't a string, number, or bool.
+func getKeyVal(elem reflect.Value, field string) (string, bool) {
+	elem, ok := indirectSelectorVal(elem)
+	if !ok {
+		return "", false
+	}
+	switch elem.Kind() {
+	case reflect.Struct:
+		for i := 0; i < elem.NumField(); i++ {
+			if elemField := elem.Type().Field(i); isPathField(elemField) && elemField.Tag.Get("json") == field {
+				return formatSelectorVal(elem.Field(i))
+			}
+		}
+	case reflect.Map:
+		key, err := ConvertKeyToType(field, elem.Type().Key())
+		if err != nil {
+			return "", false
+		}
+		mapVal := elem.MapIndex(key)
+		if !mapVal.IsValid() {
+			return "", false
+		}
+		return formatSelectorVal(mapVal)
+	}
+	return "", false
+}
+
+// indirectSelectorVal dereferences pointers and interfaces, returning false if any is nil.
+func indirectSelectorVal(val reflect.Value) (reflect.Value, bool) {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return reflect.Value{}, false
+		}
+		val = val.Elem()
+	}
+	return val, true
+}
+
+// formatSelectorVal returns the value as it's written in a key selector, or false if it isn't a string, number, or bool.
+func formatSelectorVal(val reflect.Value) (string, bool) {
+	val, ok := indirectSelectorVal(val)
+	if !ok {
+		return "", false
+	}
+	switch val.Kind() {
+	case reflect.String:
+		return val.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(val.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(val.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(val.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(val.Float(), 'g', -1, val.Type().Bits()), true
+	}
+	return "", false
+}
+
+// hasKeySelector returns whether any token of the path is a key selector.
+func hasKeySelector(path []string) bool {
+	for _, token := range path {
+		if _, _, ok := parseKeySelector(token); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveKeySelectors returns the path with the key selectors on slices and arrays in obj replaced by the indices they select.
+// If the path doesn't exist in obj, the tokens after the missing member are returned unchanged, so applying the path returns its own error.
+func resolveKeySelectors(path []string, obj reflect.Value) ([]string, error) {
+	resolved := append([]string{}, path...)
+	for i, token := range path {
+		elems, ok := indirectSelectorVal(obj)
+		if !ok {
+			return resolved, nil
+		}
+		if field, value, ok := parseKeySelector(token); ok && (elems.Kind() == reflect.Slice || elems.Kind() == reflect.Array) {
+			idx, err := getKeySelectorIndex(elems, token, field, value)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = strconv.Itoa(idx)
+		}
+		next, err := getNextVal(resolved[i], elems, false, nil)
+		if err != nil {
+			return resolved, nil
+		}
+		obj = next
+	}
+	return resolved, nil
+}
+
+// resolveOpKeySelectors returns the op with the key selectors in its path and from replaced by the indices they select in obj.
+// The path of a move is resolved after its from is removed, as the op applies it.
+func (p *Patcher) resolveOpKeySelectors(obj reflect.Value, op JSONPatchOp) (JSONPatchOp, error) {
+	if op.Op == OpTypeMove || op.Op == OpTypeCopy {
+		from, err := ParsePath(op.From)
+		if err != nil {
+			return op, err
+		}
+		if hasKeySelector(from) {
+			if from, err = resolveKeySelectors(from, obj); err != nil {
+				return op, err
+			}
+			op.From = FormatPath(from)
+		}
+	}
+	path, err := ParsePath(op.Path)
+	if err != nil || !hasKeySelector(path) {
+		return op, err
+	}
+	target := obj
+	if op.Op == OpTypeMove {
+		target = reflect.New(obj.Type()).Elem()
+		target.Set(deepCopy(obj))
+		if err := p.applyOp(target, JSONPatchOp{Op: OpTypeRemove, Path: op.From}); err != nil {
+			return op, err
+		}
+	}
+	if path, err = resolveKeySelectors(path, target); err != nil {
+		return op, err
+	}
+	op.Path = FormatPath(path)
+	return op, nil
+}
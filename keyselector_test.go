@@ -0,0 +1,141 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeySelector(t *testing.T) {
+	type Server struct {
+		Name    string `json:"name"`
+		Port    int    `json:"port"`
+		Enabled bool   `json:"enabled"`
+	}
+	type TestObj struct {
+		Servers []Server            `json:"servers"`
+		Backups []*Server           `json:"backups"`
+		Routes  []map[string]string `json:"routes"`
+		Ports   [2]Server           `json:"ports"`
+	}
+
+	patch := JSONPatch{
+		{Op: OpTypeTest, Path: "/servers/[name=api]/port", Value: 8080},
+		{Op: OpTypeReplace, Path: "/servers/[name=web]/port", Value: 8000},
+		{Op: OpTypeReplace, Path: "/servers/[port=5432]/enabled", Value: true},
+		{Op: OpTypeReplace, Path: "/backups/[name=web]/port", Value: 82},
+		{Op: OpTypeReplace, Path: "/routes/[host=b.example]/host", Value: "c.example"},
+		{Op: OpTypeReplace, Path: "/ports/[enabled=true]/port", Value: 8443},
+		{Op: OpTypeAdd, Path: "/servers/-", Value: Server{Name: "cache"}},
+		{Op: OpTypeMove, From: "/servers/[name=db]", Path: "/servers/0"},
+		{Op: OpTypeRemove, Path: "/servers/[name=api]"},
+		{Op: OpTypeReplace, Path: "/servers/1/port", Value: 8001},
+	}
+
+	obj := &TestObj{
+		Servers: []Server{{Name: "web", Port: 80}, {Name: "api", Port: 8080}, {Name: "db", Port: 5432}},
+		Backups: []*Server{nil, {Name: "web", Port: 81}},
+		Routes:  []map[string]string{{"host": "a.example"}, {"host": "b.example"}},
+		Ports:   [2]Server{{Name: "http", Port: 80}, {Name: "https", Port: 443, Enabled: true}},
+	}
+
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if expected := []Server{{Name: "db", Port: 5432, Enabled: true}, {Name: "web", Port: 8001}, {}, {Name: "cache"}}; !reflect.DeepEqual(obj.Servers, expected) {
+		t.Errorf("Apply obj.Servers expected %+v actual %+v", expected, obj.Servers)
+	}
+	if obj.Backups[0] != nil || obj.Backups[1].Port != 82 {
+		t.Errorf("Apply obj.Backups expected [nil {web 82}] actual [%+v %+v]", obj.Backups[0], obj.Backups[1])
+	}
+	if obj.Routes[1]["host"] != "c.example" {
+		t.Errorf(`Apply obj.Routes[1]["host"] expected %+v actual %+v`, "c.example", obj.Routes[1]["host"])
+	}
+	if obj.Ports[0].Port != 80 || obj.Ports[1].Port != 8443 {
+		t.Errorf("Apply obj.Ports expected ports 80 8443 actual %+v", obj.Ports)
+	}
+}
+
+func TestKeySelectorErrors(t *testing.T) {
+	type Server struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Servers []Server `json:"servers"`
+	}
+
+	tests := []struct {
+		name   string
+		op     JSONPatchOp
+		errStr string
+	}{
+		{"no match", JSONPatchOp{Op: OpTypeReplace, Path: "/servers/[name=mail]/port", Value: 25}, "matches no element"},
+		{"multiple matches", JSONPatchOp{Op: OpTypeReplace, Path: "/servers/[port=80]/name", Value: "x"}, "matches more than one element, 0 and 1"},
+		{"unknown field", JSONPatchOp{Op: OpTypeRemove, Path: "/servers/[host=web]"}, "matches no element"},
+		{"not a selector", JSONPatchOp{Op: OpTypeRemove, Path: "/servers/[name]"}, "not a number"},
+		{"from", JSONPatchOp{Op: OpTypeCopy, From: "/servers/[name=mail]", Path: "/servers/-"}, "matches no element"},
+	}
+	for _, test := range tests {
+		obj := &TestObj{Servers: []Server{{Name: "web", Port: 80}, {Name: "api", Port: 80}}}
+		err := Apply(JSONPatch{test.op}, obj)
+		if err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("Apply key selector %v error expected '%v' actual %+v", test.name, test.errStr, err)
+		}
+	}
+}
+
+func TestKeySelectorMapKey(t *testing.T) {
+	type TestObj struct {
+		Routes []map[string]string `json:"routes"`
+	}
+
+	// a bracketed map key isn't a selector
+	obj := &TestObj{Routes: []map[string]string{{"[x]": "y"}}}
+	if err := Apply(JSONPatch{{Op: OpTypeReplace, Path: "/routes/0/[x]", Value: "z"}}, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if obj.Routes[0]["[x]"] != "z" {
+		t.Errorf(`Apply obj.Routes[0]["[x]"] expected %+v actual %+v`, "z", obj.Routes[0]["[x]"])
+	}
+}
+
+func TestKeySelectorCRDTDocument(t *testing.T) {
+	type Server struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Servers []Server `json:"servers"`
+	}
+
+	initial := TestObj{Servers: []Server{{Name: "web", Port: 80}, {Name: "api", Port: 8080}, {Name: "db", Port: 5432}}}
+	doc, err := NewCRDTDocument("a", initial)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	other, err := NewCRDTDocument("b", initial)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	patch := JSONPatch{
+		{Op: OpTypeReplace, Path: "/servers/[name=api]/port", Value: 9000},
+		{Op: OpTypeMove, From: "/servers/[name=web]", Path: "/servers/[name=db]"},
+	}
+	if err := doc.Apply(patch); err != nil {
+		t.Fatalf("CRDTDocument.Apply key selectors error expected nil actual %+v", err)
+	}
+	if err := other.Import(doc.Ops()); err != nil {
+		t.Fatalf("CRDTDocument.Import error expected nil actual %+v", err)
+	}
+
+	// the move removes web, so db is at index 1, and web is inserted before it
+	expected := []Server{{Name: "api", Port: 9000}, {Name: "web", Port: 80}, {Name: "db", Port: 5432}}
+	if val := doc.Value(); !reflect.DeepEqual(val.Servers, expected) {
+		t.Errorf("CRDTDocument.Apply key selectors expected %+v actual %+v", expected, val.Servers)
+	}
+	if val := other.Value(); !reflect.DeepEqual(val.Servers, expected) {
+		t.Errorf("CRDTDocument.Import key selectors expected %+v actual %+v", expected, val.Servers)
+	}
+}
@@ -0,0 +1,239 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Conflict is a value which both sides of a three-way merge changed differently.
+type Conflict struct {
+	// Path is the JSON Pointer to the value. It's the outermost value which both sides changed, so for example if ours replaced a struct and theirs changed one of its fields, it's the struct.
+	Path string
+
+	// Base, Ours, and Theirs are copies of the value in each object, or nil if it doesn't exist there, for example a removed map key or nil pointer.
+	Base   interface{}
+	Ours   interface{}
+	Theirs interface{}
+}
+
+// MergeStrategy resolves a Conflict, returning the merged value, which must be the type of the value at the conflict Path, or the type it points to.
+// If it returns nil, the value is removed.
+type MergeStrategy func(c Conflict) (interface{}, error)
+
+// OursWins is a MergeStrategy which resolves conflicts with our value.
+func OursWins(c Conflict) (interface{}, error) {
+	return c.Ours, nil
+}
+
+// TheirsWins is a MergeStrategy which resolves conflicts with their value.
+func TheirsWins(c Conflict) (interface{}, error) {
+	return c.Theirs, nil
+}
+
+// Merge3 merges the changes from base to ours and from base to theirs, and returns the merged object and the conflicts, which are resolved with OursWins.
+// See Merge3WithStrategy.
+func Merge3[T any](base T, ours T, theirs T) (T, []Conflict, error) {
+	return Merge3WithStrategy(base, ours, theirs, OursWins)
+}
+
+// Merge3WithStrategy merges the changes from base to ours and from base to theirs, as computed by Diff, and returns the merged object and the conflicts, which are resolved with strategy.
+//
+// Changes to different values are merged. Changes which are the same on both sides are merged once. Changes to the same value, or where one side changes a value which contains a value the other changes, are conflicts.
+// Slices are diffed by index, so if both sides add or remove elements of the same slice, the whole slice is a conflict, because the indexes of the other side's changes have shifted.
+//
+// Returns an error if either side can't be diffed, or if the strategy returns an error or a value of the wrong type.
+func Merge3WithStrategy[T any](base T, ours T, theirs T, strategy MergeStrategy) (T, []Conflict, error) {
+	oursPatch, err := Diff(&base, &ours)
+	if err != nil {
+		return *new(T), nil, errors.New("diffing ours: " + err.Error())
+	}
+	theirsPatch, err := Diff(&base, &theirs)
+	if err != nil {
+		return *new(T), nil, errors.New("diffing theirs: " + err.Error())
+	}
+	oursPaths, err := parsePatchPaths(oursPatch)
+	if err != nil {
+		return *new(T), nil, err
+	}
+	theirsPaths, err := parsePatchPaths(theirsPatch)
+	if err != nil {
+		return *new(T), nil, err
+	}
+
+	baseVal := reflect.ValueOf(&base).Elem()
+	conflictPaths := [][]string{}
+	sameAsOurs := map[int]bool{}
+	for i, oursPath := range oursPaths {
+		for j, theirsPath := range theirsPaths {
+			if !isPathPrefix(oursPath, theirsPath) && !isPathPrefix(theirsPath, oursPath) {
+				continue
+			}
+			if reflect.DeepEqual(oursPatch[i], theirsPatch[j]) {
+				sameAsOurs[j] = true
+				continue
+			}
+			conflictPaths = addConflictPath(conflictPaths, getConflictPath(baseVal, oursPaths[i], oursPatch[i].Op, theirsPaths[j], theirsPatch[j].Op))
+		}
+	}
+
+	mergedPatch := JSONPatch{}
+	for i, op := range oursPatch {
+		if !hasPathPrefix(conflictPaths, oursPaths[i]) {
+			mergedPatch = append(mergedPatch, op)
+		}
+	}
+	for j, op := range theirsPatch {
+		if !sameAsOurs[j] && !hasPathPrefix(conflictPaths, theirsPaths[j]) {
+			mergedPatch = append(mergedPatch, op)
+		}
+	}
+
+	merged := copyDocumentVal(base)
+	if err := Apply(mergedPatch, &merged); err != nil {
+		return *new(T), nil, errors.New("applying merged changes: " + err.Error())
+	}
+
+	mergedVal := reflect.ValueOf(&merged).Elem()
+	oursVal := reflect.ValueOf(&ours).Elem()
+	theirsVal := reflect.ValueOf(&theirs).Elem()
+	conflicts := []Conflict{}
+	for _, path := range conflictPaths {
+		c := Conflict{Path: FormatPath(path)}
+		c.Base, _ = getPreviewVal(baseVal, path)
+		c.Ours, _ = getPreviewVal(oursVal, path)
+		c.Theirs, _ = getPreviewVal(theirsVal, path)
+		conflicts = append(conflicts, c)
+
+		val, err := strategy(c)
+		if err != nil {
+			return *new(T), nil, errors.New("resolving conflict at '" + c.Path + "': " + err.Error())
+		}
+		if err := setMergeVal(mergedVal, path, val); err != nil {
+			return *new(T), nil, errors.New("resolving conflict at '" + c.Path + "': " + err.Error())
+		}
+	}
+	return merged, conflicts, nil
+}
+
+// parsePatchPaths returns the parsed Path of each op in the patch.
+func parsePatchPaths(patch JSONPatch) ([][]string, error) {
+	paths := make([][]string, 0, len(patch))
+	for _, op := range patch {
+		path, err := ParsePath(op.Path)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// getConflictPath returns the path of the conflict between two ops with overlapping paths, which is the shorter path, or the slice if either op adds or removes a slice element.
+func getConflictPath(base reflect.Value, pathA []string, opA OpType, pathB []string, opB OpType) []string {
+	path := pathA
+	if len(pathB) < len(pathA) {
+		path = pathB
+	}
+	for _, op := range []struct {
+		path   []string
+		opType OpType
+	}{{pathA, opA}, {pathB, opB}} {
+		if op.opType != OpTypeAdd && op.opType != OpTypeRemove {
+			continue
+		}
+		parentPath := op.path[:len(op.path)-1]
+		if len(parentPath) < len(path) && isSlicePath(base, parentPath) {
+			path = parentPath
+		}
+	}
+	return path
+}
+
+// isSlicePath returns whether the value at path in obj is a slice, or a pointer to one.
+func isSlicePath(obj reflect.Value, path []string) bool {
+	val, _, err := getValAt(path, obj, false)
+	if err != nil {
+		return false
+	}
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	return val.Kind() == reflect.Slice
+}
+
+// addConflictPath adds path to paths, unless a path in paths is its prefix, and removes the paths it's a prefix of.
+func addConflictPath(paths [][]string, path []string) [][]string {
+	if hasPathPrefix(paths, path) {
+		return paths
+	}
+	kept := paths[:0]
+	for _, existing := range paths {
+		if !isPathPrefix(path, existing) {
+			kept = append(kept, existing)
+		}
+	}
+	return append(kept, path)
+}
+
+// hasPathPrefix returns whether any of the prefixes is a prefix of path.
+func hasPathPrefix(prefixes [][]string, path []string) bool {
+	for _, prefix := range prefixes {
+		if isPathPrefix(prefix, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// setMergeVal sets the value at path in obj to a copy of val, or removes it if val is nil.
+// The val may be the type of the value at path, or the type it points to.
+func setMergeVal(obj reflect.Value, path []string, val interface{}) error {
+	if val == nil {
+		return applyRemove(obj, path, Options{})
+	}
+	parent, mapWriteBacks, err := getValBefore(path, obj, false)
+	if err != nil {
+		return errors.New("getValBefore: " + err.Error())
+	}
+	pathToken := path[len(path)-1]
+	newVal := deepCopy(reflect.ValueOf(val))
+
+	if parent.Kind() == reflect.Map {
+		key, err := ConvertKeyToType(pathToken, parent.Type().Key())
+		if err != nil {
+			return err
+		}
+		if newVal, err = convertMergeVal(newVal, parent.Type().Elem()); err != nil {
+			return err
+		}
+		parent.SetMapIndex(key, newVal)
+	} else {
+		target, err := getNextVal(pathToken, parent, false, nil)
+		if err != nil {
+			return err
+		}
+		if !target.CanSet() {
+			return errors.New("can't set value at path " + redactToken(parent.Type(), pathToken))
+		}
+		if newVal, err = convertMergeVal(newVal, target.Type()); err != nil {
+			return err
+		}
+		target.Set(newVal)
+	}
+	mapWriteBacks.store()
+	return nil
+}
+
+// convertMergeVal returns val as typ, which must be its type, or a pointer to its type.
+func convertMergeVal(val reflect.Value, typ reflect.Type) (reflect.Value, error) {
+	if val.Type() == typ {
+		return val, nil
+	}
+	if typ.Kind() == reflect.Ptr && val.Type() == typ.Elem() {
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(val)
+		return ptr, nil
+	}
+	return reflect.Value{}, fmt.Errorf("can't set value of type %+v to merged value type %+v", typ, val.Type())
+}
@@ -0,0 +1,210 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	type Server struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Name    string            `json:"name"`
+		Limit   *int              `json:"limit"`
+		Tags    []string          `json:"tags"`
+		Servers map[string]Server `json:"servers"`
+		Backup  Server            `json:"backup"`
+	}
+
+	base := TestObj{
+		Name:    "web",
+		Tags:    []string{"a", "b"},
+		Servers: map[string]Server{"a": {Host: "a.example", Port: 80}, "b": {Host: "b.example", Port: 80}},
+		Backup:  Server{Host: "backup.example", Port: 80},
+	}
+	ours := deepCopy(reflect.ValueOf(base)).Interface().(TestObj)
+	theirs := deepCopy(reflect.ValueOf(base)).Interface().(TestObj)
+
+	ours.Name = "api"
+	ours.Servers["a"] = Server{Host: "a.example", Port: 8080}
+	ours.Servers["c"] = Server{Host: "c.example"}
+	ours.Tags[0] = "x"
+	theirs.Backup.Port = 9090
+	theirs.Servers["a"] = Server{Host: "a2.example", Port: 80}
+	delete(theirs.Servers, "b")
+	theirs.Tags = append(theirs.Tags, "c")
+	limit := 5
+	theirs.Limit = &limit
+	theirs.Name = "api"
+
+	merged, conflicts, err := Merge3(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("Merge3 error expected nil actual %+v", err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("Merge3 conflicts expected none actual %+v", conflicts)
+	}
+	expected := TestObj{
+		Name:    "api",
+		Limit:   &limit,
+		Tags:    []string{"x", "b", "c"},
+		Servers: map[string]Server{"a": {Host: "a2.example", Port: 8080}, "c": {Host: "c.example"}},
+		Backup:  Server{Host: "backup.example", Port: 9090},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("Merge3 expected %+v actual %+v", expected, merged)
+	}
+	if base.Name != "web" || base.Tags[0] != "a" || len(base.Servers) != 2 || base.Servers["a"].Port != 80 || base.Backup.Port != 80 {
+		t.Errorf("Merge3 expected base unchanged actual %+v", base)
+	}
+	if merged.Limit == theirs.Limit {
+		t.Errorf("Merge3 expected merged not to alias theirs")
+	}
+}
+
+func TestMerge3Conflicts(t *testing.T) {
+	type Server struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Name    string            `json:"name"`
+		Limit   *int              `json:"limit"`
+		Tags    []string          `json:"tags"`
+		Servers map[string]Server `json:"servers"`
+		Backup  Server            `json:"backup"`
+	}
+
+	base := TestObj{
+		Name:    "web",
+		Tags:    []string{"a", "b"},
+		Servers: map[string]Server{"a": {Host: "a.example", Port: 80}, "b": {Host: "b.example", Port: 80}},
+		Backup:  Server{Host: "backup.example", Port: 80},
+	}
+	ours := deepCopy(reflect.ValueOf(base)).Interface().(TestObj)
+	theirs := deepCopy(reflect.ValueOf(base)).Interface().(TestObj)
+
+	ours.Name = "ours"
+	theirs.Name = "theirs"
+	ours.Backup = Server{Host: "ours.example", Port: 1}
+	theirs.Backup.Port = 2
+	delete(ours.Servers, "a")
+	theirs.Servers["a"] = Server{Host: "a.example", Port: 3}
+	ours.Tags = append(ours.Tags, "ours")
+	theirs.Tags = append(theirs.Tags, "theirs")
+	theirs.Tags[0] = "changed"
+
+	expectedConflicts := []Conflict{
+		{Path: "/name", Base: "web", Ours: "ours", Theirs: "theirs"},
+		{Path: "/tags", Base: []string{"a", "b"}, Ours: []string{"a", "b", "ours"}, Theirs: []string{"changed", "b", "theirs"}},
+		{Path: "/servers/a", Base: base.Servers["a"], Ours: nil, Theirs: Server{Host: "a.example", Port: 3}},
+		{Path: "/backup/port", Base: 80, Ours: 1, Theirs: 2},
+	}
+
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		expected TestObj
+	}{
+		{"ours", OursWins, ours},
+		{"theirs", TheirsWins, TestObj{
+			Name:    "theirs",
+			Tags:    theirs.Tags,
+			Servers: theirs.Servers,
+			Backup:  Server{Host: "ours.example", Port: 2},
+		}},
+		{"callback", func(c Conflict) (interface{}, error) {
+			switch c.Path {
+			case "/name":
+				return c.Ours.(string) + "-" + c.Theirs.(string), nil
+			case "/backup/port":
+				return 42, nil
+			}
+			return c.Base, nil
+		}, TestObj{
+			Name:    "ours-theirs",
+			Tags:    []string{"a", "b"},
+			Servers: base.Servers,
+			Backup:  Server{Host: "ours.example", Port: 42},
+		}},
+	}
+	for _, test := range tests {
+		merged, conflicts, err := Merge3WithStrategy(base, ours, theirs, test.strategy)
+		if err != nil {
+			t.Errorf("Merge3WithStrategy %v error expected nil actual %+v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(merged, test.expected) {
+			t.Errorf("Merge3WithStrategy %v expected %+v actual %+v", test.name, test.expected, merged)
+		}
+		if !sameConflicts(conflicts, expectedConflicts) {
+			t.Errorf("Merge3WithStrategy %v conflicts expected %+v actual %+v", test.name, expectedConflicts, conflicts)
+		}
+	}
+
+	if _, _, err := Merge3WithStrategy(base, ours, theirs, func(c Conflict) (interface{}, error) { return 1, nil }); err == nil {
+		t.Errorf("Merge3WithStrategy wrong type expected error actual nil")
+	}
+	if _, _, err := Merge3WithStrategy(base, ours, theirs, func(c Conflict) (interface{}, error) { return nil, errors.New("unresolvable") }); err == nil {
+		t.Errorf("Merge3WithStrategy strategy error expected error actual nil")
+	}
+}
+
+// sameConflicts returns whether the conflicts are the same, in any order.
+func sameConflicts(a []Conflict, b []Conflict) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, ca := range a {
+		found := false
+		for _, cb := range b {
+			if reflect.DeepEqual(ca, cb) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMerge3PointerConflict(t *testing.T) {
+	type TestObj struct {
+		Limit *int `json:"limit"`
+	}
+
+	one := 1
+	two := 2
+	base := TestObj{Limit: &one}
+	ours := TestObj{Limit: nil}
+	theirs := TestObj{Limit: &two}
+
+	merged, conflicts, err := Merge3(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("Merge3 error expected nil actual %+v", err)
+	}
+	if merged.Limit != nil || len(conflicts) != 1 || conflicts[0].Ours != nil || *conflicts[0].Theirs.(*int) != 2 {
+		t.Errorf("Merge3 pointer removed expected nil limit and conflict actual %+v %+v", merged, conflicts)
+	}
+
+	merged, _, err = Merge3WithStrategy(base, ours, theirs, TheirsWins)
+	if err != nil {
+		t.Fatalf("Merge3WithStrategy error expected nil actual %+v", err)
+	}
+	if merged.Limit == nil || *merged.Limit != 2 || merged.Limit == &two {
+		t.Errorf("Merge3WithStrategy theirs expected copy of limit 2 actual %+v", merged.Limit)
+	}
+
+	merged, _, err = Merge3WithStrategy(base, ours, theirs, func(c Conflict) (interface{}, error) { return 7, nil })
+	if err != nil {
+		t.Fatalf("Merge3WithStrategy pointed-to value error expected nil actual %+v", err)
+	}
+	if merged.Limit == nil || *merged.Limit != 7 {
+		t.Errorf("Merge3WithStrategy pointed-to value expected limit 7 actual %+v", merged.Limit)
+	}
+}
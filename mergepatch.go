@@ -0,0 +1,546 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// StrategicPatchDirective is the strategic merge patch object member whose value is "replace" to replace the object or list outright, "delete" to remove it, or "merge" to merge it as usual.
+	// In a list, an element {"$patch": "replace"} replaces the whole list with the other elements, and an element with "$patch": "delete" removes the element with its merge key.
+	StrategicPatchDirective = "$patch"
+
+	// StrategicDeleteFromPrimitiveListPrefix is the prefix of the strategic merge patch object member "$deleteFromPrimitiveList/<field>", whose value is a list of values to remove from the merged list of primitives at field.
+	StrategicDeleteFromPrimitiveListPrefix = "$deleteFromPrimitiveList/"
+)
+
+// ApplyMergePatch applies the JSON Merge Patch document, per RFC 7386, to realObj, which must be a non-nil pointer to a struct or map.
+// Patch object members are merged into struct fields and map values, and null members remove them. Any other patch value, including an array, replaces the value at its path.
+// The merge patch is translated into JSON Patch ops, which are applied the same as Apply. If any op fails, realObj isn't modified.
+func ApplyMergePatch(mergePatch []byte, realObj interface{}) error {
+	return (&Patcher{}).ApplyMergePatch(mergePatch, realObj)
+}
+
+// ApplyMergePatch applies the JSON Merge Patch document to realObj, with the Patcher's options.
+// See the package ApplyMergePatch.
+func (p *Patcher) ApplyMergePatch(mergePatch []byte, realObj interface{}) error {
+	return p.applyMergePatch(mergePatch, realObj, false)
+}
+
+// ApplyStrategicMergePatch applies the strategic merge patch document to realObj, which must be a non-nil pointer to a struct or map.
+// It's the same as ApplyMergePatch, except for lists in struct fields tagged `patchStrategy:"merge"`, and the directives StrategicPatchDirective and StrategicDeleteFromPrimitiveListPrefix.
+//
+// A merged list of structs or maps must also be tagged with `patchMergeKey:"<key>"`, the json tag or map key which identifies its elements. Each patch element is merged into the element with the same key, or appended if there is none.
+// A merged list of anything else appends the patch elements which aren't already in it.
+// Lists without the merge strategy are replaced, as in ApplyMergePatch.
+func ApplyStrategicMergePatch(patch []byte, realObj interface{}) error {
+	return (&Patcher{}).ApplyStrategicMergePatch(patch, realObj)
+}
+
+// ApplyStrategicMergePatch applies the strategic merge patch document to realObj, with the Patcher's options.
+// See the package ApplyStrategicMergePatch.
+func (p *Patcher) ApplyStrategicMergePatch(patch []byte, realObj interface{}) error {
+	return p.applyMergePatch(patch, realObj, true)
+}
+
+// applyMergePatch applies the merge patch document to realObj, merging lists strategically if strategic is true.
+func (p *Patcher) applyMergePatch(data []byte, realObj interface{}, strategic bool) error {
+	obj, err := getApplyObj(realObj)
+	if err != nil {
+		return err
+	}
+	mergePatch, err := decodeMergePatch(data)
+	if err != nil {
+		return err
+	}
+	patch, err := mergePatchOps(mergePatch, obj, strategic)
+	if err != nil {
+		return err
+	}
+	// list elements the merge patch deletes must be removed, not zeroed
+	p = &Patcher{Options: p.Options, ops: p.ops}
+	p.Options.ShiftOnRemove = true
+
+	// apply to a copy first, so a failed op doesn't modify the object
+	cp := reflect.New(obj.Type()).Elem()
+	cp.Set(deepCopy(obj))
+	for _, patchOp := range patch {
+		cpOp := patchOp
+		if cpOp.Value != nil {
+			cpOp.Value = deepCopy(reflect.ValueOf(cpOp.Value)).Interface()
+		}
+		if err := p.applyOp(cp, cpOp); err != nil {
+			return errors.New("applying merge patch op " + string(patchOp.Op) + " '" + redactPathString(obj.Type(), patchOp.Path) + "': " + err.Error())
+		}
+	}
+	for _, patchOp := range patch {
+		if err := p.applyOp(obj, patchOp); err != nil {
+			return errors.New("applying merge patch op " + string(patchOp.Op) + " '" + redactPathString(obj.Type(), patchOp.Path) + "': " + err.Error())
+		}
+	}
+	return nil
+}
+
+// decodeMergePatch decodes the JSON merge patch document. Numbers are decoded as json.Number, so they're converted to Go types without losing precision.
+func decodeMergePatch(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	mergePatch := interface{}(nil)
+	if err := dec.Decode(&mergePatch); err != nil {
+		return nil, errors.New("decoding merge patch: " + err.Error())
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("decoding merge patch: unexpected data after the document")
+	}
+	return mergePatch, nil
+}
+
+// mergePatchOps returns the JSON Patch ops which apply the decoded merge patch to obj.
+// Slice elements merged by key are addressed with key selectors, so the ops don't depend on the indices they're applied at.
+func mergePatchOps(mergePatch interface{}, obj reflect.Value, strategic bool) (JSONPatch, error) {
+	mergeObj, ok := mergePatch.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("merge patch must be an object, because the root object can't be replaced")
+	}
+	if _, ok := mergeObj[StrategicPatchDirective]; ok && strategic {
+		return nil, errors.New("merge patch directive " + StrategicPatchDirective + " can't be applied to the root object")
+	}
+	target, ok := indirectSelectorVal(obj)
+	if !ok || (target.Kind() != reflect.Struct && target.Kind() != reflect.Map) {
+		return nil, errors.New("merge patch can only be applied to a struct or map, not " + obj.Type().String())
+	}
+	m := mergePatcher{strategic: strategic, root: obj.Type(), patch: JSONPatch{}}
+	if err := m.mergeObject([]string{}, target, mergeObj); err != nil {
+		return nil, err
+	}
+	return m.patch, nil
+}
+
+// mergePatcher translates a merge patch into JSON Patch ops.
+type mergePatcher struct {
+	strategic bool
+	root      reflect.Type // the type of the object, which errors report paths in
+	patch     JSONPatch
+}
+
+// mergeMember is a struct field, map value, or slice element being merged.
+type mergeMember struct {
+	// val is the current value, which is invalid if it's a missing map key.
+	val reflect.Value
+	typ reflect.Type
+	// tag is the struct tag, if the member is a struct field.
+	tag reflect.StructTag
+	// inMap and inSlice are whether the member is a map value or slice element, which are set differently than struct fields.
+	inMap   bool
+	inSlice bool
+}
+
+// exists returns whether the member has a value which isn't nil.
+func (member mergeMember) exists() bool {
+	if !member.val.IsValid() {
+		return false
+	}
+	switch member.val.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Interface:
+		return !member.val.IsNil()
+	}
+	return true
+}
+
+// isMergeList returns whether the member is a slice which is merged strategically, rather than replaced.
+func (member mergeMember) isMergeList() bool {
+	typ := member.typ
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Slice {
+		return false
+	}
+	for _, strategy := range strings.Split(member.tag.Get("patchStrategy"), ",") {
+		if strategy == "merge" {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeObject emits the ops to merge mergeObj into obj, which is a struct or non-nil map at path.
+func (m *mergePatcher) mergeObject(path []string, obj reflect.Value, mergeObj map[string]interface{}) error {
+	deletes := map[string][]interface{}{}
+	keys := []string{}
+	for key, val := range mergeObj {
+		if m.strategic && strings.HasPrefix(key, "$") {
+			switch {
+			case key == StrategicPatchDirective:
+			case strings.HasPrefix(key, StrategicDeleteFromPrimitiveListPrefix):
+				list, ok := val.([]interface{})
+				if !ok {
+					return errors.New("merge patch directive " + key + " at '" + redactPath(m.root, path) + "' must be a list")
+				}
+				field := strings.TrimPrefix(key, StrategicDeleteFromPrimitiveListPrefix)
+				deletes[field] = list
+				if _, ok := mergeObj[field]; !ok {
+					keys = append(keys, field)
+				}
+			default:
+				return errors.New("merge patch directive " + key + " at '" + redactPath(m.root, path) + "' isn't supported")
+			}
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		memberPath := append(path[:len(path):len(path)], key)
+		member, err := getMergeMember(obj, key)
+		if err != nil {
+			return errors.New("merging '" + redactPath(m.root, memberPath) + "': " + err.Error())
+		}
+		val, ok := mergeObj[key]
+		if ok && val == nil {
+			if member.exists() {
+				m.patch = append(m.patch, JSONPatchOp{Op: OpTypeRemove, Path: FormatPath(memberPath)})
+			}
+			continue
+		}
+		if err := m.mergeValue(memberPath, member, val, deletes[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getMergeMember returns the member of the struct or map obj at key.
+func getMergeMember(obj reflect.Value, key string) (mergeMember, error) {
+	if obj.Kind() == reflect.Map {
+		mapKey, err := ConvertKeyToType(key, obj.Type().Key())
+		if err != nil {
+			return mergeMember{}, err
+		}
+		return mergeMember{val: obj.MapIndex(mapKey), typ: obj.Type().Elem(), inMap: true}, nil
+	}
+	for i := 0; i < obj.NumField(); i++ {
+		if field := obj.Type().Field(i); field.Tag.Get("json") == key {
+			return mergeMember{val: obj.Field(i), typ: field.Type, tag: field.Tag}, nil
+		}
+	}
+	return mergeMember{}, errors.New("object has no json tag '" + key + "'")
+}
+
+// mergeValue emits the ops to merge val into the member at path. The deletes are the values of a StrategicDeleteFromPrimitiveListPrefix directive for the member, if any.
+func (m *mergePatcher) mergeValue(path []string, member mergeMember, val interface{}, deletes []interface{}) error {
+	mergeObj, isObj := val.(map[string]interface{})
+	if m.strategic && isObj {
+		if directive, ok := mergeObj[StrategicPatchDirective]; ok {
+			switch directive {
+			case "delete":
+				if member.exists() {
+					m.patch = append(m.patch, JSONPatchOp{Op: OpTypeRemove, Path: FormatPath(path)})
+				}
+				return nil
+			case "replace":
+				return m.set(path, member, val)
+			case "merge":
+			default:
+				return errors.New("merge patch directive " + StrategicPatchDirective + " at '" + redactPath(m.root, path) + "' must be replace, delete, or merge")
+			}
+		}
+	}
+
+	if m.strategic && member.isMergeList() {
+		items, ok := val.([]interface{})
+		if !ok && val != nil {
+			return errors.New("merging '" + redactPath(m.root, path) + "': merge patch value for a list must be a list")
+		}
+		return m.mergeList(path, member, items, deletes)
+	}
+	if deletes != nil {
+		return errors.New("merge patch directive " + StrategicDeleteFromPrimitiveListPrefix + " at '" + redactPath(m.root, path) + "' requires a list with patchStrategy merge")
+	}
+
+	if isObj && member.exists() {
+		if target, ok := indirectSelectorVal(member.val); ok && (target.Kind() == reflect.Struct || target.Kind() == reflect.Map) {
+			return m.mergeObject(path, target, mergeObj)
+		}
+	}
+	return m.set(path, member, val)
+}
+
+// mergeList emits the ops to strategically merge the list items into the slice member at path, after removing the deletes.
+func (m *mergePatcher) mergeList(path []string, member mergeMember, items []interface{}, deletes []interface{}) error {
+	for i, item := range items {
+		if itemObj, ok := item.(map[string]interface{}); ok && itemObj[StrategicPatchDirective] == "replace" {
+			if deletes != nil {
+				return errors.New("merge patch directive " + StrategicDeleteFromPrimitiveListPrefix + " at '" + redactPath(m.root, path) + "' can't be used with a replaced list")
+			}
+			return m.set(path, member, append(items[:i:i], items[i+1:]...))
+		}
+	}
+	if !member.exists() {
+		return m.set(path, member, items)
+	}
+
+	list, _ := indirectSelectorVal(member.val)
+	elemType := list.Type().Elem()
+	mergeKey := member.tag.Get("patchMergeKey")
+	if mergeKey == "" {
+		return m.mergePrimitiveList(path, list, items, deletes)
+	}
+	if deletes != nil {
+		return errors.New("merge patch directive " + StrategicDeleteFromPrimitiveListPrefix + " at '" + redactPath(m.root, path) + "' can't be used on a list with a patchMergeKey")
+	}
+
+	seen := map[string]struct{}{}
+	for _, item := range items {
+		itemObj, ok := item.(map[string]interface{})
+		if !ok {
+			return errors.New("merging '" + redactPath(m.root, path) + "': list element must be an object with merge key '" + mergeKey + "'")
+		}
+		key, ok := formatSelectorVal(reflect.ValueOf(itemObj[mergeKey]))
+		if !ok {
+			return errors.New("merging '" + redactPath(m.root, path) + "': list element must have a string, number, or bool merge key '" + mergeKey + "'")
+		}
+		selector := "[" + mergeKey + "=" + key + "]"
+		reported := redactKeySelector(elemType, selector, mergeKey)
+		if _, ok := seen[key]; ok {
+			return errors.New("merging '" + redactPath(m.root, path) + "': more than one list element has merge key " + reported)
+		}
+		seen[key] = struct{}{}
+
+		matches := getKeySelectorMatches(list, mergeKey, key)
+		switch len(matches) {
+		case 0:
+			if itemObj[StrategicPatchDirective] == "delete" {
+				continue
+			}
+			if err := m.set(append(path[:len(path):len(path)], "-"), mergeMember{typ: elemType, inSlice: true}, item); err != nil {
+				return err
+			}
+		case 1:
+			elem := mergeMember{val: list.Index(matches[0]), typ: elemType, inSlice: true}
+			if err := m.mergeValue(append(path[:len(path):len(path)], selector), elem, item, nil); err != nil {
+				return err
+			}
+		default:
+			return errors.New("merging '" + redactPath(m.root, path) + "': more than one element has merge key " + reported)
+		}
+	}
+	return nil
+}
+
+// mergePrimitiveList emits the ops to remove the deletes from the list at path, and then append the items which aren't in it.
+func (m *mergePatcher) mergePrimitiveList(path []string, list reflect.Value, items []interface{}, deletes []interface{}) error {
+	elemType := list.Type().Elem()
+	convert := func(val interface{}) (interface{}, error) {
+		converted, err := convertJSONValue(m.strip(val), elemType)
+		if err != nil {
+			return nil, errors.New("merging '" + redactPath(m.root, path) + "': " + err.Error())
+		}
+		return indirectMergeVal(converted), nil
+	}
+
+	deleteVals := []interface{}{}
+	for _, val := range deletes {
+		deleteVal, err := convert(val)
+		if err != nil {
+			return err
+		}
+		deleteVals = append(deleteVals, deleteVal)
+	}
+	kept := []interface{}{}
+	removed := [][]string{}
+	for i := 0; i < list.Len(); i++ {
+		elem := indirectMergeVal(list.Index(i))
+		if containsMergeVal(deleteVals, elem) {
+			removed = append(removed, append(path[:len(path):len(path)], strconv.Itoa(i)))
+		} else {
+			kept = append(kept, elem)
+		}
+	}
+	sortRemovePaths(removed)
+	for _, removedPath := range removed {
+		m.patch = append(m.patch, JSONPatchOp{Op: OpTypeRemove, Path: FormatPath(removedPath)})
+	}
+
+	for _, item := range items {
+		itemVal, err := convert(item)
+		if err != nil {
+			return err
+		}
+		if containsMergeVal(kept, itemVal) {
+			continue
+		}
+		kept = append(kept, itemVal)
+		m.patch = append(m.patch, JSONPatchOp{Op: OpTypeAdd, Path: FormatPath(append(path[:len(path):len(path)], "-")), Value: itemVal})
+	}
+	return nil
+}
+
+// set emits the op to set the member at path to val.
+func (m *mergePatcher) set(path []string, member mergeMember, val interface{}) error {
+	typ := member.typ
+	if !member.inMap && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem() // add and replace set the value a struct field or slice element points to
+	}
+	converted, err := convertJSONValue(m.strip(val), typ)
+	if err != nil {
+		return errors.New("merging '" + redactPath(m.root, path) + "': " + err.Error())
+	}
+	opType := OpType(OpTypeAdd)
+	if member.inSlice && path[len(path)-1] != "-" {
+		opType = OpTypeReplace // an add on a slice element may insert it
+	}
+	m.patch = append(m.patch, JSONPatchOp{Op: opType, Path: FormatPath(path), Value: converted.Interface()})
+	return nil
+}
+
+// strip returns val without null object members, which a merge patch removes, or directives, if the merge patch is strategic.
+// Arrays are values in a JSON merge patch, so only strategic merge patches strip objects in arrays.
+func (m *mergePatcher) strip(val interface{}) interface{} {
+	switch val := val.(type) {
+	case map[string]interface{}:
+		stripped := map[string]interface{}{}
+		for key, member := range val {
+			if member == nil || (m.strategic && (key == StrategicPatchDirective || strings.HasPrefix(key, StrategicDeleteFromPrimitiveListPrefix))) {
+				continue
+			}
+			stripped[key] = m.strip(member)
+		}
+		return stripped
+	case []interface{}:
+		if !m.strategic {
+			return val
+		}
+		stripped := make([]interface{}, len(val))
+		for i, elem := range val {
+			stripped[i] = m.strip(elem)
+		}
+		return stripped
+	}
+	return val
+}
+
+// indirectMergeVal returns the interface of val, or what it points to, for comparing list elements.
+func indirectMergeVal(val reflect.Value) interface{} {
+	if val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	return val.Interface()
+}
+
+// containsMergeVal returns whether vals has a value reflect.DeepEqual to val.
+func containsMergeVal(vals []interface{}, val interface{}) bool {
+	for _, v := range vals {
+		if reflect.DeepEqual(v, val) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToMergePatch returns the JSON Merge Patch document equivalent to the patch.
+// Returns an error if the patch has ops a merge patch can't express: move, copy, test, and custom ops, ops on the root, ops on slice elements, which a merge patch can only replace as a whole, and setting a value to null, which a merge patch removes.
+// Because a path token of digits may be a slice index, and one of the form "[field=value]" may be a key selector, ops on such map keys also return an error.
+// Because a merge patch merges an object into the value at its path, rather than replacing it, an add or replace of a value which is a JSON object, such as a struct or map, also returns an error.
+func ToMergePatch(patch JSONPatch) ([]byte, error) {
+	doc := map[string]interface{}{}
+	for i, patchOp := range patch {
+		if err := addMergePatchOp(doc, patchOp); err != nil {
+			return nil, fmt.Errorf("op %v: %v", i, err)
+		}
+	}
+	bts, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.New("encoding merge patch: " + err.Error())
+	}
+	return bts, nil
+}
+
+// addMergePatchOp sets the member of the merge patch doc which is equivalent to the op.
+func addMergePatchOp(doc map[string]interface{}, patchOp JSONPatchOp) error {
+	switch patchOp.Op {
+	case OpTypeAdd, OpTypeReplace, OpTypeRemove:
+	default:
+		return errors.New("merge patch can't express " + string(patchOp.Op) + " ops")
+	}
+	path, err := ParsePath(patchOp.Path)
+	if err != nil {
+		return err
+	}
+	if len(path) == 0 {
+		return errors.New("merge patch can't replace or remove the root object")
+	}
+	// there's no type to tell which key selectors are sensitive, so none of their values are reported
+	reportedPath := redactKeySelectors(patchOp.Path)
+	for _, token := range path {
+		if _, ok := getIndexToken(token, true); ok {
+			return errors.New("merge patch can't express ops on slice elements, but path '" + reportedPath + "' has the index '" + token + "'")
+		}
+		if field, _, ok := parseKeySelector(token); ok {
+			return errors.New("merge patch can't express ops on slice elements, but path '" + reportedPath + "' has a key selector on '" + field + "'")
+		}
+	}
+
+	val := interface{}(nil) // null removes the member
+	if patchOp.Op != OpTypeRemove {
+		if patchOp.Value == nil {
+			return errors.New("merge patch can't set '" + reportedPath + "' to null, because null removes it")
+		}
+		if val, err = toMergePatchVal(patchOp.Value); err != nil {
+			return err
+		}
+		if _, ok := val.(map[string]interface{}); ok {
+			return errors.New("merge patch can't set '" + reportedPath + "' to an object, because it merges into the value there instead of replacing it")
+		}
+	}
+
+	parent := doc
+	for i, token := range path[:len(path)-1] {
+		member, ok := parent[token]
+		if !ok {
+			member = map[string]interface{}{}
+			parent[token] = member
+		}
+		memberObj, ok := member.(map[string]interface{})
+		if !ok {
+			return errors.New("merge patch can't express '" + reportedPath + "', because an earlier op set '" + FormatPath(path[:i+1]) + "' to a value which isn't an object")
+		}
+		parent = memberObj
+	}
+	parent[path[len(path)-1]] = val
+	return nil
+}
+
+// toMergePatchVal returns the patch value as generic JSON, so later ops can merge into it.
+func toMergePatchVal(val interface{}) (interface{}, error) {
+	bts, err := json.Marshal(val)
+	if err != nil {
+		return nil, errors.New("encoding value: " + err.Error())
+	}
+	return decodeMergePatch(bts)
+}
+
+// FromMergePatch returns the JSON Patch ops which apply the JSON Merge Patch document to current, which is a struct or map, or a pointer to one.
+// The ops are the ones ApplyMergePatch applies, so applying them to current with Apply is the same as applying the merge patch.
+func FromMergePatch(mergePatch []byte, current interface{}) (JSONPatch, error) {
+	obj := reflect.ValueOf(current)
+	if !obj.IsValid() {
+		return nil, errors.New("merge patch can only be applied to a struct or map, not nil")
+	}
+	mergePatchVal, err := decodeMergePatch(mergePatch)
+	if err != nil {
+		return nil, err
+	}
+	return mergePatchOps(mergePatchVal, obj, false)
+}
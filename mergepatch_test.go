@@ -0,0 +1,384 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	type Container struct {
+		Name  string            `json:"name"`
+		Image string            `json:"image"`
+		Ports []int             `json:"ports"`
+		Env   map[string]string `json:"env"`
+	}
+	type Spec struct {
+		Containers []Container `json:"containers"`
+		Finalizers []string    `json:"finalizers"`
+		Args       []string    `json:"args"`
+		Replicas   *int        `json:"replicas"`
+	}
+	type TestObj struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+		Spec   Spec              `json:"spec"`
+		Owner  *Container        `json:"owner"`
+		Extra  map[string]Spec   `json:"extra"`
+	}
+
+	replicas := 2
+	obj := &TestObj{
+		Name:   "app",
+		Labels: map[string]string{"tier": "web", "env": "prod"},
+		Spec: Spec{
+			Containers: []Container{{Name: "web", Image: "web:1", Ports: []int{80}}},
+			Finalizers: []string{"a", "b"},
+			Args:       []string{"-v"},
+			Replicas:   &replicas,
+		},
+	}
+	mergePatch := `{
+		"name": "app2",
+		"labels": {"env": null, "team": "core"},
+		"spec": {
+			"containers": [{"name": "web", "image": "web:2", "ports": null, "env": {"B": null}}],
+			"finalizers": ["c"],
+			"replicas": 3
+		},
+		"owner": {"name": "ops", "env": {"X": "1", "Y": null}},
+		"extra": {"x": {"args": ["a"]}}
+	}`
+	if err := ApplyMergePatch([]byte(mergePatch), obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	replicas = 3
+	expected := &TestObj{
+		Name:   "app2",
+		Labels: map[string]string{"tier": "web", "team": "core"},
+		Spec: Spec{
+			// arrays are replaced as values, so nulls in them aren't removed
+			Containers: []Container{{Name: "web", Image: "web:2", Env: map[string]string{"B": ""}}},
+			Finalizers: []string{"c"},
+			Args:       []string{"-v"},
+			Replicas:   &replicas,
+		},
+		Owner: &Container{Name: "ops", Env: map[string]string{"X": "1"}},
+		Extra: map[string]Spec{"x": {Args: []string{"a"}}},
+	}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("ApplyMergePatch expected %+v actual %+v", expected, obj)
+	}
+}
+
+func TestApplyMergePatchErrors(t *testing.T) {
+	type TestObj struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	}
+
+	tests := []struct {
+		name       string
+		mergePatch string
+		errStr     string
+	}{
+		{"not json", `{"name": `, "decoding merge patch"},
+		{"trailing data", `{} {}`, "unexpected data after the document"},
+		{"not an object", `["name"]`, "must be an object"},
+		{"unknown field", `{"nope": 1}`, "no json tag 'nope'"},
+		{"wrong type", `{"name": 1}`, "converting value"},
+		{"strict remove", `{"labels": {"env": null}, "name": null}`, "can't remove value field"},
+	}
+	for _, test := range tests {
+		obj := &TestObj{Name: "app", Labels: map[string]string{"env": "prod"}}
+		err := (&Patcher{Options: StrictOptions()}).ApplyMergePatch([]byte(test.mergePatch), obj)
+		if err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("ApplyMergePatch %v error expected '%v' actual %+v", test.name, test.errStr, err)
+		}
+		if obj.Name != "app" || obj.Labels["env"] != "prod" {
+			t.Errorf("ApplyMergePatch %v error expected object unmodified actual %+v", test.name, obj)
+		}
+	}
+}
+
+func TestApplyStrategicMergePatch(t *testing.T) {
+	type Container struct {
+		Name  string            `json:"name"`
+		Image string            `json:"image"`
+		Ports []int             `json:"ports"`
+		Env   map[string]string `json:"env"`
+	}
+	type Volume struct {
+		Name string `json:"name"`
+		Size int    `json:"size"`
+	}
+	type Spec struct {
+		Containers []Container `json:"containers" patchStrategy:"merge" patchMergeKey:"name"`
+		Volumes    []*Volume   `json:"volumes" patchStrategy:"merge,retainKeys" patchMergeKey:"name"`
+		Finalizers []string    `json:"finalizers" patchStrategy:"merge"`
+		Args       []string    `json:"args"`
+	}
+	type TestObj struct {
+		Labels map[string]string `json:"labels"`
+		Spec   Spec              `json:"spec"`
+		Owner  *Container        `json:"owner"`
+	}
+
+	obj := &TestObj{
+		Labels: map[string]string{"tier": "web"},
+		Spec: Spec{
+			Containers: []Container{
+				{Name: "web", Image: "web:1", Ports: []int{80}},
+				{Name: "sidecar", Image: "proxy:1"},
+			},
+			Volumes:    []*Volume{{Name: "data", Size: 10}},
+			Finalizers: []string{"a", "b"},
+			Args:       []string{"-v"},
+		},
+	}
+	patch := `{
+		"labels": {"$patch": "replace", "new": "label"},
+		"spec": {
+			"containers": [
+				{"name": "sidecar", "$patch": "delete"},
+				{"name": "web", "image": "web:2", "ports": [443]},
+				{"name": "db", "image": "db:1", "env": {"A": null}}
+			],
+			"volumes": [{"name": "data", "size": 20}, {"name": "logs", "size": 1}],
+			"finalizers": ["b", "c"],
+			"$deleteFromPrimitiveList/finalizers": ["a"],
+			"args": ["-q"]
+		}
+	}`
+	if err := ApplyStrategicMergePatch([]byte(patch), obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	expected := &TestObj{
+		Labels: map[string]string{"new": "label"},
+		Spec: Spec{
+			Containers: []Container{
+				{Name: "web", Image: "web:2", Ports: []int{443}},
+				{Name: "db", Image: "db:1", Env: map[string]string{}},
+			},
+			Volumes:    []*Volume{{Name: "data", Size: 20}, {Name: "logs", Size: 1}},
+			Finalizers: []string{"b", "c"},
+			Args:       []string{"-q"},
+		},
+	}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("ApplyStrategicMergePatch expected %+v actual %+v", expected, obj)
+	}
+
+	// a list element of {"$patch": "replace"} replaces the list
+	patch = `{"spec": {"containers": [{"$patch": "replace"}, {"name": "only"}], "owner": null}}`
+	if err := ApplyStrategicMergePatch([]byte(patch), obj); err == nil || !strings.Contains(err.Error(), "no json tag 'owner'") {
+		t.Errorf("ApplyStrategicMergePatch error expected 'no json tag' actual %+v", err)
+	}
+	patch = `{"spec": {"containers": [{"$patch": "replace"}, {"name": "only"}]}, "owner": null}`
+	if err := ApplyStrategicMergePatch([]byte(patch), obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if expected := []Container{{Name: "only"}}; !reflect.DeepEqual(obj.Spec.Containers, expected) {
+		t.Errorf("ApplyStrategicMergePatch obj.Spec.Containers expected %+v actual %+v", expected, obj.Spec.Containers)
+	}
+}
+
+func TestApplyMergePatchList(t *testing.T) {
+	type TestObj struct {
+		Finalizers []string `json:"finalizers" patchStrategy:"merge"`
+	}
+
+	// without the strategy, a merge patch replaces lists
+	obj := &TestObj{Finalizers: []string{"a", "b"}}
+	if err := ApplyMergePatch([]byte(`{"finalizers": ["c"]}`), obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if expected := []string{"c"}; !reflect.DeepEqual(obj.Finalizers, expected) {
+		t.Errorf("ApplyMergePatch obj.Finalizers expected %+v actual %+v", expected, obj.Finalizers)
+	}
+}
+
+func TestApplyStrategicMergePatchErrors(t *testing.T) {
+	type Container struct {
+		Name  string `json:"name"`
+		Image string `json:"image"`
+	}
+	type Spec struct {
+		Containers []Container `json:"containers" patchStrategy:"merge" patchMergeKey:"name"`
+		Args       []string    `json:"args"`
+	}
+	type TestObj struct {
+		Labels map[string]string `json:"labels"`
+		Spec   Spec              `json:"spec"`
+	}
+
+	tests := []struct {
+		name   string
+		patch  string
+		errStr string
+	}{
+		{"root directive", `{"$patch": "replace"}`, "can't be applied to the root object"},
+		{"unknown directive", `{"spec": {"$retainKeys": ["args"]}}`, "isn't supported"},
+		{"bad patch directive", `{"labels": {"$patch": "nope"}}`, "must be replace, delete, or merge"},
+		{"missing merge key", `{"spec": {"containers": [{"image": "x"}]}}`, "must have a string, number, or bool merge key"},
+		{"duplicate merge key", `{"spec": {"containers": [{"name": "x"}, {"name": "x"}]}}`, "more than one list element"},
+		{"not a list", `{"spec": {"containers": {"name": "x"}}}`, "must be a list"},
+		{"delete from unmerged list", `{"spec": {"$deleteFromPrimitiveList/args": ["-v"]}}`, "requires a list with patchStrategy merge"},
+		{"delete from keyed list", `{"spec": {"$deleteFromPrimitiveList/containers": ["web"]}}`, "can't be used on a list with a patchMergeKey"},
+	}
+	for _, test := range tests {
+		obj := &TestObj{Spec: Spec{Containers: []Container{{Name: "web"}}, Args: []string{"-v"}}}
+		err := ApplyStrategicMergePatch([]byte(test.patch), obj)
+		if err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("ApplyStrategicMergePatch %v error expected '%v' actual %+v", test.name, test.errStr, err)
+		}
+	}
+
+	// duplicate keys in the object are an error when merging, not when replacing
+	obj := &TestObj{Spec: Spec{Containers: []Container{{Name: "web"}, {Name: "sidecar"}, {Name: "web"}}}}
+	err := ApplyStrategicMergePatch([]byte(`{"spec": {"containers": [{"name": "web", "image": "x"}]}}`), obj)
+	if err == nil || !strings.Contains(err.Error(), "more than one element") {
+		t.Errorf("ApplyStrategicMergePatch duplicate keys error expected 'more than one element' actual %+v", err)
+	}
+}
+
+func TestToMergePatch(t *testing.T) {
+	type Owner struct {
+		Name  string            `json:"name"`
+		Image string            `json:"image"`
+		Ports []int             `json:"ports"`
+		Env   map[string]string `json:"env"`
+	}
+	type Spec struct {
+		Args     []string `json:"args"`
+		Replicas *int     `json:"replicas"`
+	}
+	type TestObj struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+		Spec   Spec              `json:"spec"`
+		Owner  *Owner            `json:"owner"`
+	}
+
+	patch := JSONPatch{
+		{Op: OpTypeReplace, Path: "/name", Value: "app2"},
+		{Op: OpTypeRemove, Path: "/labels/env"},
+		{Op: OpTypeAdd, Path: "/labels/team", Value: "core"},
+		{Op: OpTypeReplace, Path: "/spec/replicas", Value: 3},
+		{Op: OpTypeReplace, Path: "/spec/args", Value: []string{"-q"}},
+		{Op: OpTypeReplace, Path: "/owner/image", Value: "ops:1"},
+	}
+	mergePatch, err := ToMergePatch(patch)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expectedJSON := `{"labels":{"env":null,"team":"core"},"name":"app2","owner":{"image":"ops:1"},"spec":{"args":["-q"],"replicas":3}}`
+	if string(mergePatch) != expectedJSON {
+		t.Errorf("ToMergePatch expected %v actual %v", expectedJSON, string(mergePatch))
+	}
+
+	replicas := 2
+	expected := &TestObj{Name: "app", Labels: map[string]string{"env": "prod"}, Spec: Spec{Args: []string{"-v"}, Replicas: &replicas}, Owner: &Owner{Name: "ops", Env: map[string]string{"X": "1"}}}
+	if err := Apply(patch, expected); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	replicas2 := 2
+	obj := &TestObj{Name: "app", Labels: map[string]string{"env": "prod"}, Spec: Spec{Args: []string{"-v"}, Replicas: &replicas2}, Owner: &Owner{Name: "ops", Env: map[string]string{"X": "1"}}}
+	if err := ApplyMergePatch(mergePatch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("ApplyMergePatch of ToMergePatch expected %+v actual %+v", expected, obj)
+	}
+}
+
+func TestToMergePatchErrors(t *testing.T) {
+	type Owner struct {
+		Name string `json:"name"`
+	}
+	type TestObj struct {
+		Name  string            `json:"name"`
+		Owner *Owner            `json:"owner"`
+		Env   map[string]string `json:"env"`
+	}
+
+	tests := []struct {
+		name   string
+		patch  JSONPatch
+		errStr string
+	}{
+		{"move", JSONPatch{{Op: OpTypeMove, From: "/name", Path: "/owner/name"}}, "op 0: merge patch can't express move ops"},
+		{"test", JSONPatch{{Op: OpTypeTest, Path: "/name", Value: "app"}}, "can't express test ops"},
+		{"insert", JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "x"}, {Op: OpTypeAdd, Path: "/spec/args/-", Value: "-q"}}, "op 1: merge patch can't express ops on slice elements"},
+		{"element", JSONPatch{{Op: OpTypeRemove, Path: "/spec/containers/0"}}, "has the index '0'"},
+		{"key selector", JSONPatch{{Op: OpTypeRemove, Path: "/spec/containers/[name=web]"}}, "path '/spec/containers/[name=[REDACTED]]' has a key selector on 'name'"},
+		{"index after key selector", JSONPatch{{Op: OpTypeRemove, Path: "/spec/containers/0/[name=web]"}}, "path '/spec/containers/0/[name=[REDACTED]]' has the index '0'"},
+		{"root", JSONPatch{{Op: OpTypeReplace, Path: "", Value: TestObj{}}}, "root object"},
+		{"null", JSONPatch{{Op: OpTypeReplace, Path: "/owner", Value: nil}}, "because null removes it"},
+		{"struct", JSONPatch{{Op: OpTypeAdd, Path: "/owner", Value: Owner{Name: "ops"}}}, "set '/owner' to an object"},
+		{"map", JSONPatch{{Op: OpTypeReplace, Path: "/env", Value: map[string]string{"A": "1"}}}, "set '/env' to an object"},
+		{"empty object", JSONPatch{{Op: OpTypeReplace, Path: "/env", Value: map[string]string{}}}, "set '/env' to an object"},
+		{"through a value", JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "x"}, {Op: OpTypeReplace, Path: "/name/first", Value: "y"}}, "set '/name' to a value which isn't an object"},
+		{"through a removal", JSONPatch{{Op: OpTypeRemove, Path: "/owner"}, {Op: OpTypeAdd, Path: "/owner/name", Value: "y"}}, "set '/owner' to a value which isn't an object"},
+	}
+	for _, test := range tests {
+		_, err := ToMergePatch(test.patch)
+		if err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("ToMergePatch %v error expected '%v' actual %+v", test.name, test.errStr, err)
+		}
+	}
+}
+
+func TestFromMergePatch(t *testing.T) {
+	type Owner struct {
+		Name string `json:"name"`
+	}
+	type Spec struct {
+		Args     []string `json:"args"`
+		Replicas int      `json:"replicas"`
+	}
+	type TestObj struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+		Spec   Spec              `json:"spec"`
+		Owner  *Owner            `json:"owner"`
+	}
+
+	current := &TestObj{Name: "app", Labels: map[string]string{"env": "prod"}, Spec: Spec{Args: []string{"-v"}, Replicas: 2}}
+	mergePatch := []byte(`{"name": "app2", "labels": {"env": null, "missing": null, "team": "core"}, "spec": {"replicas": 3, "args": null}, "owner": {"name": "ops"}}`)
+	patch, err := FromMergePatch(mergePatch, current)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expectedPatch := JSONPatch{
+		{Op: OpTypeRemove, Path: "/labels/env"},
+		{Op: OpTypeAdd, Path: "/labels/team", Value: "core"},
+		{Op: OpTypeAdd, Path: "/name", Value: "app2"},
+		{Op: OpTypeAdd, Path: "/owner", Value: Owner{Name: "ops"}},
+		{Op: OpTypeRemove, Path: "/spec/args"},
+		{Op: OpTypeAdd, Path: "/spec/replicas", Value: 3},
+	}
+	if !reflect.DeepEqual(patch, expectedPatch) {
+		t.Errorf("FromMergePatch expected %+v actual %+v", expectedPatch, patch)
+	}
+
+	expected := &TestObj{Name: "app", Labels: map[string]string{"env": "prod"}, Spec: Spec{Args: []string{"-v"}, Replicas: 2}}
+	if err := ApplyMergePatch(mergePatch, expected); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := Apply(patch, current); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !reflect.DeepEqual(current, expected) {
+		t.Errorf("Apply FromMergePatch expected %+v actual %+v", expected, current)
+	}
+
+	if _, err := FromMergePatch(mergePatch, nil); err == nil {
+		t.Errorf("FromMergePatch nil error expected non-nil actual nil")
+	}
+	if _, err := FromMergePatch([]byte(`{"nope": 1}`), current); err == nil || !strings.Contains(err.Error(), "no json tag 'nope'") {
+		t.Errorf("FromMergePatch error expected 'no json tag' actual %+v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// OpHandler applies a custom op to target, which is the value at the op's path, after it has been resolved the same way as the RFC 6902 ops.
+// The target is settable. If it's a map value, it's a copy, which is stored back in the map after the handler returns successfully.
+type OpHandler func(target reflect.Value, op JSONPatchOp) error
+
+// Patcher applies patches with custom op types, in addition to the RFC 6902 ops.
+// Ops registered on the Patcher take precedence over ops registered package-wide with RegisterOp.
+// The zero value is ready to use, and applies the package-wide ops.
+type Patcher struct {
+	Options Options
+	ops     map[OpType]OpHandler
+}
+
+var (
+	registeredOps     = map[OpType]OpHandler{}
+	registeredOpsLock sync.RWMutex
+)
+
+// RegisterOp registers a custom op type package-wide, for Apply and every Patcher.
+// Panics if the handler is nil, or if opType is one of the RFC 6902 ops, in the same manner as database/sql.Register.
+func RegisterOp(opType OpType, handler OpHandler) {
+	checkRegisterOp(opType, handler)
+	registeredOpsLock.Lock()
+	defer registeredOpsLock.Unlock()
+	registeredOps[opType] = handler
+}
+
+// RegisterOp registers a custom op type on the Patcher.
+// It isn't safe to register ops while the Patcher is applying patches in another goroutine.
+// Panics if the handler is nil, or if opType is one of the RFC 6902 ops.
+func (p *Patcher) RegisterOp(opType OpType, handler OpHandler) {
+	checkRegisterOp(opType, handler)
+	if p.ops == nil {
+		p.ops = map[OpType]OpHandler{}
+	}
+	p.ops[opType] = handler
+}
+
+func checkRegisterOp(opType OpType, handler OpHandler) {
+	if handler == nil {
+		panic("jsonpatch: RegisterOp handler is nil")
+	}
+	switch opType {
+	case OpTypeAdd, OpTypeRemove, OpTypeReplace, OpTypeMove, OpTypeCopy, OpTypeTest:
+		panic("jsonpatch: RegisterOp can't replace RFC 6902 op " + string(opType))
+	}
+}
+
+// getOp returns the handler for the custom op type, from the Patcher or else package-wide.
+func (p *Patcher) getOp(opType OpType) (OpHandler, bool) {
+	if handler, ok := p.ops[opType]; ok {
+		return handler, true
+	}
+	registeredOpsLock.RLock()
+	defer registeredOpsLock.RUnlock()
+	handler, ok := registeredOps[opType]
+	return handler, ok
+}
+
+// Apply applies the patch to realObj, which must be a non-nil pointer.
+func (p *Patcher) Apply(patch JSONPatch, realObj interface{}) error {
+	obj, err := getApplyObj(realObj)
+	if err != nil {
+		return err
+	}
+	for _, patchOp := range patch {
+		if err := p.applyOp(obj, patchOp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyResolvedOp applies patchOp to obj, and returns the ops it applied, with wildcards expanded and key selectors resolved to indices, so features which read op paths see the values it changed.
+// Unlike applyOp, a wildcard op which fails part way isn't undone, so obj must be a copy which is discarded on error.
+func (p *Patcher) applyResolvedOp(obj reflect.Value, patchOp JSONPatchOp) (JSONPatch, error) {
+	expanded, err := p.expandOpWildcards(obj, patchOp)
+	if err != nil {
+		return nil, err
+	}
+	wildcard := len(expanded) != 1 || expanded[0].Path != patchOp.Path
+	resolved := make(JSONPatch, 0, len(expanded))
+	for _, matchOp := range expanded {
+		op, err := p.resolveOpKeySelectors(obj, matchOp)
+		if err == nil {
+			err = p.applyOp(obj, op)
+		}
+		if err != nil && wildcard {
+			return nil, wildcardMatchError(obj.Type(), patchOp, matchOp, err)
+		} else if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, op)
+	}
+	return resolved, nil
+}
+
+// getApplyObj returns the object realObj points to, or an error if it isn't a non-nil pointer.
+func getApplyObj(realObj interface{}) (reflect.Value, error) {
+	obj := reflect.ValueOf(realObj)
+	if obj.Kind() != reflect.Ptr {
+		return reflect.Value{}, errors.New("object must be a pointer")
+	}
+	if obj.IsNil() {
+		return reflect.Value{}, errors.New("object must not be nil")
+	}
+	return reflect.Indirect(obj), nil
+}
+
+// applyCustom resolves the path of patchOp in obj, and calls the handler with the value there.
+// The path is the parsed patchOp.Path.
+func applyCustom(obj reflect.Value, patchOp JSONPatchOp, path []string, handler OpHandler) error {
+	obj, mapWriteBacks, err := getValBefore(path, obj, false)
+	if err != nil {
+		return errors.New("getValBefore: " + err.Error())
+	}
+
+	pathToken := path[len(path)-1]
+
+	// map values aren't addressable, so if the target is in a map, the handler gets a copy, which is stored back
+	target, err := getNextVal(pathToken, obj, false, &mapWriteBacks)
+	if err != nil {
+		return errors.New("getting last value in " + string(patchOp.Op) + " op: " + err.Error())
+	}
+	if !target.CanSet() {
+		return errors.New("can't set value at path " + redactToken(obj.Type(), pathToken))
+	}
+	if err := handler(target, patchOp); err != nil {
+		return err
+	}
+	mapWriteBacks.store()
+	return nil
+}
@@ -0,0 +1,203 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const (
+	testOpTypeIncrement    OpType = "increment"
+	testOpTypeAppendUnique OpType = "append-unique"
+)
+
+func testIncrement(target reflect.Value, op JSONPatchOp) error {
+	n, ok := op.Value.(int)
+	if !ok {
+		return fmt.Errorf("increment value must be an int, got %T", op.Value)
+	}
+	if target.Kind() != reflect.Int {
+		return errors.New("increment target must be an int, got " + target.Kind().String())
+	}
+	target.SetInt(target.Int() + int64(n))
+	return nil
+}
+
+func testAppendUnique(target reflect.Value, op JSONPatchOp) error {
+	if target.Kind() != reflect.Slice {
+		return errors.New("append-unique target must be a slice, got " + target.Kind().String())
+	}
+	for i := 0; i < target.Len(); i++ {
+		if reflect.DeepEqual(target.Index(i).Interface(), op.Value) {
+			return nil
+		}
+	}
+	target.Set(reflect.Append(target, reflect.ValueOf(op.Value)))
+	return nil
+}
+
+func TestPatcherRegisterOp(t *testing.T) {
+	type A struct {
+		Count int            `json:"count"`
+		Tags  []string       `json:"tags"`
+		Hits  map[string]int `json:"hits"`
+	}
+	type TestObj struct {
+		A A `json:"a"`
+	}
+
+	p := &Patcher{}
+	p.RegisterOp(testOpTypeIncrement, testIncrement)
+	p.RegisterOp(testOpTypeAppendUnique, testAppendUnique)
+
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:    testOpTypeIncrement,
+			Path:  "/a/count",
+			Value: 2,
+		},
+		JSONPatchOp{
+			Op:    testOpTypeAppendUnique,
+			Path:  "/a/tags",
+			Value: "beta",
+		},
+		JSONPatchOp{
+			Op:    testOpTypeAppendUnique,
+			Path:  "/a/tags",
+			Value: "gamma",
+		},
+		JSONPatchOp{
+			Op:    testOpTypeIncrement,
+			Path:  "/a/hits/web",
+			Value: 5,
+		},
+	}
+
+	obj := &TestObj{
+		A: A{
+			Count: 40,
+			Tags:  []string{"alpha", "beta"},
+			Hits:  map[string]int{"web": 1},
+		},
+	}
+
+	if err := p.Apply(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	if obj.A.Count != 42 {
+		t.Errorf("Apply obj.A.Count expected %+v actual %+v", 42, obj.A.Count)
+	}
+	if expected := []string{"alpha", "beta", "gamma"}; !reflect.DeepEqual(obj.A.Tags, expected) {
+		t.Errorf("Apply obj.A.Tags expected %+v actual %+v", expected, obj.A.Tags)
+	}
+	if obj.A.Hits["web"] != 6 {
+		t.Errorf(`Apply obj.A.Hits["web"] expected %+v actual %+v`, 6, obj.A.Hits["web"])
+	}
+
+	if err := Apply(patch, obj); err == nil {
+		t.Errorf("Apply with op registered only on a Patcher expected error, actual %+v", err)
+	}
+}
+
+func TestPatcherRegisterOpPackage(t *testing.T) {
+	type TestObj struct {
+		Count int `json:"count"`
+	}
+
+	opType := OpType("test-package-increment")
+	RegisterOp(opType, testIncrement)
+	defer func() {
+		registeredOpsLock.Lock()
+		delete(registeredOps, opType)
+		registeredOpsLock.Unlock()
+	}()
+
+	patch := JSONPatch{
+		JSONPatchOp{
+			Op:    opType,
+			Path:  "/count",
+			Value: 2,
+		},
+	}
+
+	obj := &TestObj{Count: 1}
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if obj.Count != 3 {
+		t.Errorf("Apply obj.Count expected %+v actual %+v", 3, obj.Count)
+	}
+
+	// ops on the Patcher take precedence
+	p := &Patcher{}
+	p.RegisterOp(opType, func(target reflect.Value, op JSONPatchOp) error {
+		target.SetInt(0)
+		return nil
+	})
+	if err := p.Apply(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if obj.Count != 0 {
+		t.Errorf("Patcher.Apply obj.Count expected %+v actual %+v", 0, obj.Count)
+	}
+}
+
+func TestPatcherCustomOpErrors(t *testing.T) {
+	type TestObj struct {
+		Count int            `json:"count"`
+		Hits  map[string]int `json:"hits"`
+	}
+
+	p := &Patcher{}
+	p.RegisterOp(testOpTypeIncrement, testIncrement)
+
+	obj := &TestObj{Count: 1, Hits: map[string]int{"web": 1}}
+
+	if err := p.Apply(JSONPatch{{Op: testOpTypeIncrement, Path: "/nonexistent", Value: 1}}, obj); err == nil {
+		t.Errorf("Apply custom op on nonexistent field expected error, actual %+v", err)
+	}
+	if err := p.Apply(JSONPatch{{Op: testOpTypeIncrement, Path: "/hits/api", Value: 1}}, obj); err == nil {
+		t.Errorf("Apply custom op on nonexistent map key expected error, actual %+v", err)
+	}
+	if err := p.Apply(JSONPatch{{Op: testOpTypeIncrement, Path: "/count", Value: "one"}}, obj); err == nil {
+		t.Errorf("Apply custom op handler error expected error, actual %+v", err)
+	}
+	if err := p.Apply(JSONPatch{{Op: "nonexistent", Path: "/count"}}, obj); err == nil {
+		t.Errorf("Apply unknown op expected error, actual %+v", err)
+	}
+	if obj.Count != 1 {
+		t.Errorf("Apply failed ops obj.Count expected %+v actual %+v", 1, obj.Count)
+	}
+}
+
+func TestPatcherRegisterRFCOp(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RegisterOp RFC op expected panic")
+		}
+	}()
+	p := &Patcher{}
+	p.RegisterOp(OpTypeAdd, testIncrement)
+}
+
+func TestPatcherCustomOpMapStructValue(t *testing.T) {
+	type Counter struct {
+		Count int `json:"count"`
+	}
+	type TestObj struct {
+		Counters map[string]Counter `json:"counters"`
+	}
+
+	p := &Patcher{}
+	p.RegisterOp(testOpTypeIncrement, testIncrement)
+
+	obj := &TestObj{Counters: map[string]Counter{"web": {Count: 1}}}
+	if err := p.Apply(JSONPatch{{Op: testOpTypeIncrement, Path: "/counters/web/count", Value: 2}}, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if actual := obj.Counters["web"].Count; actual != 3 {
+		t.Errorf(`Apply obj.Counters["web"].Count expected %+v actual %+v`, 3, actual)
+	}
+}
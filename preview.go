@@ -0,0 +1,148 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+// ChangeType is how a value was changed by an op, in a Preview.
+type ChangeType string
+
+const (
+	ChangeTypeCreated  = ChangeType("created")
+	ChangeTypeReplaced = ChangeType("replaced")
+	ChangeTypeRemoved  = ChangeType("removed")
+)
+
+// Change is a value which a patch op would change, returned by Preview.
+type Change struct {
+	// Index is the index of the op in the patch.
+	Index int
+	// Path is the JSON Pointer of the changed value. A last path token of "-", and key selectors, are resolved to slice indices.
+	Path string
+	Type ChangeType
+	// Old is the value before the op. It's nil if the value was created.
+	Old interface{}
+	// New is the value after the op. It's nil if the value was removed.
+	New interface{}
+}
+
+// Preview returns the changes the patch would make to realObj, which must be a non-nil pointer, without modifying it.
+// The patch is applied to a deep copy of realObj, and the returned values are copies, which share nothing with realObj.
+//
+// Each op returns a change for its path, except test ops, which return none, and a move op, which returns a removal for its from, followed by the change for its path.
+// A nil pointer is considered to not exist, so setting it is a creation. Inserting into a slice is a creation, even when the index already existed.
+// If any op fails, the error is returned, as Apply would.
+// Values in sensitive fields are redacted per Options.Redact. See SensitiveTag.
+func Preview(patch JSONPatch, realObj interface{}) ([]Change, error) {
+	return (&Patcher{}).Preview(patch, realObj)
+}
+
+// Preview returns the changes the patch would make to realObj, without modifying it.
+// See the package Preview.
+func (p *Patcher) Preview(patch JSONPatch, realObj interface{}) ([]Change, error) {
+	obj, err := getApplyObj(realObj)
+	if err != nil {
+		return nil, err
+	}
+	scratch := reflect.New(obj.Type()).Elem()
+	scratch.Set(deepCopy(obj))
+
+	changes := []Change{}
+	for i, patchOp := range patch {
+		// wildcards are expanded first, so each path they match is a change
+		ops, err := p.expandOpWildcards(scratch, patchOp)
+		if err != nil {
+			return nil, errors.New("op " + strconv.Itoa(i) + ": " + err.Error())
+		}
+		for _, op := range ops {
+			opChanges, err := p.previewOp(scratch, i, op)
+			if err != nil {
+				return nil, errors.New("op " + strconv.Itoa(i) + ": " + err.Error())
+			}
+			changes = append(changes, opChanges...)
+		}
+	}
+	for i := range changes {
+		if path, err := ParsePath(changes[i].Path); err == nil {
+			changes[i].Old = p.Options.redact(obj.Type(), path, changes[i].Old)
+			changes[i].New = p.Options.redact(obj.Type(), path, changes[i].New)
+		}
+	}
+	return changes, nil
+}
+
+// previewOp applies patchOp to obj, and returns the changes it made.
+func (p *Patcher) previewOp(obj reflect.Value, index int, patchOp JSONPatchOp) ([]Change, error) {
+	// key selectors are resolved first, so the changed values can be found after the op changes the keys
+	patchOp, err := p.resolveOpKeySelectors(obj, patchOp)
+	if err != nil {
+		return nil, err
+	}
+	path, err := ParsePath(patchOp.Path)
+	if err != nil {
+		return nil, err
+	}
+	old, oldOK := getPreviewVal(obj, path)
+
+	// move, copy, and strict add ops insert into slices, rather than replacing the element.
+	insert := patchOp.Op == OpTypeMove || patchOp.Op == OpTypeCopy || (patchOp.Op == OpTypeAdd && p.Options.InsertOnAdd)
+	if insert && len(path) > 0 {
+		before, _, err := getValBefore(path, obj, false)
+		insert = err == nil && before.Kind() == reflect.Slice
+	}
+
+	changes := []Change{}
+	if patchOp.Op == OpTypeMove {
+		fromPath, err := ParsePath(patchOp.From)
+		if err != nil {
+			return nil, errors.New("from: " + err.Error())
+		}
+		if isPathPrefix(fromPath, path) && len(fromPath) == len(path) {
+			return changes, nil // moving to the same place is a no-op.
+		}
+		fromOld, _ := getPreviewVal(obj, fromPath)
+		changes = append(changes, Change{Index: index, Path: FormatPath(fromPath), Type: ChangeTypeRemoved, Old: fromOld})
+	}
+
+	if err := p.applyOp(obj, patchOp); err != nil {
+		return nil, err
+	}
+
+	switch patchOp.Op {
+	case OpTypeTest:
+		return changes, nil
+	case OpTypeRemove:
+		if !oldOK {
+			return changes, nil // removing a value which doesn't exist changes nothing.
+		}
+		return append(changes, Change{Index: index, Path: FormatPath(path), Type: ChangeTypeRemoved, Old: old}), nil
+	}
+
+	if len(path) > 0 && path[len(path)-1] == "-" {
+		if before, _, err := getValBefore(path, obj, false); err == nil && before.Kind() == reflect.Slice && before.Len() > 0 {
+			path = append(append([]string{}, path[:len(path)-1]...), strconv.Itoa(before.Len()-1))
+		}
+	}
+	newVal, _ := getPreviewVal(obj, path)
+	change := Change{Index: index, Path: FormatPath(path), Type: ChangeTypeReplaced, Old: old, New: newVal}
+	if !oldOK || insert {
+		change.Type = ChangeTypeCreated
+		change.Old = nil
+	}
+	return append(changes, change), nil
+}
+
+// getPreviewVal returns a deep copy of the value at path in obj, and whether it exists.
+// A nil pointer doesn't exist.
+func getPreviewVal(obj reflect.Value, path []string) (interface{}, bool) {
+	val, _, err := getValAt(path, obj, false)
+	if err != nil || !val.CanInterface() {
+		return nil, false
+	}
+	if val.Kind() == reflect.Ptr && val.IsNil() {
+		return nil, false
+	}
+	return deepCopy(val).Interface(), true
+}
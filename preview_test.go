@@ -0,0 +1,195 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	type Server struct {
+		Port int `json:"port"`
+	}
+	type TestObj struct {
+		Name    string            `json:"name"`
+		Servers map[string]Server `json:"servers"`
+		Tags    []string          `json:"tags"`
+		Limit   *int              `json:"limit"`
+		Backup  string            `json:"backup"`
+	}
+
+	patch := JSONPatch{
+		{Op: OpTypeTest, Path: "/name", Value: "web"},
+		{Op: OpTypeReplace, Path: "/servers/a/port", Value: 8080},
+		{Op: OpTypeAdd, Path: "/servers/b", Value: Server{Port: 9090}},
+		{Op: OpTypeRemove, Path: "/servers/c"},
+		{Op: OpTypeAdd, Path: "/tags/-", Value: "gamma"},
+		{Op: OpTypeAdd, Path: "/limit", Value: 10},
+		{Op: OpTypeMove, From: "/name", Path: "/backup"},
+		{Op: OpTypeCopy, From: "/tags/0", Path: "/tags/1"},
+		{Op: OpTypeRemove, Path: "/servers/nonexistent"},
+	}
+
+	obj := &TestObj{
+		Name: "web",
+		Servers: map[string]Server{
+			"a": {Port: 80},
+			"c": {Port: 443},
+		},
+		Tags: []string{"alpha", "beta"},
+	}
+	orig := &TestObj{
+		Name: "web",
+		Servers: map[string]Server{
+			"a": {Port: 80},
+			"c": {Port: 443},
+		},
+		Tags: []string{"alpha", "beta"},
+	}
+
+	changes, err := Preview(patch, obj)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	expected := []Change{
+		{Index: 1, Path: "/servers/a/port", Type: ChangeTypeReplaced, Old: 80, New: 8080},
+		{Index: 2, Path: "/servers/b", Type: ChangeTypeCreated, New: Server{Port: 9090}},
+		{Index: 3, Path: "/servers/c", Type: ChangeTypeRemoved, Old: Server{Port: 443}},
+		{Index: 4, Path: "/tags/2", Type: ChangeTypeCreated, New: "gamma"},
+		{Index: 5, Path: "/limit", Type: ChangeTypeCreated, New: func() *int { i := 10; return &i }()},
+		{Index: 6, Path: "/name", Type: ChangeTypeRemoved, Old: "web"},
+		{Index: 6, Path: "/backup", Type: ChangeTypeReplaced, Old: "", New: "web"},
+		{Index: 7, Path: "/tags/1", Type: ChangeTypeCreated, New: "alpha"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Preview expected %+v actual %+v", expected, changes)
+	}
+
+	if !reflect.DeepEqual(obj, orig) {
+		t.Errorf("Preview modified object, expected %+v actual %+v", orig, obj)
+	}
+}
+
+func TestPreviewError(t *testing.T) {
+	type TestObj struct {
+		Tags []string `json:"tags"`
+	}
+
+	obj := &TestObj{Tags: []string{"alpha"}}
+	patch := JSONPatch{
+		{Op: OpTypeRemove, Path: "/tags/0"},
+		{Op: OpTypeTest, Path: "/tags/0", Value: "alpha"},
+	}
+	if changes, err := Preview(patch, obj); err == nil {
+		t.Errorf("Preview failing op expected error, actual %+v", changes)
+	}
+	if expected := []string{"alpha"}; !reflect.DeepEqual(obj.Tags, expected) {
+		t.Errorf("Preview modified object, expected %+v actual %+v", expected, obj.Tags)
+	}
+}
+
+func TestPreviewValuesAreCopies(t *testing.T) {
+	type TestObj struct {
+		Tags []string `json:"tags"`
+	}
+
+	obj := &TestObj{Tags: []string{"alpha"}}
+	patch := JSONPatch{
+		{Op: OpTypeReplace, Path: "/tags", Value: []string{"beta"}},
+		{Op: OpTypeReplace, Path: "/tags/0", Value: "gamma"},
+	}
+	changes, err := Preview(patch, obj)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("Preview expected 2 changes, actual %+v", changes)
+	}
+	if expected := []string{"beta"}; !reflect.DeepEqual(changes[0].New, expected) {
+		t.Errorf("Preview change values expected to not be modified by later ops, expected %+v actual %+v", expected, changes[0].New)
+	}
+	changes[0].Old.([]string)[0] = "modified"
+	if obj.Tags[0] != "alpha" {
+		t.Errorf("Preview change values expected to not share memory with the object, actual %+v", obj.Tags)
+	}
+}
+
+func TestPreviewKeySelector(t *testing.T) {
+	type Server struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Servers []Server `json:"servers"`
+	}
+
+	obj := &TestObj{Servers: []Server{{Name: "web", Port: 80}, {Name: "db", Port: 5432}}}
+	patch := JSONPatch{
+		{Op: OpTypeReplace, Path: "/servers/[name=db]/port", Value: 5433},
+		{Op: OpTypeReplace, Path: "/servers/[name=web]", Value: Server{Name: "api", Port: 8080}},
+	}
+	changes, err := Preview(patch, obj)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := []Change{
+		{Index: 0, Path: "/servers/1/port", Type: ChangeTypeReplaced, Old: 5432, New: 5433},
+		{Index: 1, Path: "/servers/0", Type: ChangeTypeReplaced, Old: Server{Name: "web", Port: 80}, New: Server{Name: "api", Port: 8080}},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Preview expected %+v actual %+v", expected, changes)
+	}
+}
+
+func TestPreviewPatchable(t *testing.T) {
+	type TestObj struct {
+		M *testOrderedMap `json:"m"`
+		V testOrderedMap  `json:"v"`
+	}
+
+	obj := &TestObj{
+		M: &testOrderedMap{keys: []string{"a"}, vals: map[string]int{"a": 1}},
+		V: testOrderedMap{keys: []string{"a"}, vals: map[string]int{"a": 1}},
+	}
+	patch := JSONPatch{
+		{Op: OpTypeAdd, Path: "/m/b", Value: 2},
+		{Op: OpTypeRemove, Path: "/v/a"},
+	}
+	if _, err := Preview(patch, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	expected := testOrderedMap{keys: []string{"a"}, vals: map[string]int{"a": 1}}
+	if !reflect.DeepEqual(*obj.M, expected) {
+		t.Errorf("Preview modified obj.M, expected %+v actual %+v", expected, *obj.M)
+	}
+	if !reflect.DeepEqual(obj.V, expected) {
+		t.Errorf("Preview modified obj.V, expected %+v actual %+v", expected, obj.V)
+	}
+}
+
+func TestPreviewWildcard(t *testing.T) {
+	type Server struct {
+		Enabled bool `json:"enabled"`
+	}
+	type TestObj struct {
+		Servers []Server `json:"servers"`
+	}
+
+	obj := &TestObj{Servers: []Server{{}, {Enabled: true}}}
+	patcher := &Patcher{Options: Options{Wildcards: true}}
+	changes, err := patcher.Preview(JSONPatch{{Op: OpTypeReplace, Path: "/servers/*/enabled", Value: true}}, obj)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := []Change{
+		{Index: 0, Path: "/servers/0/enabled", Type: ChangeTypeReplaced, Old: false, New: true},
+		{Index: 0, Path: "/servers/1/enabled", Type: ChangeTypeReplaced, Old: true, New: true},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Preview expected %+v actual %+v", expected, changes)
+	}
+	if _, err := patcher.Preview(JSONPatch{{Op: OpTypeMove, From: "/servers/0", Path: "/servers/*"}}, obj); err == nil {
+		t.Errorf("Preview wildcard move expected error, actual nil")
+	}
+}
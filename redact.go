@@ -0,0 +1,258 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SensitiveTag is the `jsonpatch` struct tag option which marks a field as sensitive, for example `json:"password" jsonpatch:"sensitive"`.
+// The values of sensitive fields, and every value inside them, are redacted where the library reports them. See Options.Redact.
+const SensitiveTag = "sensitive"
+
+// Redacted is a masked value, reported in place of a sensitive value.
+type Redacted string
+
+// RedactedValue is what RedactAll reports in place of sensitive values.
+const RedactedValue = Redacted("[REDACTED]")
+
+// RedactionPolicy returns what's reported in place of val, the sensitive value at the JSON Pointer path.
+type RedactionPolicy func(path string, val interface{}) interface{}
+
+// RedactAll is the default RedactionPolicy, which reports every sensitive value as RedactedValue.
+func RedactAll(path string, val interface{}) interface{} {
+	return RedactedValue
+}
+
+// isSensitiveField returns whether the struct field is tagged as sensitive.
+func isSensitiveField(field reflect.StructField) bool {
+	for _, opt := range strings.Split(field.Tag.Get("jsonpatch"), ",") {
+		if opt == SensitiveTag {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns val, the value at path in a value of typ, with the sensitive values in it replaced per the policy.
+// If the path is in a sensitive field, the whole value is replaced. Otherwise, if the value has sensitive fields, it's returned as generic JSON values, with those fields replaced. Otherwise, it's returned as is.
+// A nil typ, or a nil val, is returned as is.
+func (opts Options) redact(typ reflect.Type, path []string, val interface{}) interface{} {
+	if typ == nil || val == nil {
+		return val
+	}
+	policy := opts.Redact
+	if policy == nil {
+		policy = RedactAll
+	}
+	if isSensitivePath(typ, path) {
+		return policy(FormatPath(path), val)
+	}
+	v := reflect.ValueOf(val)
+	if !hasSensitiveFields(v.Type(), map[reflect.Type]bool{}) {
+		return val
+	}
+	return redactVal(v, path, policy)
+}
+
+// isSensitivePath returns whether the path in a value of typ is in a sensitive struct field.
+func isSensitivePath(typ reflect.Type, path []string) bool {
+	for _, token := range path {
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		switch typ.Kind() {
+		case reflect.Struct:
+			field, ok := getTaggedField(typ, token)
+			if !ok {
+				return false
+			}
+			if isSensitiveField(field) {
+				return true
+			}
+			typ = field.Type
+		case reflect.Map, reflect.Slice, reflect.Array:
+			typ = typ.Elem()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// getTaggedField returns the field of the struct type with the json tag.
+func getTaggedField(typ reflect.Type, tag string) (reflect.StructField, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		if field := typ.Field(i); field.Tag.Get("json") == tag {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// hasSensitiveFields returns whether a value of typ may have a sensitive struct field in it. The seen types are skipped, so recursive types terminate.
+func hasSensitiveFields(typ reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[typ] {
+		return false
+	}
+	seen[typ] = true
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Array:
+		return hasSensitiveFields(typ.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if field := typ.Field(i); isPathField(field) && (isSensitiveField(field) || hasSensitiveFields(field.Type, seen)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redactVal returns the value at path as generic JSON values, with the values of sensitive struct fields replaced per the policy.
+// Structs are maps of their json tags, and only have the fields which can be addressed by a path.
+func redactVal(val reflect.Value, path []string, policy RedactionPolicy) interface{} {
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() {
+			return nil
+		}
+		return redactVal(val.Elem(), path, policy)
+	case reflect.Struct:
+		redacted := map[string]interface{}{}
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Type().Field(i)
+			if !isPathField(field) {
+				continue
+			}
+			tag := field.Tag.Get("json")
+			fieldPath := append(path[:len(path):len(path)], tag)
+			if isSensitiveField(field) {
+				redacted[tag] = policy(FormatPath(fieldPath), val.Field(i).Interface())
+			} else {
+				redacted[tag] = redactVal(val.Field(i), fieldPath, policy)
+			}
+		}
+		return redacted
+	case reflect.Map:
+		if val.IsNil() {
+			return nil
+		}
+		redacted := map[string]interface{}{}
+		iter := val.MapRange()
+		for iter.Next() {
+			token, err := formatMapKey(iter.Key())
+			if err != nil {
+				continue
+			}
+			redacted[token] = redactVal(iter.Value(), append(path[:len(path):len(path)], token), policy)
+		}
+		return redacted
+	case reflect.Slice, reflect.Array:
+		if val.Kind() == reflect.Slice && val.IsNil() {
+			return nil
+		}
+		redacted := make([]interface{}, val.Len())
+		for i := range redacted {
+			redacted[i] = redactVal(val.Index(i), append(path[:len(path):len(path)], strconv.Itoa(i)), policy)
+		}
+		return redacted
+	}
+	return val.Interface()
+}
+
+// redactPatch returns a copy of the patch, whose op paths are in a value of typ, with their sensitive values, and the values of key selectors on sensitive fields, redacted.
+func (opts Options) redactPatch(typ reflect.Type, patch JSONPatch) JSONPatch {
+	redacted := make(JSONPatch, len(patch))
+	for i, patchOp := range patch {
+		redacted[i] = patchOp
+		if path, err := ParsePath(patchOp.Path); err == nil {
+			redacted[i].Value = opts.redact(typ, path, patchOp.Value)
+		}
+		redacted[i].Path = redactPathString(typ, patchOp.Path)
+		if patchOp.From != "" {
+			redacted[i].From = redactPathString(typ, patchOp.From)
+		}
+	}
+	return redacted
+}
+
+// redactKeySelector returns the key selector token, with its value redacted if it selects elements of elemType by a sensitive field.
+// Errors are built without the Options, so they always use RedactedValue.
+func redactKeySelector(elemType reflect.Type, token string, field string) string {
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return token
+	}
+	if structField, ok := getTaggedField(elemType, field); ok && isSensitiveField(structField) {
+		return "[" + field + "=" + string(RedactedValue) + "]"
+	}
+	return token
+}
+
+// redactPath returns the path in a value of typ as a JSON Pointer, with the values of key selectors on sensitive fields redacted, so errors can report it.
+func redactPath(typ reflect.Type, path []string) string {
+	reported := make([]string, len(path))
+	for i, token := range path {
+		reported[i] = token
+		if typ == nil {
+			continue
+		}
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		switch typ.Kind() {
+		case reflect.Struct:
+			field, ok := getTaggedField(typ, token)
+			if !ok {
+				typ = nil
+				continue
+			}
+			typ = field.Type
+		case reflect.Map:
+			typ = typ.Elem()
+		case reflect.Slice, reflect.Array:
+			reported[i] = redactToken(typ, token)
+			typ = typ.Elem()
+		default:
+			typ = nil
+		}
+	}
+	return FormatPath(reported)
+}
+
+// redactPathString is redactPath for a JSON Pointer string. A malformed path has all its key selectors redacted.
+func redactPathString(typ reflect.Type, path string) string {
+	parsed, err := ParsePath(path)
+	if err != nil {
+		return redactKeySelectors(path)
+	}
+	return redactPath(typ, parsed)
+}
+
+// redactToken returns the path token of an element of the slice or array type typ, with its value redacted if it's a key selector on a sensitive field.
+func redactToken(typ reflect.Type, token string) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array {
+		return token
+	}
+	if field, _, ok := parseKeySelector(token); ok {
+		return redactKeySelector(typ.Elem(), token, field)
+	}
+	return token
+}
+
+// redactKeySelectors returns the path with the values of all its key selectors redacted, for paths without a type to tell which are sensitive, or which can't be parsed.
+func redactKeySelectors(path string) string {
+	tokens := strings.Split(path, "/")
+	for i, token := range tokens {
+		if field, _, ok := parseKeySelector(token); ok {
+			tokens[i] = "[" + field + "=" + string(RedactedValue) + "]"
+		}
+	}
+	return strings.Join(tokens, "/")
+}
@@ -0,0 +1,293 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRedactPreview(t *testing.T) {
+	type Cred struct {
+		User   string `json:"user"`
+		Secret string `json:"secret" jsonpatch:"sensitive"`
+	}
+	type TestObj struct {
+		Name    string            `json:"name"`
+		Token   string            `json:"token" jsonpatch:"sensitive" label:"API Token"`
+		Creds   []Cred            `json:"creds" patchStrategy:"merge" patchMergeKey:"secret"`
+		Keys    map[string]string `json:"keys" jsonpatch:"sensitive"`
+		Backups map[string]Cred   `json:"backups"`
+	}
+
+	obj := &TestObj{
+		Name:    "web",
+		Token:   "t0",
+		Creds:   []Cred{{User: "a", Secret: "s0"}},
+		Keys:    map[string]string{"k": "v"},
+		Backups: map[string]Cred{},
+	}
+	patch := JSONPatch{
+		{Op: OpTypeReplace, Path: "/name", Value: "api"},
+		{Op: OpTypeReplace, Path: "/token", Value: "t1"},
+		{Op: OpTypeReplace, Path: "/creds/0/secret", Value: "s1"},
+		{Op: OpTypeAdd, Path: "/keys/l", Value: "w"},
+		{Op: OpTypeAdd, Path: "/backups/b", Value: Cred{User: "b", Secret: "s2"}},
+	}
+	changes, err := Preview(patch, obj)
+	if err != nil {
+		t.Fatalf("Preview error expected nil actual %+v", err)
+	}
+	expected := []Change{
+		{Index: 0, Path: "/name", Type: ChangeTypeReplaced, Old: "web", New: "api"},
+		{Index: 1, Path: "/token", Type: ChangeTypeReplaced, Old: RedactedValue, New: RedactedValue},
+		{Index: 2, Path: "/creds/0/secret", Type: ChangeTypeReplaced, Old: RedactedValue, New: RedactedValue},
+		{Index: 3, Path: "/keys/l", Type: ChangeTypeCreated, New: RedactedValue},
+		{Index: 4, Path: "/backups/b", Type: ChangeTypeCreated, New: map[string]interface{}{"user": "b", "secret": RedactedValue}},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Preview expected %+v actual %+v", expected, changes)
+	}
+
+	// the object is patched as usual
+	if err := Apply(patch, obj); err != nil {
+		t.Fatalf("Apply error expected nil actual %+v", err)
+	}
+	if obj.Token != "t1" || obj.Creds[0].Secret != "s1" || obj.Keys["l"] != "w" || obj.Backups["b"].Secret != "s2" {
+		t.Errorf("Apply expected unredacted values actual %+v", obj)
+	}
+}
+
+func TestRedactPolicy(t *testing.T) {
+	type TestObj struct {
+		Token string `json:"token" jsonpatch:"sensitive" label:"API Token"`
+	}
+
+	obj := &TestObj{Token: "t0"}
+	paths := []string{}
+	patcher := &Patcher{Options: Options{Redact: func(path string, val interface{}) interface{} {
+		paths = append(paths, path)
+		return "len " + strconv.Itoa(len(val.(string)))
+	}}}
+	changes, err := patcher.Preview(JSONPatch{{Op: OpTypeReplace, Path: "/token", Value: "t12"}}, obj)
+	if err != nil {
+		t.Fatalf("Patcher.Preview error expected nil actual %+v", err)
+	}
+	if len(changes) != 1 || changes[0].Old != "len 2" || changes[0].New != "len 3" {
+		t.Errorf("Patcher.Preview expected policy values actual %+v", changes)
+	}
+	if !reflect.DeepEqual(paths, []string{"/token", "/token"}) {
+		t.Errorf("Patcher.Preview policy paths expected %+v actual %+v", []string{"/token", "/token"}, paths)
+	}
+}
+
+func TestRedactSummarize(t *testing.T) {
+	type TestObj struct {
+		Token string `json:"token" jsonpatch:"sensitive" label:"API Token"`
+	}
+
+	obj := &TestObj{Token: "t0"}
+	patch := JSONPatch{{Op: OpTypeReplace, Path: "/token", Value: "t1"}}
+	summaries, err := Summarize(patch, obj)
+	if err != nil {
+		t.Fatalf("Summarize error expected nil actual %+v", err)
+	}
+	diff := RenderDiff(summaries, false)
+	expected := "- API Token: [REDACTED]\n+ API Token: [REDACTED]\n"
+	if diff != expected {
+		t.Errorf("RenderDiff expected %q actual %q", expected, diff)
+	}
+
+	// a nil pointer gives the type, without a value
+	summaries, err = Summarize(patch, (*TestObj)(nil))
+	if err != nil {
+		t.Fatalf("Summarize nil pointer error expected nil actual %+v", err)
+	}
+	text := RenderText(summaries)
+	if expected := "Changed API Token to [REDACTED]\n"; text != expected {
+		t.Errorf("RenderText nil pointer expected %q actual %q", expected, text)
+	}
+}
+
+func TestRedactSummarizeKeySelector(t *testing.T) {
+	type User struct {
+		Name string `json:"name"`
+		SSN  string `json:"ssn" jsonpatch:"sensitive"`
+	}
+	type TestObj struct {
+		Users []User `json:"users"`
+	}
+
+	patch := JSONPatch{
+		{Op: OpTypeReplace, Path: "/users/[ssn=123-45-6789]/name", Value: "b"},
+		{Op: OpTypeMove, From: "/users/[ssn=123-45-6789]", Path: "/users/[name=a]"},
+	}
+	summaries, err := Summarize(patch, (*TestObj)(nil))
+	if err != nil {
+		t.Fatalf("Summarize nil pointer error expected nil actual %+v", err)
+	}
+	expected := []struct{ path, group, label string }{
+		{"/users/[ssn=[REDACTED]]/name", "Users[ssn=[REDACTED]]", "Name"},
+		{"/users/[ssn=[REDACTED]]", "Users", "[ssn=[REDACTED]]"},
+		{"/users/[name=a]", "Users", "[name=a]"},
+	}
+	if len(summaries) != len(expected) {
+		t.Fatalf("Summarize summaries expected %+v actual %+v", len(expected), summaries)
+	}
+	for i, exp := range expected {
+		if summaries[i].Path != exp.path || summaries[i].Group != exp.group || summaries[i].Label != exp.label {
+			t.Errorf("Summarize summary %v expected %+v actual %+v %+v %+v", i, exp, summaries[i].Path, summaries[i].Group, summaries[i].Label)
+		}
+	}
+	if text := RenderText(summaries); strings.Contains(text, "123-45-6789") {
+		t.Errorf("RenderText expected redacted key selectors actual %q", text)
+	}
+}
+
+func TestRedactErrors(t *testing.T) {
+	type Cred struct {
+		User   string `json:"user"`
+		Secret string `json:"secret" jsonpatch:"sensitive"`
+	}
+	type TestObj struct {
+		Creds []Cred `json:"creds" patchStrategy:"merge" patchMergeKey:"secret"`
+	}
+
+	obj := &TestObj{Creds: []Cred{{User: "a", Secret: "s0"}}}
+	err := Apply(JSONPatch{{Op: OpTypeReplace, Path: "/creds/[secret=s9]/user", Value: "b"}}, obj)
+	if err == nil || strings.Contains(err.Error(), "s9") || !strings.Contains(err.Error(), "[secret=[REDACTED]]") {
+		t.Errorf("Apply key selector error expected redacted actual %+v", err)
+	}
+
+	obj.Creds = append(obj.Creds, Cred{User: "b", Secret: "s0"})
+	err = ApplyStrategicMergePatch([]byte(`{"creds":[{"secret":"s0","user":"c"}]}`), obj)
+	if err == nil || strings.Contains(err.Error(), "s0") || !strings.Contains(err.Error(), "[secret=[REDACTED]]") {
+		t.Errorf("ApplyStrategicMergePatch merge key error expected redacted actual %+v", err)
+	}
+}
+
+func TestRedactSubscribe(t *testing.T) {
+	type Cred struct {
+		User   string `json:"user"`
+		Secret string `json:"secret" jsonpatch:"sensitive"`
+	}
+	type TestObj struct {
+		Creds []Cred `json:"creds" patchStrategy:"merge" patchMergeKey:"secret"`
+	}
+
+	doc := NewDocument(TestObj{Creds: []Cred{{User: "a", Secret: "s0"}}})
+	sub, err := doc.Subscribe("/creds/0", 10)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+	defer sub.Close()
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/creds/0/secret", Value: "s1"}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/creds", Value: []Cred{{User: "b", Secret: "s2"}}}}); err != nil {
+		t.Fatalf("Document.Apply parent error expected nil actual %+v", err)
+	}
+
+	expected := []Notification{
+		{Version: 1, Ops: JSONPatch{{Op: OpTypeReplace, Path: "/secret", Value: RedactedValue}}, Value: map[string]interface{}{"user": "a", "secret": RedactedValue}, Exists: true},
+		{Version: 2, Ops: JSONPatch{{Op: OpTypeReplace, Path: "", Value: map[string]interface{}{"user": "b", "secret": RedactedValue}}}, Value: map[string]interface{}{"user": "b", "secret": RedactedValue}, Exists: true},
+	}
+	for _, exp := range expected {
+		n := <-sub.C
+		if !reflect.DeepEqual(n, exp) {
+			t.Errorf("Subscription notification expected %+v actual %+v", exp, n)
+		}
+	}
+}
+
+func TestRedactHistory(t *testing.T) {
+	type Cred struct {
+		User   string `json:"user"`
+		Secret string `json:"secret" jsonpatch:"sensitive"`
+	}
+	type TestObj struct {
+		Name  string `json:"name"`
+		Token string `json:"token" jsonpatch:"sensitive" label:"API Token"`
+		Creds []Cred `json:"creds"`
+	}
+
+	doc := NewDocument(TestObj{
+		Name:  "web",
+		Token: "t0",
+		Creds: []Cred{{User: "a", Secret: "s0"}, {User: "b", Secret: "s1"}},
+	})
+	hist := NewHistory(doc, 0)
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/token", Value: "t1"}, {Op: OpTypeReplace, Path: "/name", Value: "api"}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	if _, err := doc.Apply(JSONPatch{
+		{Op: OpTypeReplace, Path: "/creds/[secret=s0]/user", Value: "c"},
+		{Op: OpTypeMove, From: "/creds/[secret=s1]", Path: "/creds/[user=c]"},
+	}); err != nil {
+		t.Fatalf("Document.Apply key selectors error expected nil actual %+v", err)
+	}
+	buf := bytes.Buffer{}
+	if err := hist.WriteJSONLines(&buf); err != nil {
+		t.Fatalf("History.WriteJSONLines error expected nil actual %+v", err)
+	}
+	line := buf.String()
+	if strings.Contains(line, "t1") || !strings.Contains(line, `"value":"[REDACTED]"`) || !strings.Contains(line, `"value":"api"`) {
+		t.Errorf("History.WriteJSONLines expected redacted token actual %+v", line)
+	}
+	if strings.Contains(line, "s0") || strings.Contains(line, "s1") || !strings.Contains(line, `"path":"/creds/[secret=[REDACTED]]/user"`) || !strings.Contains(line, `"from":"/creds/[secret=[REDACTED]]"`) || !strings.Contains(line, `"path":"/creds/[user=c]"`) {
+		t.Errorf("History.WriteJSONLines expected redacted key selectors actual %+v", line)
+	}
+
+	// the recorded patches aren't redacted, so past versions are rebuilt as they were
+	val, err := hist.At(1)
+	if err != nil {
+		t.Fatalf("History.At error expected nil actual %+v", err)
+	}
+	if val.Token != "t1" {
+		t.Errorf("History.At token expected %+v actual %+v", "t1", val.Token)
+	}
+}
+
+func TestRedactErrorPaths(t *testing.T) {
+	type Cred struct {
+		User   string   `json:"user"`
+		Secret string   `json:"secret" jsonpatch:"sensitive"`
+		Tags   []string `json:"tags"`
+	}
+	type TestObj struct {
+		Creds []Cred `json:"creds" patchStrategy:"merge" patchMergeKey:"secret"`
+	}
+
+	tests := []struct {
+		name   string
+		apply  func(obj *TestObj) error
+		errStr string
+	}{
+		{"test", func(obj *TestObj) error {
+			return Apply(JSONPatch{{Op: OpTypeTest, Path: "/creds/[secret=s0]/user", Value: "b"}}, obj)
+		}, "test op failed: value at path /creds/[secret=[REDACTED]]/user"},
+		{"malformed", func(obj *TestObj) error {
+			return Apply(JSONPatch{{Op: OpTypeTest, Path: "/creds/[secret=s0~]/user", Value: "b"}}, obj)
+		}, "malformed patch op path '/creds/[secret=[REDACTED]]/user'"},
+		{"wildcard match", func(obj *TestObj) error {
+			return ApplyWithOptions(JSONPatch{{Op: OpTypeTest, Path: "/creds/[secret=s0]/tags/*", Value: "y"}}, obj, Options{Wildcards: true})
+		}, "match '/creds/[secret=[REDACTED]]/tags/0'"},
+		{"wildcard matched nothing", func(obj *TestObj) error {
+			return ApplyWithOptions(JSONPatch{{Op: OpTypeRemove, Path: "/creds/[secret=s1]/tags/*"}}, obj, Options{Wildcards: true})
+		}, "wildcard path '/creds/[secret=[REDACTED]]/tags/*' matched nothing"},
+		{"merging", func(obj *TestObj) error {
+			return ApplyStrategicMergePatch([]byte(`{"creds":[{"secret":"s0","user":1}]}`), obj)
+		}, "merging '/creds/[secret=[REDACTED]]/user'"},
+		{"merge patch op", func(obj *TestObj) error {
+			return (&Patcher{Options: StrictOptions()}).ApplyStrategicMergePatch([]byte(`{"creds":[{"secret":"s0","user":null}]}`), obj)
+		}, "applying merge patch op remove '/creds/[secret=[REDACTED]]/user'"},
+	}
+	for _, test := range tests {
+		obj := &TestObj{Creds: []Cred{{User: "a", Secret: "s0", Tags: []string{"x"}}, {User: "b", Secret: "s1"}}}
+		err := test.apply(obj)
+		if err == nil || !strings.Contains(err.Error(), test.errStr) || strings.Contains(err.Error(), "s0") || strings.Contains(err.Error(), "s1") {
+			t.Errorf("%v error expected '%v' actual %+v", test.name, test.errStr, err)
+		}
+	}
+}
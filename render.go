@@ -0,0 +1,291 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ChangeSummary is a readable description of a change a patch makes, returned by Summarize.
+type ChangeSummary struct {
+	Change
+	// Group is the label of the object containing the changed value, or empty if it's a member of the root object.
+	Group string
+	// Label is the label of the changed value in its Group.
+	Label string
+	// Text describes the change in its Group, for example "Changed Port from 80 to 8080".
+	Text string
+}
+
+// Summarize returns readable descriptions of the changes the patch makes to obj, without modifying it.
+// See Patcher.Summarize.
+func Summarize(patch JSONPatch, obj interface{}) ([]ChangeSummary, error) {
+	return (&Patcher{}).Summarize(patch, obj)
+}
+
+// Summarize returns readable descriptions of the changes the patch makes to obj, which is the value before the patch, or a pointer to it.
+// Struct fields are labelled by their `label` tag, or else their Go field name, and map keys and slice indices are labelled in brackets, for example "Servers[0] Port".
+//
+// If obj isn't nil, the changes and their old and new values are from Preview, and an error is returned if the patch doesn't apply.
+// If obj is nil, the changes are from the ops alone, so old values are unknown, and paths are labelled by their tokens.
+// If obj is a nil pointer, the changes are from the ops alone, but paths are labelled by its type, and sensitive values, and the values of key selectors on sensitive fields, are redacted.
+func (p *Patcher) Summarize(patch JSONPatch, obj interface{}) ([]ChangeSummary, error) {
+	if obj == nil {
+		return p.summarizeOps(patch, nil), nil
+	}
+	val := reflect.ValueOf(obj)
+	if val.Kind() == reflect.Ptr && val.IsNil() {
+		return p.summarizeOps(patch, val.Type().Elem()), nil
+	}
+	if val.Kind() != reflect.Ptr {
+		ptr := reflect.New(val.Type())
+		ptr.Elem().Set(val)
+		val = ptr
+	}
+	changes, err := p.Preview(patch, val.Interface())
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]ChangeSummary, 0, len(changes))
+	for _, change := range changes {
+		summaries = append(summaries, newChangeSummary(change, val.Type().Elem()))
+	}
+	return summaries, nil
+}
+
+// summarizeOps returns the summaries of the changes made by the ops of the patch to a value of typ, which is nil if the type is unknown, without an object.
+// A move is a removal of its from and a creation at its path, the same as in Preview.
+func (p *Patcher) summarizeOps(patch JSONPatch, typ reflect.Type) []ChangeSummary {
+	summaries := []ChangeSummary{}
+	for i, patchOp := range patch {
+		changes := []Change{}
+		switch patchOp.Op {
+		case OpTypeTest:
+		case OpTypeAdd:
+			changes = append(changes, Change{Index: i, Path: patchOp.Path, Type: ChangeTypeCreated, New: patchOp.Value})
+		case OpTypeRemove:
+			changes = append(changes, Change{Index: i, Path: patchOp.Path, Type: ChangeTypeRemoved})
+		case OpTypeMove:
+			changes = append(changes, Change{Index: i, Path: patchOp.From, Type: ChangeTypeRemoved}, Change{Index: i, Path: patchOp.Path, Type: ChangeTypeCreated})
+		case OpTypeCopy:
+			changes = append(changes, Change{Index: i, Path: patchOp.Path, Type: ChangeTypeCreated})
+		default:
+			changes = append(changes, Change{Index: i, Path: patchOp.Path, Type: ChangeTypeReplaced, New: patchOp.Value})
+		}
+		for _, change := range changes {
+			if path, err := ParsePath(change.Path); err == nil {
+				change.New = p.Options.redact(typ, path, change.New)
+			}
+			change.Path = redactPathString(typ, change.Path)
+			summaries = append(summaries, newChangeSummary(change, typ))
+		}
+	}
+	return summaries
+}
+
+// newChangeSummary returns the summary of the change to a value of typ, which is nil if the type is unknown.
+// Old and New values which are nil are unknown, except the New value of a replacement, which is shown as null.
+func newChangeSummary(change Change, typ reflect.Type) ChangeSummary {
+	labels := []string{}
+	if path, err := ParsePath(change.Path); err == nil {
+		labels = getPathLabels(typ, path)
+	} else {
+		labels = []string{change.Path}
+	}
+	summary := ChangeSummary{Change: change}
+	if len(labels) > 0 {
+		summary.Group = joinLabels(labels[:len(labels)-1])
+		summary.Label = labels[len(labels)-1]
+	}
+
+	switch change.Type {
+	case ChangeTypeCreated:
+		summary.Text = "Added " + summary.Label
+		if change.New != nil {
+			summary.Text += " " + formatRenderVal(change.New)
+		}
+	case ChangeTypeRemoved:
+		summary.Text = "Removed " + summary.Label
+		if change.Old != nil {
+			summary.Text += " " + formatRenderVal(change.Old)
+		}
+	default:
+		summary.Text = "Changed " + summary.Label
+		if change.Old != nil {
+			summary.Text += " from " + formatRenderVal(change.Old)
+		}
+		summary.Text += " to " + formatRenderVal(change.New)
+	}
+	return summary
+}
+
+// getPathLabels returns the label of each token of the path in a value of typ.
+// Struct fields are their `label` tag or Go field name, and other tokens are in brackets. If typ is nil, or the path leaves the types it can follow, the tokens are used as is.
+func getPathLabels(typ reflect.Type, path []string) []string {
+	labels := make([]string, 0, len(path))
+	for _, token := range path {
+		for typ != nil && typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ == nil {
+			labels = append(labels, token)
+			continue
+		}
+		switch typ.Kind() {
+		case reflect.Struct:
+			label := token
+			next := reflect.Type(nil)
+			for i := 0; i < typ.NumField(); i++ {
+				if field := typ.Field(i); field.Tag.Get("json") == token {
+					label = field.Tag.Get("label")
+					if label == "" {
+						label = field.Name
+					}
+					next = field.Type
+					break
+				}
+			}
+			labels = append(labels, label)
+			typ = next
+		case reflect.Map, reflect.Slice, reflect.Array:
+			if _, _, ok := parseKeySelector(token); ok {
+				labels = append(labels, token)
+			} else {
+				labels = append(labels, "["+token+"]")
+			}
+			typ = typ.Elem()
+		default:
+			labels = append(labels, token)
+			typ = nil
+		}
+	}
+	return labels
+}
+
+// joinLabels joins path labels with spaces, except bracketed labels, which are appended to the label before them, for example "Servers[0] Port".
+func joinLabels(labels []string) string {
+	sb := strings.Builder{}
+	for i, label := range labels {
+		if i > 0 && !strings.HasPrefix(label, "[") {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(label)
+	}
+	return sb.String()
+}
+
+// formatRenderVal returns the value as it's shown in a summary. Strings are in single quotes, numbers, bools, and Redacted values are as is, and other values are JSON.
+func formatRenderVal(val interface{}) string {
+	if redacted, ok := val.(Redacted); ok {
+		return string(redacted)
+	}
+	v := reflect.ValueOf(val)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return "null"
+	}
+	if stringer, ok := v.Interface().(fmt.Stringer); ok {
+		return "'" + stringer.String() + "'"
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return "'" + v.String() + "'"
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v.Interface())
+	}
+	bts, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Sprintf("%+v", v.Interface())
+	}
+	return string(bts)
+}
+
+// groupSummaries returns the summaries grouped by their Group. The root group is first, and the rest are in the order they first appear.
+func groupSummaries(summaries []ChangeSummary) [][]ChangeSummary {
+	groups := [][]ChangeSummary{nil}
+	indexes := map[string]int{"": 0}
+	for _, summary := range summaries {
+		i, ok := indexes[summary.Group]
+		if !ok {
+			i = len(groups)
+			indexes[summary.Group] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], summary)
+	}
+	if len(groups[0]) == 0 {
+		groups = groups[1:]
+	}
+	return groups
+}
+
+// RenderText renders the summaries as plain text, one change per line, with the changes to members of an object indented under its label. For example:
+//
+//	Changed Name from 'web' to 'api'
+//	Servers[0]:
+//	  Changed Port from 80 to 8080
+//	  Removed Host 'a.example'
+func RenderText(summaries []ChangeSummary) string {
+	sb := strings.Builder{}
+	for _, group := range groupSummaries(summaries) {
+		indent := ""
+		if group[0].Group != "" {
+			sb.WriteString(group[0].Group + ":\n")
+			indent = "  "
+		}
+		for _, summary := range group {
+			sb.WriteString(indent + summary.Text + "\n")
+		}
+	}
+	return sb.String()
+}
+
+const (
+	renderColorRemoved = "\x1b[31m"
+	renderColorAdded   = "\x1b[32m"
+	renderColorGroup   = "\x1b[36m"
+	renderColorReset   = "\x1b[0m"
+)
+
+// RenderDiff renders the summaries in the style of a unified diff, with a "-" line for each old value and a "+" line for each new value, under an "@@ <group> @@" line for each object. For example:
+//
+//	@@ Servers[0] @@
+//	- Port: 80
+//	+ Port: 8080
+//	+ Host: 'b.example'
+//
+// If color is true, the lines are colored with ANSI escape codes.
+func RenderDiff(summaries []ChangeSummary, color bool) string {
+	sb := strings.Builder{}
+	writeLine := func(colorCode string, line string) {
+		if color {
+			line = colorCode + line + renderColorReset
+		}
+		sb.WriteString(line + "\n")
+	}
+	for _, group := range groupSummaries(summaries) {
+		if group[0].Group != "" {
+			writeLine(renderColorGroup, "@@ "+group[0].Group+" @@")
+		}
+		for _, summary := range group {
+			if summary.Type != ChangeTypeCreated {
+				line := "- " + summary.Label
+				if summary.Old != nil {
+					line += ": " + formatRenderVal(summary.Old)
+				}
+				writeLine(renderColorRemoved, line)
+			}
+			if summary.Type != ChangeTypeRemoved {
+				line := "+ " + summary.Label
+				if summary.New != nil || summary.Type == ChangeTypeReplaced {
+					line += ": " + formatRenderVal(summary.New)
+				}
+				writeLine(renderColorAdded, line)
+			}
+		}
+	}
+	return sb.String()
+}
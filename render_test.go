@@ -0,0 +1,166 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	type Server struct {
+		Host string `json:"host"`
+		Port int    `json:"port" label:"Server Port"`
+	}
+	type TestObj struct {
+		Name    string         `json:"name"`
+		Tags    []string       `json:"tags" label:"tag"`
+		Servers []Server       `json:"servers"`
+		Limits  map[string]int `json:"limits"`
+		Owner   *Server        `json:"owner"`
+	}
+
+	obj := TestObj{
+		Name:    "web",
+		Tags:    []string{"alpha", "beta"},
+		Servers: []Server{{Host: "a.example", Port: 80}},
+		Limits:  map[string]int{"cpu": 2},
+	}
+	patch := JSONPatch{
+		{Op: OpTypeTest, Path: "/name", Value: "web"},
+		{Op: OpTypeReplace, Path: "/name", Value: "api"},
+		{Op: OpTypeReplace, Path: "/servers/0/port", Value: 8080},
+		{Op: OpTypeRemove, Path: "/tags/1"},
+		{Op: OpTypeAdd, Path: "/limits/mem", Value: 4},
+		{Op: OpTypeAdd, Path: "/owner", Value: Server{Host: "o.example"}},
+		{Op: OpTypeReplace, Path: "/servers/[host=a.example]/host", Value: "b.example"},
+	}
+	summaries, err := Summarize(patch, &obj)
+	if err != nil {
+		t.Fatalf("Summarize error expected nil actual %+v", err)
+	}
+	expected := []struct {
+		group string
+		label string
+		text  string
+	}{
+		{"", "Name", "Changed Name from 'web' to 'api'"},
+		{"Servers[0]", "Server Port", "Changed Server Port from 80 to 8080"},
+		{"tag", "[1]", "Removed [1] 'beta'"},
+		{"Limits", "[mem]", "Added [mem] 4"},
+		{"", "Owner", `Added Owner {"host":"o.example","port":0}`},
+		{"Servers[0]", "Host", "Changed Host from 'a.example' to 'b.example'"},
+	}
+	if len(summaries) != len(expected) {
+		t.Fatalf("Summarize expected %+v summaries actual %+v", len(expected), summaries)
+	}
+	for i, summary := range summaries {
+		if summary.Group != expected[i].group || summary.Label != expected[i].label || summary.Text != expected[i].text {
+			t.Errorf("Summarize %v expected %+v actual %+v", i, expected[i], summary)
+		}
+	}
+	if obj.Name != "web" || obj.Servers[0].Port != 80 || len(obj.Tags) != 2 || obj.Owner != nil {
+		t.Errorf("Summarize expected object unmodified actual %+v", obj)
+	}
+
+	// the value before the patch doesn't have to be a pointer
+	if _, err := Summarize(patch, obj); err != nil {
+		t.Errorf("Summarize value error expected nil actual %+v", err)
+	}
+	if _, err := Summarize(JSONPatch{{Op: OpTypeRemove, Path: "/nope"}}, &obj); err == nil {
+		t.Errorf("Summarize bad patch error expected actual nil")
+	}
+}
+
+func TestSummarizeWithoutObject(t *testing.T) {
+	patch := JSONPatch{
+		{Op: OpTypeReplace, Path: "/servers/0/port", Value: 8080},
+		{Op: OpTypeMove, From: "/tags/0", Path: "/tags/1"},
+		{Op: OpTypeCopy, From: "/name", Path: "/alias"},
+		{Op: OpTypeTest, Path: "/name", Value: "web"},
+	}
+	summaries, err := Summarize(patch, nil)
+	if err != nil {
+		t.Fatalf("Summarize error expected nil actual %+v", err)
+	}
+	expected := []string{"Changed port to 8080", "Removed 0", "Added 1", "Added alias"}
+	actual := []string{}
+	for _, summary := range summaries {
+		actual = append(actual, summary.Text)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Summarize without object expected %+v actual %+v", expected, actual)
+	}
+	if summaries[0].Group != "servers 0" {
+		t.Errorf("Summarize without object group expected 'servers 0' actual '%v'", summaries[0].Group)
+	}
+}
+
+func TestRender(t *testing.T) {
+	type Server struct {
+		Host string `json:"host"`
+		Port int    `json:"port" label:"Server Port"`
+	}
+	type TestObj struct {
+		Name    string         `json:"name"`
+		Tags    []string       `json:"tags" label:"tag"`
+		Servers []Server       `json:"servers"`
+		Limits  map[string]int `json:"limits"`
+	}
+
+	obj := TestObj{
+		Name:    "web",
+		Tags:    []string{"alpha", "beta"},
+		Servers: []Server{{Host: "a.example", Port: 80}},
+		Limits:  map[string]int{"cpu": 2},
+	}
+	patch := JSONPatch{
+		{Op: OpTypeReplace, Path: "/servers/0/port", Value: 8080},
+		{Op: OpTypeReplace, Path: "/name", Value: "api"},
+		{Op: OpTypeRemove, Path: "/tags/1"},
+		{Op: OpTypeAdd, Path: "/servers/0/host", Value: "b.example"},
+	}
+	summaries, err := Summarize(patch, &obj)
+	if err != nil {
+		t.Fatalf("Summarize error expected nil actual %+v", err)
+	}
+
+	expectedText := strings.Join([]string{
+		"Changed Name from 'web' to 'api'",
+		"Servers[0]:",
+		"  Changed Server Port from 80 to 8080",
+		"  Changed Host from 'a.example' to 'b.example'",
+		"tag:",
+		"  Removed [1] 'beta'",
+		"",
+	}, "\n")
+	if text := RenderText(summaries); text != expectedText {
+		t.Errorf("RenderText expected %q actual %q", expectedText, text)
+	}
+
+	expectedDiff := strings.Join([]string{
+		"- Name: 'web'",
+		"+ Name: 'api'",
+		"@@ Servers[0] @@",
+		"- Server Port: 80",
+		"+ Server Port: 8080",
+		"- Host: 'a.example'",
+		"+ Host: 'b.example'",
+		"@@ tag @@",
+		"- [1]: 'beta'",
+		"",
+	}, "\n")
+	if diff := RenderDiff(summaries, false); diff != expectedDiff {
+		t.Errorf("RenderDiff expected %q actual %q", expectedDiff, diff)
+	}
+
+	colored := RenderDiff(summaries, true)
+	for _, line := range []string{"\x1b[31m- Name: 'web'\x1b[0m\n", "\x1b[32m+ Name: 'api'\x1b[0m\n", "\x1b[36m@@ tag @@\x1b[0m\n"} {
+		if !strings.Contains(colored, line) {
+			t.Errorf("RenderDiff color expected line %q actual %q", line, colored)
+		}
+	}
+
+	if text := RenderText(nil); text != "" {
+		t.Errorf("RenderText empty expected '' actual %q", text)
+	}
+}
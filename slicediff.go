@@ -0,0 +1,304 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// diffSlice appends the ops to transform the slice a into the slice b at path to patch, with the slice diff strategy of the options.
+// The key is the `patchMergeKey` tag of the slice's struct field, if it's one.
+func (d differ) diffSlice(patch *JSONPatch, path []string, parent reflect.Kind, key string, a reflect.Value, b reflect.Value) error {
+	if d.opts.Slices == "" || d.opts.Slices == SliceDiffStrategyIndex {
+		if !diffableSlice(a, b) {
+			return diffSet(patch, path, parent, a, b)
+		}
+		return d.diffSliceIndexes(patch, path, a, b)
+	}
+
+	if key == "" {
+		key = d.opts.Key
+	}
+	match, ok := []int(nil), false
+	if d.opts.Slices == SliceDiffStrategyKeyed && key != "" {
+		match, ok = matchSliceKeys(a, b, key)
+	}
+	if !ok {
+		match = matchSliceLCS(a, b)
+	}
+	for j, i := range match {
+		if elem := b.Index(j); i < 0 && elem.Kind() == reflect.Ptr && elem.IsNil() {
+			return diffSet(patch, path, parent, a, b) // nil can't be added to a slice of pointers
+		}
+	}
+	return d.diffSliceEdits(patch, path, a, b, match)
+}
+
+// matchSliceKeys returns the index of the element of a with the same key as each element of b, or -1 if there is none.
+// Returns false if any element of a or b is nil, or has a missing or duplicate key.
+func matchSliceKeys(a reflect.Value, b reflect.Value, key string) ([]int, bool) {
+	aIndexes := map[string]int{}
+	for i := 0; i < a.Len(); i++ {
+		keyVal, ok := getKeyVal(a.Index(i), key)
+		if !ok {
+			return nil, false
+		}
+		if _, ok := aIndexes[keyVal]; ok {
+			return nil, false
+		}
+		aIndexes[keyVal] = i
+	}
+	match := make([]int, b.Len())
+	bKeys := map[string]struct{}{}
+	for j := range match {
+		keyVal, ok := getKeyVal(b.Index(j), key)
+		if !ok {
+			return nil, false
+		}
+		if _, ok := bKeys[keyVal]; ok {
+			return nil, false
+		}
+		bKeys[keyVal] = struct{}{}
+		match[j] = -1
+		if i, ok := aIndexes[keyVal]; ok {
+			match[j] = i
+		}
+	}
+	return match, true
+}
+
+// matchSliceLCS returns the index of the element of a equal to each element of b, or -1 if there is none.
+// The elements in the longest common subsequence of a and b are matched first, and then the remaining elements of b are matched to equal remaining elements of a, which are moved.
+func matchSliceLCS(a reflect.Value, b reflect.Value) []int {
+	equal := func(i int, j int) bool {
+		return reflect.DeepEqual(a.Index(i).Interface(), b.Index(j).Interface())
+	}
+	match := make([]int, b.Len())
+	for j := range match {
+		match[j] = -1
+	}
+	used := make([]bool, a.Len())
+	for _, pair := range getLCSPairs(a.Len(), b.Len(), equal) {
+		match[pair[1]] = pair[0]
+		used[pair[0]] = true
+	}
+	for j := range match {
+		if match[j] >= 0 {
+			continue
+		}
+		for i := range used {
+			if !used[i] && equal(i, j) {
+				match[j] = i
+				used[i] = true
+				break
+			}
+		}
+	}
+	return match
+}
+
+// getLCSPairs returns the index pairs of the elements in the longest common subsequence of sequences of lengths n and m, whose elements at i and j are equal if equal returns true.
+// It uses Myers' O(ND) diff algorithm, after matching the common prefix and suffix.
+func getLCSPairs(n int, m int, equal func(i int, j int) bool) [][2]int {
+	pairs := [][2]int{}
+	prefix := 0
+	for prefix < n && prefix < m && equal(prefix, prefix) {
+		pairs = append(pairs, [2]int{prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && suffix < m-prefix && equal(n-1-suffix, m-1-suffix) {
+		suffix++
+	}
+
+	// the middle of the sequences, from prefix to the suffix, as x in [0, n) and y in [0, m)
+	midN, midM := n-prefix-suffix, m-prefix-suffix
+	midEqual := func(x int, y int) bool { return equal(prefix+x, prefix+y) }
+
+	// v[offset+k] is the furthest x on diagonal k = x-y, and trace is v before each edit distance d
+	offset := midN + midM + 1
+	v := make([]int, 2*offset+1)
+	trace := [][]int{}
+	found := midN == 0 && midM == 0
+	for d := 0; d <= midN+midM && !found; d++ {
+		trace = append(trace, append([]int{}, v...))
+		for k := -d; k <= d; k += 2 {
+			x := 0
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down, an insertion from b
+			} else {
+				x = v[offset+k-1] + 1 // right, a deletion from a
+			}
+			y := x - k
+			for x < midN && y < midM && midEqual(x, y) {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= midN && y >= midM {
+				found = true
+				break
+			}
+		}
+	}
+
+	// backtrack from the end, collecting the diagonal snakes, which are equal elements
+	midPairs := [][2]int{}
+	x, y := midN, midM
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			midPairs = append(midPairs, [2]int{prefix + x, prefix + y})
+		}
+		x, y = prevX, prevY
+	}
+	for i := len(midPairs) - 1; i >= 0; i-- {
+		pairs = append(pairs, midPairs[i])
+	}
+
+	for i := suffix; i > 0; i-- {
+		pairs = append(pairs, [2]int{n - i, m - i})
+	}
+	return pairs
+}
+
+// sliceDiffElem is an element of a slice being transformed by diffSliceEdits.
+type sliceDiffElem struct {
+	// bIndex is the index of the element in b.
+	bIndex int
+	// placed is whether the element is in order with the other placed elements, so it doesn't need to be moved.
+	placed bool
+}
+
+// diffSliceEdits appends the ops to transform the slice a into the slice b at path to patch, where each element of b is match, which is the index of the element of a it's from, or -1 if it's new.
+// The elements of a which aren't matched are removed, the matched elements which aren't in the longest increasing subsequence of match are moved, the new elements are inserted, and then the matched elements are diffed.
+// Each op's indices are of the slice as it is when the op is applied.
+func (d differ) diffSliceEdits(patch *JSONPatch, path []string, a reflect.Value, b reflect.Value, match []int) error {
+	elemPath := func(i int) string {
+		return FormatPath(append(path[:len(path):len(path)], strconv.Itoa(i)))
+	}
+	appendPath := FormatPath(append(path[:len(path):len(path)], "-"))
+
+	bIndexes := make([]int, a.Len())
+	for i := range bIndexes {
+		bIndexes[i] = -1
+	}
+	for j, i := range match {
+		if i >= 0 {
+			bIndexes[i] = j
+		}
+	}
+
+	removed := [][]string{}
+	for i := 0; i < a.Len(); i++ {
+		if bIndexes[i] < 0 {
+			removed = append(removed, append(path[:len(path):len(path)], strconv.Itoa(i)))
+		}
+	}
+	sortRemovePaths(removed)
+	for _, removedPath := range removed {
+		*patch = append(*patch, JSONPatchOp{Op: OpTypeRemove, Path: FormatPath(removedPath)})
+	}
+
+	kept := getIncreasingMatches(match)
+	elems := []sliceDiffElem{}
+	for _, j := range bIndexes {
+		if j >= 0 {
+			elems = append(elems, sliceDiffElem{bIndex: j, placed: kept[j]})
+		}
+	}
+
+	// move each matched element after the placed elements before it in b, in the order of b
+	for j, i := range match {
+		if i < 0 || kept[j] {
+			continue
+		}
+		from := 0
+		for from < len(elems) && elems[from].bIndex != j {
+			from++
+		}
+		elems = append(elems[:from], elems[from+1:]...)
+		to := 0
+		for k, elem := range elems {
+			if elem.placed && elem.bIndex < j {
+				to = k + 1
+			}
+		}
+		elems = append(elems[:to], append([]sliceDiffElem{{bIndex: j, placed: true}}, elems[to:]...)...)
+		if from != to {
+			*patch = append(*patch, JSONPatchOp{Op: OpTypeMove, From: elemPath(from), Path: elemPath(to)})
+		}
+	}
+
+	// insert the new elements in the order of b, so the elements before each are in place
+	for j, i := range match {
+		if i >= 0 {
+			continue
+		}
+		val := deepCopy(b.Index(j))
+		if val.Kind() == reflect.Ptr {
+			val = val.Elem()
+		}
+		*patch = append(*patch, JSONPatchOp{Op: OpTypeAdd, Path: appendPath, Value: val.Interface()})
+		if j < len(elems) {
+			*patch = append(*patch, JSONPatchOp{Op: OpTypeMove, From: elemPath(len(elems)), Path: elemPath(j)})
+		}
+		elems = append(elems[:j], append([]sliceDiffElem{{bIndex: j, placed: true}}, elems[j:]...)...)
+	}
+
+	for j, i := range match {
+		if i < 0 {
+			continue
+		}
+		if err := d.diffVal(patch, append(path[:len(path):len(path)], strconv.Itoa(j)), reflect.Slice, "", a.Index(i), b.Index(j)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getIncreasingMatches returns whether each index of match is in the longest increasing subsequence of the matches which aren't -1.
+func getIncreasingMatches(match []int) []bool {
+	// tails[l] is the index of match which ends the increasing subsequence of length l+1 with the least last value
+	tails := []int{}
+	prev := make([]int, len(match))
+	for j, i := range match {
+		prev[j] = -1
+		if i < 0 {
+			continue
+		}
+		l, r := 0, len(tails)
+		for l < r {
+			mid := (l + r) / 2
+			if match[tails[mid]] < i {
+				l = mid + 1
+			} else {
+				r = mid
+			}
+		}
+		if l > 0 {
+			prev[j] = tails[l-1]
+		}
+		if l == len(tails) {
+			tails = append(tails, j)
+		} else {
+			tails[l] = j
+		}
+	}
+
+	kept := make([]bool, len(match))
+	if len(tails) > 0 {
+		for j := tails[len(tails)-1]; j >= 0; j = prev[j] {
+			kept[j] = true
+		}
+	}
+	return kept
+}
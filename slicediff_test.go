@@ -0,0 +1,159 @@
+package jsonpatch
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestDiffSliceStrategies(t *testing.T) {
+	type Server struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Tags     []string  `json:"tags"`
+		Servers  []Server  `json:"servers" patchMergeKey:"name"`
+		Backups  []*Server `json:"backups"`
+		Nums     []int     `json:"nums"`
+		Children []TestObj `json:"children"`
+	}
+
+	a := TestObj{
+		Tags:    []string{"b", "c", "d"},
+		Servers: []Server{{Name: "web", Port: 80}, {Name: "api", Port: 8080}, {Name: "db", Port: 5432}},
+	}
+	b := TestObj{
+		Tags:    []string{"a", "b", "c", "d"},
+		Servers: []Server{{Name: "db", Port: 5432}, {Name: "web", Port: 81}, {Name: "cache", Port: 6379}},
+	}
+	tests := []struct {
+		strategy SliceDiffStrategy
+		expected JSONPatch
+	}{
+		{SliceDiffStrategyIndex, JSONPatch{
+			{Op: OpTypeReplace, Path: "/tags/0", Value: "a"},
+			{Op: OpTypeReplace, Path: "/tags/1", Value: "b"},
+			{Op: OpTypeReplace, Path: "/tags/2", Value: "c"},
+			{Op: OpTypeAdd, Path: "/tags/-", Value: "d"},
+			{Op: OpTypeReplace, Path: "/servers/0/name", Value: "db"},
+			{Op: OpTypeReplace, Path: "/servers/0/port", Value: 5432},
+			{Op: OpTypeReplace, Path: "/servers/1/name", Value: "web"},
+			{Op: OpTypeReplace, Path: "/servers/1/port", Value: 81},
+			{Op: OpTypeReplace, Path: "/servers/2/name", Value: "cache"},
+			{Op: OpTypeReplace, Path: "/servers/2/port", Value: 6379},
+		}},
+		{SliceDiffStrategyLCS, JSONPatch{
+			{Op: OpTypeAdd, Path: "/tags/-", Value: "a"},
+			{Op: OpTypeMove, From: "/tags/3", Path: "/tags/0"},
+			{Op: OpTypeRemove, Path: "/servers/1"},
+			{Op: OpTypeRemove, Path: "/servers/0"},
+			{Op: OpTypeAdd, Path: "/servers/-", Value: Server{Name: "web", Port: 81}},
+			{Op: OpTypeAdd, Path: "/servers/-", Value: Server{Name: "cache", Port: 6379}},
+		}},
+		{SliceDiffStrategyKeyed, JSONPatch{
+			{Op: OpTypeAdd, Path: "/tags/-", Value: "a"},
+			{Op: OpTypeMove, From: "/tags/3", Path: "/tags/0"},
+			{Op: OpTypeRemove, Path: "/servers/1"},
+			{Op: OpTypeMove, From: "/servers/1", Path: "/servers/0"},
+			{Op: OpTypeAdd, Path: "/servers/-", Value: Server{Name: "cache", Port: 6379}},
+			{Op: OpTypeReplace, Path: "/servers/1/port", Value: 81},
+		}},
+	}
+	for _, test := range tests {
+		patch, err := DiffWithOptions(a, b, DiffOptions{Slices: test.strategy})
+		if err != nil {
+			t.Fatalf("DiffWithOptions %v error expected nil actual %+v", test.strategy, err)
+		}
+		if !reflect.DeepEqual(patch, test.expected) {
+			t.Errorf("DiffWithOptions %v expected %+v actual %+v", test.strategy, test.expected, patch)
+		}
+		checkSliceDiffPatch(t, string(test.strategy), a, b, patch)
+	}
+
+	// a moved element is moved, not removed and added
+	patch, err := DiffWithOptions(TestObj{Nums: []int{1, 2, 3, 4}}, TestObj{Nums: []int{2, 3, 4, 1}}, DiffOptions{Slices: SliceDiffStrategyLCS})
+	if expected := (JSONPatch{{Op: OpTypeMove, From: "/nums/0", Path: "/nums/3"}}); err != nil || !reflect.DeepEqual(patch, expected) {
+		t.Errorf("DiffWithOptions lcs move expected %+v actual %+v error %+v", expected, patch, err)
+	}
+
+	// DiffOptions.Key keys slices without a patchMergeKey tag
+	a = TestObj{Backups: []*Server{{Name: "x", Port: 1}, {Name: "y", Port: 2}}}
+	b = TestObj{Backups: []*Server{{Name: "y", Port: 3}, {Name: "x", Port: 1}}}
+	patch, err = DiffWithOptions(a, b, DiffOptions{Slices: SliceDiffStrategyKeyed, Key: "name"})
+	expected := JSONPatch{
+		{Op: OpTypeMove, From: "/backups/1", Path: "/backups/0"},
+		{Op: OpTypeReplace, Path: "/backups/0/port", Value: 3},
+	}
+	if err != nil || !reflect.DeepEqual(patch, expected) {
+		t.Errorf("DiffWithOptions keyed option expected %+v actual %+v error %+v", expected, patch, err)
+	}
+	checkSliceDiffPatch(t, "keyed option", a, b, patch)
+
+	if _, err := DiffWithOptions(a, b, DiffOptions{Slices: "nope"}); err == nil {
+		t.Errorf("DiffWithOptions unknown strategy error expected actual nil")
+	}
+}
+
+func TestDiffSliceStrategiesRandom(t *testing.T) {
+	type Server struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Tags     []string  `json:"tags"`
+		Servers  []Server  `json:"servers" patchMergeKey:"name"`
+		Backups  []*Server `json:"backups"`
+		Nums     []int     `json:"nums"`
+		Children []TestObj `json:"children"`
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	randObj := func() TestObj {
+		obj := TestObj{}
+		for i := rnd.Intn(8); i > 0; i-- {
+			obj.Tags = append(obj.Tags, strconv.Itoa(rnd.Intn(5)))
+			obj.Nums = append(obj.Nums, rnd.Intn(4))
+		}
+		names := rnd.Perm(8)[:rnd.Intn(8)]
+		for _, name := range names {
+			obj.Servers = append(obj.Servers, Server{Name: strconv.Itoa(name), Port: rnd.Intn(2)})
+			if rnd.Intn(4) == 0 {
+				obj.Backups = append(obj.Backups, nil)
+			} else {
+				obj.Backups = append(obj.Backups, &Server{Name: strconv.Itoa(rnd.Intn(3)), Port: rnd.Intn(2)})
+			}
+		}
+		if rnd.Intn(2) == 0 {
+			obj.Children = []TestObj{{Nums: obj.Nums, Servers: obj.Servers}}
+		}
+		return obj
+	}
+	for i := 0; i < 300; i++ {
+		a, b := randObj(), randObj()
+		for _, strategy := range []SliceDiffStrategy{SliceDiffStrategyIndex, SliceDiffStrategyLCS, SliceDiffStrategyKeyed} {
+			patch, err := DiffWithOptions(a, b, DiffOptions{Slices: strategy, Key: "name"})
+			if err != nil {
+				t.Fatalf("DiffWithOptions %v error expected nil actual %+v", strategy, err)
+			}
+			checkSliceDiffPatch(t, string(strategy), a, b, patch)
+		}
+	}
+}
+
+// checkSliceDiffPatch checks the patch transforms a into b, with and without Options.InsertOnAdd.
+func checkSliceDiffPatch(t *testing.T, name string, a interface{}, b interface{}, patch JSONPatch) {
+	t.Helper()
+	for _, opts := range []Options{{ShiftOnRemove: true}, StrictOptions()} {
+		obj := reflect.New(reflect.TypeOf(a))
+		obj.Elem().Set(deepCopy(reflect.ValueOf(a)))
+		if err := ApplyWithOptions(patch, obj.Interface(), opts); err != nil {
+			t.Errorf("Apply %v diff %+v error expected nil actual %+v", name, patch, err)
+			continue
+		}
+		if actual := obj.Elem().Interface(); !reflect.DeepEqual(actual, b) {
+			t.Errorf("Apply %v diff %+v of %+v expected %+v actual %+v", name, patch, a, b, actual)
+		}
+	}
+}
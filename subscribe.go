@@ -0,0 +1,258 @@
+package jsonpatch
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// Notification is a change to the subtree of a Document which a Subscription is subscribed to.
+type Notification struct {
+	// Version is the Document version the change produced.
+	Version uint64
+
+	// Ops are the ops of the patch which changed the subtree, with paths relative to the subscription prefix.
+	// Ops which can't be made relative, for example a replace of a parent of the prefix, a move or copy from outside it, or an insert or remove which shifts the slice element at it, are collapsed into a single replace of the whole subtree, or remove if it no longer exists, with the path "".
+	Ops JSONPatch
+
+	// Value is a copy of the subtree after the change, which may be modified. It's nil if Exists is false.
+	// If the subtree has sensitive fields, it's generic JSON values with those fields redacted. See SensitiveTag.
+	Value interface{}
+
+	// Exists is whether the subtree exists after the change.
+	Exists bool
+
+	// Missed is the number of notifications dropped before this one, because the subscriber didn't receive them fast enough.
+	// Value is always the whole subtree, so a subscriber which missed notifications can resynchronize from it.
+	Missed uint64
+}
+
+// Subscription receives Notifications of changes to a subtree of a Document.
+type Subscription struct {
+	// C receives a Notification after each patch which changes the subtree. It's closed by Close.
+	C <-chan Notification
+
+	close     func()
+	closeOnce sync.Once
+}
+
+// Close stops the subscription, and closes C. After it returns, no more notifications are sent.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(s.close)
+}
+
+// Subscribe returns a Subscription to changes to the document at the JSON Pointer prefix, or the whole document if prefix is "".
+// Notifications are buffered up to buffer. Writers never block on subscribers: if the buffer is full, the notification is dropped, and counted in the Missed of the next one.
+// Returns an error if the prefix has a key selector, or a wildcard with Options.Wildcards, because notifications are matched against the paths ops resolve to, which never have them.
+func (d *Document[T]) Subscribe(prefix string, buffer int) (*Subscription, error) {
+	prefixParts, err := ParsePath(prefix)
+	if err != nil {
+		return nil, errors.New("parsing prefix: " + err.Error())
+	}
+	if err := checkSubscribePrefix(reflect.TypeOf((*T)(nil)).Elem(), prefixParts, d.patcher.Options); err != nil {
+		return nil, err
+	}
+	ch := make(chan Notification, buffer)
+	missed := uint64(0)
+	_, id := d.observe(func(change documentChange[T]) {
+		n, ok := newNotification(change, prefixParts, d.patcher.Options)
+		if !ok {
+			return
+		}
+		n.Missed = missed
+		select {
+		case ch <- n:
+			missed = 0
+		default:
+			missed++
+		}
+	})
+	return &Subscription{
+		C:     ch,
+		close: func() { d.unobserve(id, func() { close(ch) }) },
+	}, nil
+}
+
+// SubscribeFunc calls fn with each Notification of changes to the document at the JSON Pointer prefix, in its own goroutine, until the Subscription is closed.
+// Notifications are buffered the same as Subscribe, so a slow fn doesn't block writers. The Subscription C must not be received from.
+func (d *Document[T]) SubscribeFunc(prefix string, buffer int, fn func(Notification)) (*Subscription, error) {
+	sub, err := d.Subscribe(prefix, buffer)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for n := range sub.C {
+			fn(n)
+		}
+	}()
+	return sub, nil
+}
+
+// checkSubscribePrefix returns an error if the prefix in a value of typ has a key selector on a slice or array, or a wildcard with opts.Wildcards.
+// Tokens in interface values are checked as if they may be either, since the type there is unknown.
+func checkSubscribePrefix(typ reflect.Type, prefix []string, opts Options) error {
+	root := typ
+	for _, token := range prefix {
+		for typ != nil && typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		kind := reflect.Interface
+		if typ != nil {
+			kind = typ.Kind()
+		}
+		sliceToken := kind == reflect.Slice || kind == reflect.Array || kind == reflect.Interface
+		if _, _, ok := parseKeySelector(token); ok && sliceToken {
+			return errors.New("prefix " + redactPath(root, prefix) + " has a key selector, which can't be subscribed to, because notifications have the index it selects")
+		}
+		if token == WildcardToken && opts.Wildcards && (sliceToken || kind == reflect.Map) {
+			return errors.New("prefix " + redactPath(root, prefix) + " has a wildcard, which can't be subscribed to, because notifications have the paths it matches")
+		}
+		switch kind {
+		case reflect.Struct:
+			field, ok := getTaggedField(typ, token)
+			if !ok {
+				return nil
+			}
+			typ = field.Type
+		case reflect.Map, reflect.Slice, reflect.Array:
+			typ = typ.Elem()
+		default:
+			typ = nil
+		}
+	}
+	return nil
+}
+
+// newNotification returns the notification of the change for the subscription prefix, or false if the change didn't affect the subtree at prefix.
+// Sensitive values are redacted per the opts.
+func newNotification[T any](change documentChange[T], prefix []string, opts Options) (Notification, bool) {
+	ops := JSONPatch{}
+	collapse := false
+	root := reflect.ValueOf(&change.state.val).Elem()
+	// the resolved ops are matched, so wildcards and key selectors match the paths they changed
+	for _, op := range change.resolved {
+		if shiftsPrefix(root, op, prefix, opts) {
+			collapse = true
+			break
+		}
+		relOp, affected, ok := relativeOp(op, prefix)
+		if !affected {
+			continue
+		}
+		if !ok {
+			collapse = true
+			break
+		}
+		ops = append(ops, relOp)
+	}
+	if !collapse && len(ops) == 0 {
+		return Notification{}, false
+	}
+
+	// the change patch and state are the Document's, so everything given to the subscriber is copied
+	val, exists := getPreviewVal(root, prefix)
+	typ := reflect.TypeOf(&change.state.val).Elem()
+	n := Notification{Version: change.state.version, Value: opts.redact(typ, prefix, val), Exists: exists}
+	switch {
+	case !collapse:
+		n.Ops = deepCopy(reflect.ValueOf(ops)).Interface().(JSONPatch)
+		for i := range n.Ops {
+			if path, err := ParsePath(n.Ops[i].Path); err == nil {
+				n.Ops[i].Value = opts.redact(typ, append(prefix[:len(prefix):len(prefix)], path...), n.Ops[i].Value)
+			}
+		}
+	case exists:
+		n.Ops = JSONPatch{{Op: OpTypeReplace, Path: "", Value: opts.redact(typ, prefix, deepCopy(reflect.ValueOf(val)).Interface())}}
+	default:
+		n.Ops = JSONPatch{{Op: OpTypeRemove, Path: ""}}
+	}
+	return n, true
+}
+
+// shiftsPrefix returns whether op inserts or removes an element of a slice in obj at or before the element on the path of prefix, so a different element is at prefix after it.
+// Removes only shift with opts.ShiftOnRemove, and adds with opts.InsertOnAdd, but moves and copies always do.
+func shiftsPrefix(obj reflect.Value, op JSONPatchOp, prefix []string, opts Options) bool {
+	paths := []string{}
+	switch op.Op {
+	case OpTypeAdd:
+		if opts.InsertOnAdd {
+			paths = append(paths, op.Path)
+		}
+	case OpTypeRemove:
+		if opts.ShiftOnRemove {
+			paths = append(paths, op.Path)
+		}
+	case OpTypeMove:
+		paths = append(paths, op.From, op.Path)
+	case OpTypeCopy:
+		paths = append(paths, op.Path)
+	}
+	for _, p := range paths {
+		path, err := ParsePath(p)
+		if err != nil || len(path) == 0 || len(path) > len(prefix) || !isPathPrefix(path[:len(path)-1], prefix) {
+			continue
+		}
+		i, err := strconv.Atoi(path[len(path)-1])
+		if err != nil {
+			continue // "-" appends, which shifts nothing
+		}
+		if k, err := strconv.Atoi(prefix[len(path)-1]); err != nil || i > k {
+			continue
+		}
+		parent, _, err := getValAt(path[:len(path)-1], obj, false)
+		for err == nil && (parent.Kind() == reflect.Ptr || parent.Kind() == reflect.Interface) && !parent.IsNil() {
+			parent = parent.Elem()
+		}
+		if err == nil && parent.Kind() == reflect.Slice {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeOp returns op with its paths relative to prefix, whether op affects the subtree at prefix, and whether it can be made relative.
+// A move from inside prefix to outside it is made a remove.
+func relativeOp(op JSONPatchOp, prefix []string) (JSONPatchOp, bool, bool) {
+	if op.Op == OpTypeTest {
+		return op, false, false
+	}
+	path, err := ParsePath(op.Path)
+	if err != nil {
+		return op, false, false // the patch was applied, so this can't happen
+	}
+	pathIn := isPathPrefix(prefix, path)
+	pathAbove := !pathIn && isPathPrefix(path, prefix)
+
+	if op.Op != OpTypeMove && op.Op != OpTypeCopy {
+		if pathAbove {
+			return op, true, false
+		}
+		if !pathIn {
+			return op, false, false
+		}
+		op.Path = FormatPath(path[len(prefix):])
+		return op, true, true
+	}
+
+	from, err := ParsePath(op.From)
+	if err != nil {
+		return op, false, false
+	}
+	fromIn := isPathPrefix(prefix, from)
+	fromAbove := !fromIn && isPathPrefix(from, prefix)
+
+	switch {
+	case pathAbove || (op.Op == OpTypeMove && fromAbove):
+		return op, true, false
+	case pathIn && fromIn:
+		op.Path = FormatPath(path[len(prefix):])
+		op.From = FormatPath(from[len(prefix):])
+		return op, true, true
+	case pathIn:
+		return op, true, false // the value came from outside the prefix
+	case fromIn && op.Op == OpTypeMove:
+		return JSONPatchOp{Op: OpTypeRemove, Path: FormatPath(from[len(prefix):])}, true, true
+	}
+	return op, false, false
+}
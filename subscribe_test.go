@@ -0,0 +1,410 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func receiveNotification(t *testing.T, sub *Subscription) Notification {
+	t.Helper()
+	select {
+	case n := <-sub.C:
+		return n
+	case <-time.After(time.Second):
+		t.Fatalf("Subscription expected notification actual none")
+	}
+	return Notification{}
+}
+
+func TestSubscribe(t *testing.T) {
+	type Upstream struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Name      string              `json:"name"`
+		Upstreams map[string]Upstream `json:"upstreams"`
+		Backup    Upstream            `json:"backup"`
+	}
+
+	doc := NewDocument(TestObj{
+		Name:      "web",
+		Upstreams: map[string]Upstream{"a": {Host: "a.example", Port: 80}},
+		Backup:    Upstream{Host: "backup.example", Port: 80},
+	})
+	sub, err := doc.Subscribe("/upstreams", 10)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+	defer sub.Close()
+
+	patches := []JSONPatch{
+		{{Op: OpTypeReplace, Path: "/name", Value: "api"}},
+		{{Op: OpTypeTest, Path: "/upstreams/a/port", Value: 80}, {Op: OpTypeReplace, Path: "/upstreams/a/port", Value: 8080}, {Op: OpTypeReplace, Path: "/name", Value: "web"}},
+		{{Op: OpTypeAdd, Path: "/upstreams/b", Value: Upstream{Host: "b.example"}}},
+		{{Op: OpTypeMove, From: "/upstreams/b", Path: "/backup"}},
+		{{Op: OpTypeCopy, From: "/upstreams/a", Path: "/upstreams/c"}},
+		{{Op: OpTypeCopy, From: "/backup", Path: "/upstreams/d"}},
+		{{Op: OpTypeRemove, Path: "/upstreams"}},
+	}
+	for _, patch := range patches {
+		if _, err := doc.Apply(patch); err != nil {
+			t.Fatalf("Document.Apply %+v error expected nil actual %+v", patch, err)
+		}
+	}
+
+	expected := []Notification{
+		{Version: 2, Ops: JSONPatch{{Op: OpTypeReplace, Path: "/a/port", Value: 8080}}},
+		{Version: 3, Ops: JSONPatch{{Op: OpTypeAdd, Path: "/b", Value: Upstream{Host: "b.example"}}}},
+		{Version: 4, Ops: JSONPatch{{Op: OpTypeRemove, Path: "/b"}}},
+		{Version: 5, Ops: JSONPatch{{Op: OpTypeCopy, From: "/a", Path: "/c"}}},
+		{Version: 6},
+		{Version: 7, Ops: JSONPatch{{Op: OpTypeRemove, Path: ""}}},
+	}
+	for _, exp := range expected {
+		n := receiveNotification(t, sub)
+		if n.Version != exp.Version {
+			t.Errorf("Notification version expected %+v actual %+v", exp.Version, n.Version)
+		}
+		if exp.Ops != nil && !reflect.DeepEqual(n.Ops, exp.Ops) {
+			t.Errorf("Notification version %+v ops expected %+v actual %+v", n.Version, exp.Ops, n.Ops)
+		}
+		snapshot, _ := getPreviewVal(reflect.ValueOf(doc.Snapshot().state.val), []string{"upstreams"})
+		if n.Version == doc.Version() && !reflect.DeepEqual(n.Value, snapshot) {
+			t.Errorf("Notification value expected %+v actual %+v", snapshot, n.Value)
+		}
+		if n.Version == 6 {
+			upstreams := n.Value.(map[string]Upstream)
+			expectedOps := JSONPatch{{Op: OpTypeReplace, Path: "", Value: upstreams}}
+			if !n.Exists || len(upstreams) != 3 || !reflect.DeepEqual(n.Ops, expectedOps) {
+				t.Errorf("Notification copy from outside expected collapsed replace actual %+v", n)
+			}
+			upstreams["modified"] = Upstream{}
+		}
+		if n.Version == 7 && (!n.Exists || n.Value.(map[string]Upstream) != nil) {
+			t.Errorf("Notification removed value field expected nil map actual %+v", n)
+		}
+	}
+
+	select {
+	case n := <-sub.C:
+		t.Errorf("Subscription expected no more notifications actual %+v", n)
+	default:
+	}
+}
+
+func TestSubscribeRoot(t *testing.T) {
+	type Upstream struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Upstreams map[string]Upstream `json:"upstreams"`
+	}
+
+	doc := NewDocument(TestObj{Upstreams: map[string]Upstream{"a": {Host: "a.example", Port: 80}}})
+	sub, err := doc.Subscribe("/upstreams/a", 10)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+	defer sub.Close()
+	all, err := doc.Subscribe("", 10)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+	defer all.Close()
+
+	upstreams := map[string]Upstream{"a": {Host: "new.example"}}
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/upstreams", Value: upstreams}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	n := receiveNotification(t, sub)
+	expectedOps := JSONPatch{{Op: OpTypeReplace, Path: "", Value: Upstream{Host: "new.example"}}}
+	if !reflect.DeepEqual(n.Ops, expectedOps) || n.Value != (Upstream{Host: "new.example"}) {
+		t.Errorf("Notification parent replace expected %+v actual %+v", expectedOps, n)
+	}
+
+	n = receiveNotification(t, all)
+	if len(n.Ops) != 1 || n.Ops[0].Path != "/upstreams" || !reflect.DeepEqual(n.Value, doc.Snapshot().Value()) {
+		t.Errorf("Notification root expected unchanged op actual %+v", n)
+	}
+	n.Ops[0].Value.(map[string]Upstream)["modified"] = Upstream{}
+	if len(doc.Snapshot().Value().Upstreams) != 1 {
+		t.Errorf("Notification ops expected copy, modifying them changed the document")
+	}
+
+	if _, err := doc.Subscribe("no-slash", 1); err == nil {
+		t.Errorf("Document.Subscribe invalid prefix expected error actual nil")
+	}
+}
+
+func TestSubscribeSlow(t *testing.T) {
+	type TestObj struct {
+		Name string `json:"name"`
+	}
+
+	doc := NewDocument(TestObj{Name: "web"})
+	sub, err := doc.Subscribe("/name", 2)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+
+	names := []string{"a", "b", "c", "d", "e"}
+	for _, name := range names {
+		if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: name}}); err != nil {
+			t.Fatalf("Document.Apply error expected nil actual %+v", err)
+		}
+	}
+
+	if n := receiveNotification(t, sub); n.Version != 1 || n.Missed != 0 {
+		t.Errorf("Notification expected version 1 actual %+v", n)
+	}
+	if n := receiveNotification(t, sub); n.Version != 2 || n.Missed != 0 {
+		t.Errorf("Notification expected version 2 actual %+v", n)
+	}
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "f"}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	if n := receiveNotification(t, sub); n.Version != 6 || n.Missed != 3 || n.Value != "f" {
+		t.Errorf("Notification after dropped expected version 6 missed 3 actual %+v", n)
+	}
+
+	sub.Close()
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Errorf("Subscription.Close expected closed channel")
+	}
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "g"}}); err != nil {
+		t.Errorf("Document.Apply after Close error expected nil actual %+v", err)
+	}
+}
+
+func TestSubscribeFunc(t *testing.T) {
+	type Backup struct {
+		Port int `json:"port"`
+	}
+	type TestObj struct {
+		Backup Backup `json:"backup"`
+	}
+
+	doc := NewDocument(TestObj{Backup: Backup{Port: 80}})
+	received := make(chan Notification)
+	sub, err := doc.SubscribeFunc("/backup/port", 10, func(n Notification) { received <- n })
+	if err != nil {
+		t.Fatalf("Document.SubscribeFunc error expected nil actual %+v", err)
+	}
+	defer sub.Close()
+
+	for i := 1; i <= 3; i++ {
+		if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/backup/port", Value: i}}); err != nil {
+			t.Fatalf("Document.Apply error expected nil actual %+v", err)
+		}
+	}
+	for i := 1; i <= 3; i++ {
+		select {
+		case n := <-received:
+			if n.Value != i {
+				t.Errorf("SubscribeFunc notification expected %+v actual %+v", i, n.Value)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("SubscribeFunc expected notification actual none")
+		}
+	}
+}
+
+func TestSubscribeDeepPrefix(t *testing.T) {
+	type Upstream struct {
+		Host string `json:"host"`
+	}
+	type TestObj struct {
+		Name      string              `json:"name"`
+		Upstreams map[string]Upstream `json:"upstreams"`
+	}
+
+	doc := NewDocument(TestObj{Name: "web", Upstreams: map[string]Upstream{"a": {Host: "a.example"}}})
+	sub, err := doc.Subscribe("/upstreams/a/host", 10)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+	defer sub.Close()
+
+	// a path shorter than the prefix, and not above it, doesn't affect the subtree
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: "api"}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/upstreams/a/host", Value: "b.example"}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	n := receiveNotification(t, sub)
+	expected := Notification{Version: 2, Ops: JSONPatch{{Op: OpTypeReplace, Path: "", Value: "b.example"}}, Value: "b.example", Exists: true}
+	if !reflect.DeepEqual(n, expected) {
+		t.Errorf("Subscription notification expected %+v actual %+v", expected, n)
+	}
+}
+
+func TestSubscribeWildcard(t *testing.T) {
+	type Server struct {
+		Enabled bool `json:"enabled"`
+	}
+	type TestObj struct {
+		Servers []Server `json:"servers"`
+	}
+
+	doc := NewDocumentWithPatcher(TestObj{Servers: []Server{{}, {}}}, &Patcher{Options: Options{Wildcards: true}})
+	sub, err := doc.Subscribe("/servers/1", 10)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+	defer sub.Close()
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/servers/*/enabled", Value: true}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	n := receiveNotification(t, sub)
+	expected := Notification{Version: 1, Ops: JSONPatch{{Op: OpTypeReplace, Path: "/enabled", Value: true}}, Value: Server{Enabled: true}, Exists: true}
+	if !reflect.DeepEqual(n, expected) {
+		t.Errorf("Subscription notification expected %+v actual %+v", expected, n)
+	}
+}
+
+func TestSubscribeKeySelector(t *testing.T) {
+	type Server struct {
+		Name string `json:"name"`
+		Port int    `json:"port"`
+	}
+	type TestObj struct {
+		Servers []Server `json:"servers"`
+	}
+
+	doc := NewDocument(TestObj{Servers: []Server{{Name: "web", Port: 80}, {Name: "db", Port: 5432}}})
+	sub, err := doc.Subscribe("/servers/1", 10)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+	defer sub.Close()
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/servers/[name=web]/port", Value: 8080}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/servers/[name=db]/port", Value: 5433}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	n := receiveNotification(t, sub)
+	expected := Notification{Version: 2, Ops: JSONPatch{{Op: OpTypeReplace, Path: "/port", Value: 5433}}, Value: Server{Name: "db", Port: 5433}, Exists: true}
+	if !reflect.DeepEqual(n, expected) {
+		t.Errorf("Subscription notification expected %+v actual %+v", expected, n)
+	}
+}
+
+func TestSubscribeShift(t *testing.T) {
+	type Item struct {
+		Name string `json:"name"`
+	}
+	type TestObj struct {
+		Items []Item          `json:"items"`
+		Named map[string]Item `json:"named"`
+	}
+
+	doc := NewDocumentWithPatcher(TestObj{
+		Items: []Item{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+		Named: map[string]Item{"0": {Name: "x"}, "1": {Name: "y"}},
+	}, &Patcher{Options: StrictOptions()})
+	sub, err := doc.Subscribe("/items/1", 10)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+	defer sub.Close()
+	deep, err := doc.Subscribe("/items/1/name", 10)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+	defer deep.Close()
+	named, err := doc.Subscribe("/named/1", 10)
+	if err != nil {
+		t.Fatalf("Document.Subscribe error expected nil actual %+v", err)
+	}
+	defer named.Close()
+
+	patches := []JSONPatch{
+		{{Op: OpTypeRemove, Path: "/items/0"}},
+		{{Op: OpTypeAdd, Path: "/items/1", Value: Item{Name: "d"}}},
+		{{Op: OpTypeMove, From: "/items/2", Path: "/items/0"}},
+		{{Op: OpTypeAdd, Path: "/items/-", Value: Item{Name: "e"}}},
+		{{Op: OpTypeRemove, Path: "/items/3"}},
+		{{Op: OpTypeRemove, Path: "/named/0"}},
+	}
+	for _, patch := range patches {
+		if _, err := doc.Apply(patch); err != nil {
+			t.Fatalf("Document.Apply %+v error expected nil actual %+v", patch, err)
+		}
+	}
+
+	// items are [b c] after the remove, [b d c] after the add, and [c b d] after the move, and appends and later removes don't shift them
+	expected := []Notification{
+		{Version: 1, Ops: JSONPatch{{Op: OpTypeReplace, Path: "", Value: Item{Name: "c"}}}, Value: Item{Name: "c"}, Exists: true},
+		{Version: 2, Ops: JSONPatch{{Op: OpTypeReplace, Path: "", Value: Item{Name: "d"}}}, Value: Item{Name: "d"}, Exists: true},
+		{Version: 3, Ops: JSONPatch{{Op: OpTypeReplace, Path: "", Value: Item{Name: "b"}}}, Value: Item{Name: "b"}, Exists: true},
+	}
+	for _, exp := range expected {
+		if n := receiveNotification(t, sub); !reflect.DeepEqual(n, exp) {
+			t.Errorf("Subscription notification expected %+v actual %+v", exp, n)
+		}
+		exp.Ops[0].Value = exp.Value.(Item).Name
+		exp.Value = exp.Value.(Item).Name
+		if n := receiveNotification(t, deep); !reflect.DeepEqual(n, exp) {
+			t.Errorf("Subscription deep notification expected %+v actual %+v", exp, n)
+		}
+	}
+	select {
+	case n := <-sub.C:
+		t.Errorf("Subscription expected no more notifications actual %+v", n)
+	case n := <-named.C:
+		t.Errorf("Subscription map key expected no notifications actual %+v", n)
+	default:
+	}
+}
+
+func TestSubscribePrefixErrors(t *testing.T) {
+	type Server struct {
+		Name string `json:"name"`
+	}
+	type TestObj struct {
+		Servers []Server          `json:"servers"`
+		Named   map[string]Server `json:"named"`
+		Any     interface{}       `json:"any"`
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		opts   Options
+		errStr string
+	}{
+		{"key selector", "/servers/[name=web]", Options{}, "has a key selector"},
+		{"nested key selector", "/servers/[name=web]/name", Options{}, "has a key selector"},
+		{"interface key selector", "/any/[name=web]", Options{}, "has a key selector"},
+		{"wildcard", "/servers/*/name", Options{Wildcards: true}, "has a wildcard"},
+		{"map wildcard", "/named/*", Options{Wildcards: true}, "has a wildcard"},
+		{"literal wildcard", "/named/*", Options{}, ""},
+		{"map key", "/named/[name=web]", Options{}, ""},
+		{"index", "/servers/0/name", Options{Wildcards: true}, ""},
+	}
+	for _, test := range tests {
+		doc := NewDocumentWithPatcher(TestObj{}, &Patcher{Options: test.opts})
+		sub, err := doc.Subscribe(test.prefix, 1)
+		if test.errStr == "" {
+			if err != nil {
+				t.Errorf("Document.Subscribe %v error expected nil actual %+v", test.name, err)
+			} else {
+				sub.Close()
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("Document.Subscribe %v error expected '%v' actual %+v", test.name, test.errStr, err)
+		}
+		if _, err := doc.SubscribeFunc(test.prefix, 1, func(Notification) {}); err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("Document.SubscribeFunc %v error expected '%v' actual %+v", test.name, test.errStr, err)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package jsonpatch
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SyncMessageType is the type of a SyncMessage.
+type SyncMessageType string
+
+const (
+	// SyncMessageTypeSnapshot is a message with the whole document, which replaces the client's mirror.
+	SyncMessageTypeSnapshot = "snapshot"
+	// SyncMessageTypePatch is a message with a patch, which the client applies to its mirror at the previous version.
+	SyncMessageTypePatch = "patch"
+)
+
+// SyncMessage is a message sent by SyncServer to a client. A patch message produces Version from Version-1.
+type SyncMessage struct {
+	Type    SyncMessageType `json:"type"`
+	Version uint64          `json:"version"`
+	Patch   JSONPatch       `json:"patch,omitempty"`
+	Value   interface{}     `json:"value,omitempty"`
+}
+
+// DefaultSyncBuffer is the number of changes buffered for each SyncServer client, if SyncServer.Buffer is 0.
+const DefaultSyncBuffer = 64
+
+// SyncServer is an http.Handler which streams the changes to a Document to clients, so they can keep a mirror of it, over Server-Sent Events, or WebSocket if the request is a WebSocket upgrade.
+//
+// Each message is a JSON SyncMessage. A client first gets a snapshot of the document, then a patch for each change.
+// A client which reconnects with the version it has, in the SSE Last-Event-ID header or the version query parameter, gets the patches since then from the History instead, if it has them.
+// A client which falls behind by more than Buffer changes gets a new snapshot, so a slow client never blocks writers.
+//
+// For SSE, the event id is the version, and the event type is the message type.
+type SyncServer[T any] struct {
+	// History, if not nil, is used to send a reconnecting client the patches it missed, instead of a snapshot.
+	History *History[T]
+
+	// Buffer is the number of changes buffered for each client. If it's 0, DefaultSyncBuffer is used.
+	Buffer int
+
+	// KeepAlive, if not 0, is the interval to send SSE comments or WebSocket pings when there are no changes, to keep proxies from closing idle connections.
+	KeepAlive time.Duration
+
+	doc       *Document[T]
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSyncServer returns a SyncServer which streams the changes to doc.
+func NewSyncServer[T any](doc *Document[T]) *SyncServer[T] {
+	return &SyncServer[T]{doc: doc, done: make(chan struct{})}
+}
+
+// Close ends all client streams, and makes new requests return 503 Service Unavailable.
+func (s *SyncServer[T]) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// syncConn is a connection to a client, over which SyncMessages are sent.
+type syncConn interface {
+	send(msg SyncMessage) error
+	keepAlive() error
+	// closed is closed when the client disconnects.
+	closed() <-chan struct{}
+}
+
+func (s *SyncServer[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-s.done:
+		http.Error(w, "sync server closed", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	clientVersion, hasVersion, err := getSyncClientVersion(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn := syncConn(nil)
+	if isWebSocketUpgrade(r) {
+		wsConn, err := upgradeWebSocket(w, r)
+		if err != nil {
+			return // the error was written to the client, or the hijacked connection was closed
+		}
+		defer wsConn.close()
+		conn = wsConn
+	} else {
+		sseConn, err := newSSEConn(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		conn = sseConn
+	}
+	s.stream(conn, clientVersion, hasVersion)
+}
+
+// getSyncClientVersion returns the version the client has, from the Last-Event-ID header or version query parameter, and whether it has one.
+func getSyncClientVersion(r *http.Request) (uint64, bool, error) {
+	versionStr := r.Header.Get("Last-Event-ID")
+	if versionStr == "" {
+		versionStr = r.URL.Query().Get("version")
+	}
+	if versionStr == "" {
+		return 0, false, nil
+	}
+	version, err := strconv.ParseUint(versionStr, 10, 64)
+	if err != nil {
+		return 0, false, errors.New("malformed version '" + versionStr + "'")
+	}
+	return version, true, nil
+}
+
+// stream sends the client the document changes, until the client disconnects or the server is closed.
+func (s *SyncServer[T]) stream(conn syncConn, clientVersion uint64, hasVersion bool) {
+	buffer := s.Buffer
+	if buffer == 0 {
+		buffer = DefaultSyncBuffer
+	}
+	changes := make(chan documentChange[T], buffer)
+	lagged := int32(0)
+
+	state, id := s.doc.observe(func(change documentChange[T]) {
+		select {
+		case changes <- change:
+		default:
+			atomic.StoreInt32(&lagged, 1)
+		}
+	})
+	defer s.doc.unobserve(id, nil)
+
+	version, err := s.catchUp(conn, state, clientVersion, hasVersion)
+	if err != nil {
+		return
+	}
+
+	keepAlive := (<-chan time.Time)(nil)
+	if s.KeepAlive > 0 {
+		ticker := time.NewTicker(s.KeepAlive)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-conn.closed():
+			return
+		case <-keepAlive:
+			if err := conn.keepAlive(); err != nil {
+				return
+			}
+		case change := <-changes:
+			if atomic.SwapInt32(&lagged, 0) == 1 {
+				snapshot := s.doc.Snapshot().state
+				if err := conn.send(SyncMessage{Type: SyncMessageTypeSnapshot, Version: snapshot.version, Value: snapshot.val}); err != nil {
+					return
+				}
+				version = snapshot.version
+			}
+			if change.state.version <= version {
+				continue // already in the snapshot
+			}
+			if err := conn.send(SyncMessage{Type: SyncMessageTypePatch, Version: change.state.version, Patch: change.patch}); err != nil {
+				return
+			}
+			version = change.state.version
+		}
+	}
+}
+
+// catchUp sends the client the document at state, as the patches since clientVersion if the History has them, or else a snapshot.
+// Returns the version the client is at.
+func (s *SyncServer[T]) catchUp(conn syncConn, state *documentState[T], clientVersion uint64, hasVersion bool) (uint64, error) {
+	if hasVersion && clientVersion == state.version {
+		return state.version, nil
+	}
+	if hasVersion && s.History != nil && clientVersion < state.version {
+		if entries, err := s.History.Entries(clientVersion, state.version); err == nil {
+			for _, entry := range entries {
+				if err := conn.send(SyncMessage{Type: SyncMessageTypePatch, Version: entry.Version, Patch: entry.Patch}); err != nil {
+					return 0, err
+				}
+			}
+			return state.version, nil
+		}
+	}
+	if err := conn.send(SyncMessage{Type: SyncMessageTypeSnapshot, Version: state.version, Value: state.val}); err != nil {
+		return 0, err
+	}
+	return state.version, nil
+}
+
+// sseConn sends SyncMessages as Server-Sent Events.
+type sseConn struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	done    <-chan struct{}
+}
+
+func newSSEConn(w http.ResponseWriter, r *http.Request) (*sseConn, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("response writer doesn't support flushing, which is required for server-sent events")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &sseConn{w: w, flusher: flusher, done: r.Context().Done()}, nil
+}
+
+func (c *sseConn) send(msg SyncMessage) error {
+	bts, err := json.Marshal(msg)
+	if err != nil {
+		return errors.New("encoding sync message: " + err.Error())
+	}
+	// JSON has no literal newlines, so the data is always one line
+	if _, err := io.WriteString(c.w, "id: "+strconv.FormatUint(msg.Version, 10)+"\nevent: "+string(msg.Type)+"\ndata: "+string(bts)+"\n\n"); err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+func (c *sseConn) keepAlive() error {
+	if _, err := io.WriteString(c.w, ": keepalive\n\n"); err != nil {
+		return err
+	}
+	c.flusher.Flush()
+	return nil
+}
+
+func (c *sseConn) closed() <-chan struct{} {
+	return c.done
+}
+
+// webSocketGUID is the GUID appended to the client key to compute the accept key, per RFC6455§1.3.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes, per RFC6455§5.2.
+const (
+	webSocketOpText  = 0x1
+	webSocketOpClose = 0x8
+	webSocketOpPing  = 0x9
+	webSocketOpPong  = 0xA
+)
+
+// maxWebSocketControlPayload is the maximum payload of a control frame, per RFC6455§5.5.
+const maxWebSocketControlPayload = 125
+
+// webSocketConn sends SyncMessages as WebSocket text frames.
+// It only implements the server side of RFC 6455 which SyncServer needs: it sends unfragmented text frames, answers pings and closes, and discards messages from the client.
+type webSocketConn struct {
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+	writeMu sync.Mutex
+	done    chan struct{}
+}
+
+// isWebSocketUpgrade returns whether the request is a WebSocket opening handshake.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+// headerHasToken returns whether the comma-separated header contains the token, case-insensitively.
+func headerHasToken(header http.Header, name string, token string) bool {
+	for _, val := range header.Values(name) {
+		for _, part := range strings.Split(val, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkWebSocketUpgrade returns an error if the WebSocket opening handshake request is invalid, per RFC6455§4.2.1.
+func checkWebSocketUpgrade(r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return errors.New("websocket upgrade must be a GET")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return errors.New("unsupported websocket version '" + r.Header.Get("Sec-WebSocket-Version") + "'")
+	}
+	if r.Header.Get("Sec-WebSocket-Key") == "" {
+		return errors.New("missing Sec-WebSocket-Key")
+	}
+	return nil
+}
+
+// upgradeWebSocket completes the WebSocket opening handshake, per RFC6455§4.2, and returns the connection.
+// If the handshake fails before the connection is hijacked, the error is written to w. After, w can't be written, so the connection is closed.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*webSocketConn, error) {
+	if err := checkWebSocketUpgrade(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, err
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		err := errors.New("response writer doesn't support hijacking, which is required for websockets")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		err = errors.New("hijacking connection: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	accept := base64.StdEncoding.EncodeToString(sum[:])
+	if _, err := rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + accept + "\r\n\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &webSocketConn{conn: conn, rw: rw, done: make(chan struct{})}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *webSocketConn) send(msg SyncMessage) error {
+	bts, err := json.Marshal(msg)
+	if err != nil {
+		return errors.New("encoding sync message: " + err.Error())
+	}
+	return c.writeFrame(webSocketOpText, bts)
+}
+
+func (c *webSocketConn) keepAlive() error {
+	return c.writeFrame(webSocketOpPing, nil)
+}
+
+func (c *webSocketConn) closed() <-chan struct{} {
+	return c.done
+}
+
+// close sends a close frame, if the client hasn't closed, and closes the connection.
+func (c *webSocketConn) close() {
+	select {
+	case <-c.done:
+	default:
+		c.writeFrame(webSocketOpClose, nil)
+	}
+	c.conn.Close()
+}
+
+// writeFrame writes a single unmasked frame with the FIN bit set, per RFC6455§5.2. Servers must not mask frames.
+func (c *webSocketConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) <= 125:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// readLoop reads frames from the client until it closes or the connection fails, answering pings and closes, and closes done.
+func (c *webSocketConn) readLoop() {
+	defer close(c.done)
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case webSocketOpClose:
+			c.writeFrame(webSocketOpClose, payload)
+			return
+		case webSocketOpPing:
+			if c.writeFrame(webSocketOpPong, payload) != nil {
+				return
+			}
+		}
+	}
+}
+
+// readFrame reads a frame from the client, which must be masked, per RFC6455§5.1, and returns its opcode and unmasked payload.
+// Only control frame payloads are kept, because the server ignores messages from the client.
+func (c *webSocketConn) readFrame() (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.rw, header); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		return 0, nil, errors.New("client websocket frame isn't masked")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(c.rw, ext); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(c.rw, ext); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(c.rw, mask); err != nil {
+		return 0, nil, err
+	}
+
+	if opcode < webSocketOpClose {
+		_, err := io.CopyN(io.Discard, c.rw, int64(length))
+		return opcode, nil, err
+	}
+	if length > maxWebSocketControlPayload {
+		return 0, nil, errors.New("websocket control frame too large")
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
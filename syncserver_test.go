@@ -0,0 +1,390 @@
+package jsonpatch
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSSEEvent is a server-sent event, with the data decoded as a SyncMessage.
+type testSSEEvent struct {
+	ID    string
+	Event string
+	Msg   testSyncMessage
+}
+
+// testSyncMessage is a SyncMessage decoded by a client, with the value decoded as generic JSON.
+type testSyncMessage struct {
+	Type    SyncMessageType          `json:"type"`
+	Version uint64                   `json:"version"`
+	Patch   []map[string]interface{} `json:"patch"`
+	Value   interface{}              `json:"value"`
+}
+
+func readSSEEvent(t *testing.T, r *bufio.Reader) testSSEEvent {
+	t.Helper()
+	ev := testSSEEvent{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading server-sent event error expected nil actual %+v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if ev.Event == "" {
+				continue // keepalive comment
+			}
+			return ev
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "id: "):
+			ev.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.Msg); err != nil {
+				t.Fatalf("decoding server-sent event data error expected nil actual %+v", err)
+			}
+		default:
+			t.Fatalf("server-sent event unexpected line '%+v'", line)
+		}
+	}
+}
+
+func connectSSE(t *testing.T, url string, lastEventID string) (*bufio.Reader, func()) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("creating request error expected nil actual %+v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("SyncServer request error expected nil actual %+v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("SyncServer Content-Type expected text/event-stream actual %+v", ct)
+	}
+	return bufio.NewReader(resp.Body), func() { resp.Body.Close() }
+}
+
+func TestSyncServerSSE(t *testing.T) {
+	type TestObj struct {
+		Name  string         `json:"name"`
+		Tags  []string       `json:"tags"`
+		Ports map[string]int `json:"ports"`
+	}
+
+	doc := NewDocument(TestObj{Name: "web", Ports: map[string]int{"http": 80}})
+	hist := NewHistory(doc, 0)
+	syncServer := NewSyncServer(doc)
+	syncServer.History = hist
+	server := httptest.NewServer(syncServer)
+	defer server.Close()
+	defer syncServer.Close()
+
+	events, closeEvents := connectSSE(t, server.URL, "")
+	ev := readSSEEvent(t, events)
+	if ev.Event != SyncMessageTypeSnapshot || ev.ID != "0" || ev.Msg.Version != 0 || !reflect.DeepEqual(ev.Msg.Value, jsonRoundTrip(t, doc.Snapshot().Value())) {
+		t.Errorf("SyncServer first event expected snapshot actual %+v", ev)
+	}
+
+	patches := []JSONPatch{
+		{{Op: OpTypeReplace, Path: "/name", Value: "api"}},
+		{{Op: OpTypeAdd, Path: "/ports/https", Value: 443}},
+		{{Op: OpTypeAdd, Path: "/tags", Value: []string{"a"}}},
+	}
+	for _, patch := range patches {
+		if _, err := doc.Apply(patch); err != nil {
+			t.Fatalf("Document.Apply error expected nil actual %+v", err)
+		}
+	}
+	for i, patch := range patches {
+		ev := readSSEEvent(t, events)
+		expected := []map[string]interface{}{{"op": string(patch[0].Op), "path": patch[0].Path, "value": jsonRoundTrip(t, patch[0].Value)}}
+		if ev.Event != SyncMessageTypePatch || ev.Msg.Version != uint64(i+1) || !reflect.DeepEqual(ev.Msg.Patch, expected) {
+			t.Errorf("SyncServer patch event expected %+v actual %+v", expected, ev)
+		}
+	}
+	closeEvents()
+
+	// reconnecting with a version in the history gets the patches since then
+	events, closeEvents = connectSSE(t, server.URL, "1")
+	for _, version := range []uint64{2, 3} {
+		if ev := readSSEEvent(t, events); ev.Event != SyncMessageTypePatch || ev.Msg.Version != version {
+			t.Errorf("SyncServer reconnect expected patch version %+v actual %+v", version, ev)
+		}
+	}
+	closeEvents()
+
+	// reconnecting with an unknown version gets a snapshot
+	events, closeEvents = connectSSE(t, server.URL+"?version=99", "")
+	if ev := readSSEEvent(t, events); ev.Event != SyncMessageTypeSnapshot || ev.Msg.Version != 3 || !reflect.DeepEqual(ev.Msg.Value, jsonRoundTrip(t, doc.Snapshot().Value())) {
+		t.Errorf("SyncServer unknown version expected snapshot actual %+v", ev)
+	}
+	closeEvents()
+
+	resp, err := http.Get(server.URL + "?version=abc")
+	if err != nil {
+		t.Fatalf("SyncServer request error expected nil actual %+v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("SyncServer malformed version expected %+v actual %+v", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func jsonRoundTrip(t *testing.T, val interface{}) interface{} {
+	t.Helper()
+	bts, err := json.Marshal(val)
+	if err != nil {
+		t.Fatalf("json.Marshal error expected nil actual %+v", err)
+	}
+	decoded := interface{}(nil)
+	if err := json.Unmarshal(bts, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal error expected nil actual %+v", err)
+	}
+	return decoded
+}
+
+// testSyncConn is a syncConn which blocks sending until the test receives the message.
+type testSyncConn struct {
+	msgs chan SyncMessage
+	done chan struct{}
+}
+
+func (c *testSyncConn) send(msg SyncMessage) error {
+	c.msgs <- msg
+	return nil
+}
+func (c *testSyncConn) keepAlive() error        { return nil }
+func (c *testSyncConn) closed() <-chan struct{} { return c.done }
+
+func TestSyncServerLagging(t *testing.T) {
+	type TestObj struct {
+		Count int `json:"count"`
+	}
+
+	doc := NewDocument(TestObj{})
+	syncServer := NewSyncServer(doc)
+	syncServer.Buffer = 2
+	conn := &testSyncConn{msgs: make(chan SyncMessage), done: make(chan struct{})}
+	streamDone := make(chan struct{})
+	go func() {
+		syncServer.stream(conn, 0, true)
+		close(streamDone)
+	}()
+
+	// wait for the stream to observe the document, so the changes are sent to it
+	for {
+		doc.writeMu.Lock()
+		observing := len(doc.observers) > 0
+		doc.writeMu.Unlock()
+		if observing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the test doesn't receive until all the changes are applied, so they fill the buffer and are dropped
+	for i := 1; i <= 6; i++ {
+		if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/count", Value: i}}); err != nil {
+			t.Fatalf("Document.Apply error expected nil actual %+v", err)
+		}
+	}
+
+	msgs := []SyncMessage{}
+	for len(msgs) == 0 || msgs[len(msgs)-1].Version != 6 {
+		select {
+		case msg := <-conn.msgs:
+			msgs = append(msgs, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("SyncServer lagging expected messages to version 6 actual %+v", msgs)
+		}
+	}
+	if len(msgs) >= 6 {
+		t.Errorf("SyncServer lagging expected dropped patches actual %+v", msgs)
+	}
+	last := msgs[len(msgs)-1]
+	if last.Type != SyncMessageTypeSnapshot || last.Value.(TestObj).Count != 6 {
+		t.Errorf("SyncServer lagging expected snapshot version 6 actual %+v", msgs)
+	}
+	for i := 1; i < len(msgs); i++ {
+		if msgs[i].Version <= msgs[i-1].Version {
+			t.Errorf("SyncServer lagging expected increasing versions actual %+v", msgs)
+		}
+	}
+
+	close(conn.done)
+	<-streamDone
+	if len(doc.observers) != 0 {
+		t.Errorf("SyncServer stream end expected no observers actual %+v", len(doc.observers))
+	}
+}
+
+func TestSyncServerWebSocket(t *testing.T) {
+	type TestObj struct {
+		Name string `json:"name"`
+	}
+
+	doc := NewDocument(TestObj{Name: "web"})
+	syncServer := NewSyncServer(doc)
+	server := httptest.NewServer(syncServer)
+	defer server.Close()
+	defer syncServer.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dialing error expected nil actual %+v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// the key and accept are the example from RFC6455§1.3
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatalf("reading handshake error expected nil actual %+v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("WebSocket handshake expected 101 with accept actual %+v %+v", resp.StatusCode, resp.Header)
+	}
+
+	msg := testSyncMessage{}
+	opcode, payload := readTestWebSocketFrame(t, r)
+	if err := json.Unmarshal(payload, &msg); err != nil || opcode != webSocketOpText {
+		t.Fatalf("WebSocket first frame expected text actual %+v %+v", opcode, err)
+	}
+	if msg.Type != SyncMessageTypeSnapshot || !reflect.DeepEqual(msg.Value, map[string]interface{}{"name": "web"}) {
+		t.Errorf("WebSocket first message expected snapshot actual %+v", msg)
+	}
+
+	// a large patch, to test the extended payload length
+	name := strings.Repeat("n", 70000)
+	if _, err := doc.Apply(JSONPatch{{Op: OpTypeReplace, Path: "/name", Value: name}}); err != nil {
+		t.Fatalf("Document.Apply error expected nil actual %+v", err)
+	}
+	msg = testSyncMessage{}
+	_, payload = readTestWebSocketFrame(t, r)
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		t.Fatalf("WebSocket patch frame error expected nil actual %+v", err)
+	}
+	if msg.Type != SyncMessageTypePatch || msg.Version != 1 || len(msg.Patch) != 1 || msg.Patch[0]["value"] != name {
+		t.Errorf("WebSocket patch message expected version 1 actual %+v %+v", msg.Type, msg.Version)
+	}
+
+	writeTestWebSocketFrame(t, conn, webSocketOpPing, []byte("hi"))
+	if opcode, payload := readTestWebSocketFrame(t, r); opcode != webSocketOpPong || string(payload) != "hi" {
+		t.Errorf("WebSocket ping expected pong 'hi' actual %+v '%+v'", opcode, string(payload))
+	}
+	writeTestWebSocketFrame(t, conn, webSocketOpClose, nil)
+	if opcode, _ := readTestWebSocketFrame(t, r); opcode != webSocketOpClose {
+		t.Errorf("WebSocket close expected close actual %+v", opcode)
+	}
+}
+
+func readTestWebSocketFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatalf("reading frame error expected nil actual %+v", err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		t.Fatalf("WebSocket frame expected final and unmasked actual %x", header)
+	}
+	length := uint64(header[1])
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		io.ReadFull(r, ext)
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		io.ReadFull(r, ext)
+		length = binary.BigEndian.Uint64(ext)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("reading frame payload error expected nil actual %+v", err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+func writeTestWebSocketFrame(t *testing.T, w io.Writer, opcode byte, payload []byte) {
+	t.Helper()
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := w.Write(frame); err != nil {
+		t.Fatalf("writing frame error expected nil actual %+v", err)
+	}
+}
+
+// testHijackWriter is a ResponseWriter whose hijacked connection can't be written, which records writes to it after it's hijacked.
+type testHijackWriter struct {
+	*httptest.ResponseRecorder
+	hijacked         bool
+	writeAfterHijack bool
+}
+
+func (w *testHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	client, server := net.Pipe()
+	client.Close()
+	return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+}
+
+func (w *testHijackWriter) WriteHeader(code int) {
+	w.writeAfterHijack = w.writeAfterHijack || w.hijacked
+	w.ResponseRecorder.WriteHeader(code)
+}
+
+func (w *testHijackWriter) Write(b []byte) (int, error) {
+	w.writeAfterHijack = w.writeAfterHijack || w.hijacked
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestSyncServerWebSocketHandshakeErrors(t *testing.T) {
+	type TestObj struct {
+		Name string `json:"name"`
+	}
+
+	syncServer := NewSyncServer(NewDocument(TestObj{Name: "web"}))
+	defer syncServer.Close()
+	newRequest := func(version string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		r.Header.Set("Sec-WebSocket-Version", version)
+		return r
+	}
+
+	// an invalid handshake is reported before hijacking
+	w := &testHijackWriter{ResponseRecorder: httptest.NewRecorder()}
+	syncServer.ServeHTTP(w, newRequest("8"))
+	if w.hijacked || w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unsupported websocket version") {
+		t.Errorf("SyncServer invalid handshake expected %+v before hijacking actual %+v %+v hijacked %+v", http.StatusBadRequest, w.Code, w.Body.String(), w.hijacked)
+	}
+
+	// a handshake which fails after hijacking closes the connection, without writing the response
+	w = &testHijackWriter{ResponseRecorder: httptest.NewRecorder()}
+	syncServer.ServeHTTP(w, newRequest("13"))
+	if !w.hijacked || w.writeAfterHijack {
+		t.Errorf("SyncServer failed handshake expected hijacked without writes actual hijacked %+v writes %+v", w.hijacked, w.writeAfterHijack)
+	}
+}
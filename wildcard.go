@@ -0,0 +1,178 @@
+package jsonpatch
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// WildcardToken is the path token which matches every element of a slice or array, or value of a map, if Options.Wildcards is set.
+const WildcardToken = "*"
+
+// hasWildcard returns whether any of the paths has a WildcardToken.
+func hasWildcard(paths ...[]string) bool {
+	for _, path := range paths {
+		for _, token := range path {
+			if token == WildcardToken {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyWildcard applies patchOp to every path matching its wildcard path, or none of them if any fails.
+// Returns an error if nothing matches, or if patchOp isn't an add, replace, remove, or test op.
+func (p *Patcher) applyWildcard(obj reflect.Value, patchOp JSONPatchOp, path []string, fromPath []string) error {
+	// apply to a copy first, so the fan-out is atomic. Test ops don't modify the object, so they don't need a copy
+	targets := []reflect.Value{obj}
+	if patchOp.Op != OpTypeTest {
+		cp := reflect.New(obj.Type()).Elem()
+		cp.Set(deepCopy(obj))
+		targets = []reflect.Value{cp, obj}
+	}
+	for _, target := range targets {
+		matchOps, err := p.expandWildcardOps(target, patchOp, path, fromPath)
+		if err != nil {
+			return err
+		}
+		for _, matchOp := range matchOps {
+			matchPath, err := ParsePath(matchOp.Path)
+			if err == nil {
+				err = p.applyParsedOp(target, matchOp, matchPath, fromPath)
+			}
+			if err != nil {
+				return wildcardMatchError(obj.Type(), patchOp, matchOp, err)
+			}
+		}
+	}
+	return nil
+}
+
+// wildcardMatchError returns the error of applying matchOp, which is a match of the wildcard patchOp in a value of typ.
+func wildcardMatchError(typ reflect.Type, patchOp JSONPatchOp, matchOp JSONPatchOp, err error) error {
+	return fmt.Errorf("wildcard path '%v' match '%v': %v", redactPathString(typ, patchOp.Path), redactPathString(typ, matchOp.Path), err)
+}
+
+// expandOpWildcards returns the ops which apply patchOp to each path matching its wildcard path in obj, in the order they're applied, or patchOp itself if it has no wildcard or Options.Wildcards isn't set.
+// Features which read op paths, like Preview and Document notifications, expand wildcards first, so they see the values the op changes.
+func (p *Patcher) expandOpWildcards(obj reflect.Value, patchOp JSONPatchOp) (JSONPatch, error) {
+	if !p.Options.Wildcards {
+		return JSONPatch{patchOp}, nil
+	}
+	path, err := ParsePath(patchOp.Path)
+	if err != nil {
+		return nil, err
+	}
+	fromPath := []string(nil)
+	if patchOp.Op == OpTypeMove || patchOp.Op == OpTypeCopy {
+		if fromPath, err = ParsePath(patchOp.From); err != nil {
+			return nil, errors.New("from: " + err.Error())
+		}
+	}
+	if !hasWildcard(path, fromPath) {
+		return JSONPatch{patchOp}, nil
+	}
+	return p.expandWildcardOps(obj, patchOp, path, fromPath)
+}
+
+// expandWildcardOps returns a copy of patchOp for each path in obj matching its wildcard path, in the order they're applied.
+// Returns an error if nothing matches, or if patchOp isn't an add, replace, remove, or test op.
+func (p *Patcher) expandWildcardOps(obj reflect.Value, patchOp JSONPatchOp, path []string, fromPath []string) (JSONPatch, error) {
+	switch patchOp.Op {
+	case OpTypeAdd, OpTypeReplace, OpTypeRemove, OpTypeTest:
+	default:
+		return nil, errors.New("wildcard paths are only supported in add, replace, remove, and test ops, not " + string(patchOp.Op))
+	}
+	if hasWildcard(fromPath) {
+		return nil, errors.New("wildcard paths are only supported in path, not from")
+	}
+
+	paths := [][]string{}
+	if err := expandWildcardPath(obj, obj.Type(), nil, path, &paths); err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("wildcard path '" + redactPath(obj.Type(), path) + "' matched nothing")
+	}
+	if patchOp.Op == OpTypeRemove || (patchOp.Op == OpTypeAdd && p.Options.InsertOnAdd) {
+		sortRemovePaths(paths) // inserting from the last element to the first doesn't shift the rest either
+	}
+
+	matchOps := make(JSONPatch, len(paths))
+	for i, matchPath := range paths {
+		matchOps[i] = patchOp
+		matchOps[i].Path = FormatPath(matchPath)
+		if patchOp.Value != nil && patchOp.Op != OpTypeTest {
+			// each match gets its own copy, so they don't share slices, maps, or pointers
+			matchOps[i].Value = deepCopy(reflect.ValueOf(patchOp.Value)).Interface()
+		}
+	}
+	return matchOps, nil
+}
+
+// expandWildcardPath appends the paths in obj matching the remaining path to paths, each prefixed with prefix.
+// Slice and array elements are matched in index order, and map values in key order. A path whose parent doesn't exist in obj matches nothing.
+// Returns an error if a wildcard matches a value which isn't a slice, array, or map. The paths in errors are in a value of the root type.
+func expandWildcardPath(obj reflect.Value, root reflect.Type, prefix []string, path []string, paths *[][]string) error {
+	for i, token := range path {
+		if token != WildcardToken {
+			continue
+		}
+		for _, walkToken := range path[:i] {
+			next, err := getNextVal(walkToken, obj, false, nil)
+			if err != nil {
+				return nil
+			}
+			obj = next
+		}
+		walked := append(prefix[:len(prefix):len(prefix)], path[:i]...)
+
+		for obj.Kind() == reflect.Ptr || obj.Kind() == reflect.Interface {
+			if obj.IsNil() {
+				return nil
+			}
+			obj = obj.Elem()
+		}
+		switch obj.Kind() {
+		case reflect.Slice, reflect.Array:
+			for elemI := 0; elemI < obj.Len(); elemI++ {
+				if err := expandWildcardPath(obj.Index(elemI), root, append(walked[:len(walked):len(walked)], strconv.Itoa(elemI)), path[i+1:], paths); err != nil {
+					return err
+				}
+			}
+		case reflect.Map:
+			keys := map[string]reflect.Value{}
+			tokens := []string{}
+			iter := obj.MapRange()
+			for iter.Next() {
+				keyToken, err := formatMapKey(iter.Key())
+				if err != nil {
+					return errors.New("expanding wildcard at '" + redactPath(root, walked) + "': " + err.Error())
+				}
+				keys[keyToken] = iter.Value()
+				tokens = append(tokens, keyToken)
+			}
+			sort.Strings(tokens)
+			for _, keyToken := range tokens {
+				if err := expandWildcardPath(keys[keyToken], root, append(walked[:len(walked):len(walked)], keyToken), path[i+1:], paths); err != nil {
+					return err
+				}
+			}
+		default:
+			return errors.New("can't expand wildcard at '" + redactPath(root, walked) + "': " + obj.Type().String() + " isn't a slice, array, or map")
+		}
+		return nil
+	}
+	// the value containing the match must exist, so a nil element, for example, doesn't match
+	if len(path) > 0 {
+		parent, _, err := getValAt(path[:len(path)-1], obj, false)
+		if err != nil || (parent.Kind() == reflect.Ptr && parent.IsNil()) {
+			return nil
+		}
+	}
+	*paths = append(*paths, append(prefix[:len(prefix):len(prefix)], path...))
+	return nil
+}
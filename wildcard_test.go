@@ -0,0 +1,190 @@
+package jsonpatch
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWildcard(t *testing.T) {
+	type Server struct {
+		Enabled  bool     `json:"enabled"`
+		Sessions []string `json:"sessions"`
+		Port     int      `json:"port"`
+	}
+	type TestObj struct {
+		Servers []Server           `json:"servers"`
+		Users   map[string]*Server `json:"users"`
+		Ports   [3]int             `json:"ports"`
+		Tags    []string           `json:"tags"`
+	}
+
+	patch := JSONPatch{
+		{Op: OpTypeTest, Path: "/servers/*/enabled", Value: true},
+		{Op: OpTypeReplace, Path: "/servers/*/enabled", Value: false},
+		{Op: OpTypeRemove, Path: "/users/*/sessions"},
+		{Op: OpTypeReplace, Path: "/ports/*", Value: 0},
+		{Op: OpTypeRemove, Path: "/tags/*"},
+		{Op: OpTypeAdd, Path: "/servers/*/sessions", Value: []string{"new"}},
+	}
+
+	obj := &TestObj{
+		Servers: []Server{{Enabled: true, Port: 80}, {Enabled: true, Port: 81}},
+		Users: map[string]*Server{
+			"alice": {Sessions: []string{"a1", "a2"}},
+			"bob":   {Sessions: []string{"b1"}},
+			"carol": nil,
+		},
+		Ports: [3]int{1, 2, 3},
+		Tags:  []string{"x", "y", "z"},
+	}
+
+	if err := ApplyWithOptions(patch, obj, Options{Wildcards: true}); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	expected := &TestObj{
+		Servers: []Server{{Port: 80, Sessions: []string{"new"}}, {Port: 81, Sessions: []string{"new"}}},
+		Users:   map[string]*Server{"alice": {}, "bob": {}, "carol": nil},
+		Tags:    []string{"", "", ""},
+	}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("Apply wildcards expected %+v actual %+v", expected, obj)
+	}
+	obj.Servers[0].Sessions[0] = "changed"
+	if obj.Servers[1].Sessions[0] != "new" {
+		t.Errorf("Apply obj.Servers[1].Sessions[0] expected %+v actual %+v", "new", obj.Servers[1].Sessions[0])
+	}
+}
+
+func TestWildcardAtomic(t *testing.T) {
+	type User struct {
+		Sessions []string `json:"sessions"`
+	}
+	type TestObj struct {
+		Users map[string]*User `json:"users"`
+	}
+
+	// dave has no session 0 to replace, so the fan-out fails after alice and bob
+	obj := &TestObj{Users: map[string]*User{
+		"alice": {Sessions: []string{"a1"}},
+		"bob":   {Sessions: []string{"b1"}},
+		"dave":  {Sessions: []string{}},
+	}}
+	err := ApplyWithOptions(JSONPatch{{Op: OpTypeReplace, Path: "/users/*/sessions/0", Value: "replaced"}}, obj, Options{Wildcards: true})
+	if err == nil || !strings.Contains(err.Error(), "/users/dave/sessions/0") {
+		t.Errorf("Apply wildcard error expected '/users/dave/sessions/0' actual %+v", err)
+	}
+	if obj.Users["alice"].Sessions[0] != "a1" || obj.Users["bob"].Sessions[0] != "b1" {
+		t.Errorf("Apply wildcard failed expected unchanged actual %+v %+v", obj.Users["alice"], obj.Users["bob"])
+	}
+}
+
+func TestWildcardInPlace(t *testing.T) {
+	type Server struct {
+		Port int `json:"port"`
+	}
+	type TestObj struct {
+		Servers []Server `json:"servers"`
+	}
+
+	obj := &TestObj{Servers: []Server{{Port: 80}, {Port: 81}}}
+	servers := obj.Servers
+	opts := Options{Wildcards: true}
+	if err := ApplyWithOptions(JSONPatch{{Op: OpTypeTest, Path: "/servers/*/port", Value: 80}}, obj, opts); err == nil {
+		t.Errorf("Apply wildcard test error expected non-nil actual nil")
+	}
+	if err := ApplyWithOptions(JSONPatch{{Op: OpTypeReplace, Path: "/servers/*/port", Value: 8080}}, obj, opts); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if &obj.Servers[0] != &servers[0] {
+		t.Errorf("Apply wildcard expected obj.Servers modified in place")
+	}
+	if servers[0].Port != 8080 || servers[1].Port != 8080 {
+		t.Errorf("Apply obj.Servers expected ports 8080 8080 actual %+v", servers)
+	}
+}
+
+func TestWildcardInsertOnAdd(t *testing.T) {
+	type TestObj struct {
+		Nums  []int   `json:"nums"`
+		Lists [][]int `json:"lists"`
+	}
+
+	// each insert is before the element it matched, so the inserts don't shift the elements the others match
+	obj := &TestObj{Nums: []int{1, 2, 3}, Lists: [][]int{{1}, {2, 3}}}
+	patch := JSONPatch{
+		{Op: OpTypeAdd, Path: "/nums/*", Value: 9},
+		{Op: OpTypeAdd, Path: "/lists/*/0", Value: 0},
+	}
+	opts := Options{Wildcards: true, InsertOnAdd: true}
+	changes, err := (&Patcher{Options: opts}).Preview(patch, obj)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if err := ApplyWithOptions(patch, obj, opts); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	expected := &TestObj{Nums: []int{9, 1, 9, 2, 9, 3}, Lists: [][]int{{0, 1}, {0, 2, 3}}}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("Apply wildcard inserts expected %+v actual %+v", expected, obj)
+	}
+	paths := []string{}
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+	if expected := []string{"/nums/2", "/nums/1", "/nums/0", "/lists/1/0", "/lists/0/0"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Preview wildcard inserts expected %+v actual %+v", expected, paths)
+	}
+}
+
+func TestWildcardErrors(t *testing.T) {
+	type User struct {
+		Port     int      `json:"port"`
+		Sessions []string `json:"sessions"`
+	}
+	type TestObj struct {
+		Servers []User           `json:"servers"`
+		Users   map[string]*User `json:"users"`
+		Tags    []string         `json:"tags"`
+		Name    string           `json:"name"`
+	}
+
+	tests := []struct {
+		name   string
+		op     JSONPatchOp
+		errStr string
+	}{
+		{"empty slice", JSONPatchOp{Op: OpTypeReplace, Path: "/servers/*/port", Value: 1}, "matched nothing"},
+		{"empty map", JSONPatchOp{Op: OpTypeRemove, Path: "/users/*/sessions"}, "matched nothing"},
+		{"missing field", JSONPatchOp{Op: OpTypeRemove, Path: "/nonexistent/*"}, "matched nothing"},
+		{"struct", JSONPatchOp{Op: OpTypeRemove, Path: "/name/*"}, "isn't a slice, array, or map"},
+		{"move", JSONPatchOp{Op: OpTypeMove, From: "/tags/0", Path: "/servers/*"}, "only supported in add, replace, remove, and test"},
+		{"from", JSONPatchOp{Op: OpTypeCopy, From: "/tags/*", Path: "/name"}, "only supported in add, replace, remove, and test"},
+	}
+	for _, test := range tests {
+		obj := &TestObj{Users: map[string]*User{}}
+		err := ApplyWithOptions(JSONPatch{test.op}, obj, Options{Wildcards: true})
+		if err == nil || !strings.Contains(err.Error(), test.errStr) {
+			t.Errorf("Apply wildcard %v error expected '%v' actual %+v", test.name, test.errStr, err)
+		}
+	}
+}
+
+func TestWildcardLiteral(t *testing.T) {
+	type User struct {
+		Port int `json:"port"`
+	}
+	type TestObj struct {
+		Users map[string]*User `json:"users"`
+	}
+
+	// without the option, "*" is a literal token
+	obj := &TestObj{Users: map[string]*User{"*": {}, "other": {}}}
+	if err := Apply(JSONPatch{{Op: OpTypeReplace, Path: "/users/*/port", Value: 1}}, obj); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if obj.Users["*"].Port != 1 || obj.Users["other"].Port != 0 {
+		t.Errorf("Apply literal * expected ports 1 0 actual %+v %+v", obj.Users["*"], obj.Users["other"])
+	}
+}